@@ -0,0 +1,383 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type AbilityController struct {
+	db *sql.DB
+}
+
+func NewAbilityController(db *sql.DB) *AbilityController {
+	return &AbilityController{
+		db: db,
+	}
+}
+
+// GetAll lists the abilities, narrowed down by the category, char_id,
+// class_id and skill_id query parameters when present
+func (cc *AbilityController) GetAll(w http.ResponseWriter, r *http.Request) {
+	var filter abilityFilter
+	filter.category = r.URL.Query().Get("category")
+	if filter.category != "" && !slices.Contains(validAbilityCategories, filter.category) {
+		writeError(w, r, BadRequest("Unknown ability category %q", filter.category))
+		return
+	}
+
+	var err error
+	for _, id := range []struct {
+		param  string
+		target **int
+	}{
+		{"char_id", &filter.charID},
+		{"class_id", &filter.classID},
+		{"skill_id", &filter.skillID},
+	} {
+		*id.target, err = queryID(r, id.param)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	abilities, err := cc.getAllAbilities(filter)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting abilities: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, abilities)
+}
+
+// abilityFilter narrows down getAllAbilities; zero fields match every ability
+type abilityFilter struct {
+	category                 string
+	charID, classID, skillID *int
+}
+
+func (cc *AbilityController) getAllAbilities(filter abilityFilter) ([]Ability, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(column string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if filter.category != "" {
+		where("category", filter.category)
+	}
+	if filter.charID != nil {
+		where("char_id", *filter.charID)
+	}
+	if filter.classID != nil {
+		where("class_id", *filter.classID)
+	}
+	if filter.skillID != nil {
+		where("skill_id", *filter.skillID)
+	}
+
+	query := "SELECT * FROM abilities"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := cc.db.Query(query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var abilities []Ability
+
+	for rows.Next() {
+		var ability Ability
+		err := rows.Scan(abilityColumns(&ability)...)
+		if err != nil {
+			return nil, err
+		}
+		abilities = append(abilities, ability)
+	}
+
+	return abilities, nil
+}
+
+// abilityColumns returns the scan targets of an abilities row in column order
+func abilityColumns(ability *Ability) []interface{} {
+	return []interface{}{&ability.ID, &ability.Name, &ability.Category, &ability.Description,
+		jsonColumn{&ability.Effects}, &ability.CharID, &ability.ClassID, &ability.SkillID,
+		&ability.SkillRank, &ability.CreatedAt, &ability.UpdatedAt}
+}
+
+func (cc *AbilityController) GetOne(w http.ResponseWriter, r *http.Request) {
+	abilityID := mux.Vars(r)["abilityID"]
+	id, err := strconv.Atoi(abilityID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid ability ID"))
+		return
+	}
+
+	ability, err := cc.getAbilityByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting ability: %w", err))
+		return
+	}
+
+	if ability == nil {
+		writeError(w, r, NotFound("Ability not found"))
+		return
+	}
+
+	if writeNotModified(w, r, etagFor(ability.ID, ability.UpdatedAt)) {
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, ability)
+}
+
+func (cc *AbilityController) getAbilityByID(id int) (*Ability, error) {
+	row := cc.db.QueryRow("SELECT * FROM abilities WHERE id = $1", id)
+
+	var ability Ability
+	err := row.Scan(abilityColumns(&ability)...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &ability, nil
+}
+
+func (cc *AbilityController) PostOne(w http.ResponseWriter, r *http.Request) {
+	var ability Ability
+	err := decodeJSON(r, &ability)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
+		return
+	}
+
+	err = ability.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	ability.CreatedAt = time.Now()
+	ability.UpdatedAt = time.Now()
+
+	err = cc.insertAbility(&ability)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error inserting ability: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(ability.ID, ability.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, ability)
+}
+
+func (cc *AbilityController) insertAbility(ability *Ability) error {
+	if ability.Effects == nil {
+		ability.Effects = []AbilityEffect{}
+	}
+
+	err := cc.db.QueryRow(`
+		INSERT INTO abilities (name, category, description, effects, char_id, class_id,
+			skill_id, skill_rank, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at, updated_at
+	`, ability.Name, ability.Category, ability.Description, jsonColumn{ability.Effects}, ability.CharID,
+		ability.ClassID, ability.SkillID, ability.SkillRank, ability.CreatedAt, ability.UpdatedAt).Scan(
+		&ability.ID, &ability.CreatedAt, &ability.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cc *AbilityController) PutOne(w http.ResponseWriter, r *http.Request) {
+	abilityID := mux.Vars(r)["abilityID"]
+	id, err := strconv.Atoi(abilityID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid ability ID"))
+		return
+	}
+
+	var updatedAbility Ability
+	err = decodeJSON(r, &updatedAbility)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
+		return
+	}
+
+	err = updatedAbility.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	current, err := cc.getAbilityByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting ability: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Ability not found"))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedAbility.UpdatedAt = time.Now()
+
+	err = cc.updateAbility(id, &updatedAbility, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating ability: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedAbility.ID, updatedAbility.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedAbility)
+}
+
+func (cc *AbilityController) PatchOne(w http.ResponseWriter, r *http.Request) {
+	abilityID := mux.Vars(r)["abilityID"]
+	id, err := strconv.Atoi(abilityID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid ability ID"))
+		return
+	}
+
+	updatedAbility, err := cc.getAbilityByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting ability: %w", err))
+		return
+	}
+
+	if updatedAbility == nil {
+		writeError(w, r, NotFound("Ability not found"))
+		return
+	}
+
+	version := updatedAbility.UpdatedAt
+	err = checkIfMatch(r, etagFor(updatedAbility.ID, version))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = applyMergePatch(r, updatedAbility)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = updatedAbility.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedAbility.UpdatedAt = time.Now()
+
+	err = cc.updateAbility(id, updatedAbility, version)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating ability: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedAbility.ID, updatedAbility.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedAbility)
+}
+
+func (cc *AbilityController) updateAbility(id int, updatedAbility *Ability, version time.Time) error {
+	if updatedAbility.Effects == nil {
+		updatedAbility.Effects = []AbilityEffect{}
+	}
+
+	// Every column is written so that PUT replaces the whole ability. The row
+	// is only updated if it has not changed since version was read.
+	err := cc.db.QueryRow(`
+		UPDATE abilities SET name = $1, category = $2, description = $3, effects = $4,
+			char_id = $5, class_id = $6, skill_id = $7, skill_rank = $8, updated_at = $9
+		WHERE id = $10 AND updated_at = $11
+		RETURNING *
+	`, updatedAbility.Name, updatedAbility.Category, updatedAbility.Description,
+		jsonColumn{updatedAbility.Effects}, updatedAbility.CharID, updatedAbility.ClassID,
+		updatedAbility.SkillID, updatedAbility.SkillRank, updatedAbility.UpdatedAt, id, version).Scan(
+		abilityColumns(updatedAbility)...)
+
+	if err == sql.ErrNoRows {
+		return Conflict("Ability with ID %d was modified or deleted by another request", id)
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cc *AbilityController) DeleteOne(w http.ResponseWriter, r *http.Request) {
+	abilityID := mux.Vars(r)["abilityID"]
+	id, err := strconv.Atoi(abilityID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid ability ID"))
+		return
+	}
+
+	current, err := cc.getAbilityByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting ability: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Ability with ID %d not found", id))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = cc.deleteAbility(id, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error deleting ability: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, deleteResult{Success: true, Msg: "Ability deleted successfully."})
+}
+
+func (cc *AbilityController) deleteAbility(id int, version time.Time) error {
+	// Only delete the row if it has not changed since version was read
+	result, err := cc.db.Exec("DELETE FROM abilities WHERE id = $1 AND updated_at = $2", id, version)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return Conflict("Ability with ID %d was modified or deleted by another request", id)
+	}
+
+	return nil
+}
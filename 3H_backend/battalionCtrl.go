@@ -0,0 +1,343 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// authoritySkill is the name of the skill battalions require a rank in
+const authoritySkill = "Authority"
+
+type BattalionController struct {
+	db *sql.DB
+}
+
+func NewBattalionController(db *sql.DB) *BattalionController {
+	return &BattalionController{
+		db: db,
+	}
+}
+
+func (cc *BattalionController) GetAll(w http.ResponseWriter, r *http.Request) {
+	battalions, err := cc.getAllBattalions()
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting battalions: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, battalions)
+}
+
+func (cc *BattalionController) getAllBattalions() ([]Battalion, error) {
+	rows, err := cc.db.Query("SELECT * FROM battalions")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var battalions []Battalion
+
+	for rows.Next() {
+		var battalion Battalion
+		err := rows.Scan(battalionColumns(&battalion)...)
+		if err != nil {
+			return nil, err
+		}
+		battalions = append(battalions, battalion)
+	}
+
+	return battalions, nil
+}
+
+// battalionColumns returns the scan targets of a battalions row in column order
+func battalionColumns(battalion *Battalion) []interface{} {
+	return []interface{}{&battalion.ID, &battalion.Name, (*IntArrayScanner)(&battalion.StatBonus),
+		&battalion.Endurance, &battalion.AuthorityID, &battalion.AuthorityRank, &battalion.GambitID,
+		&battalion.Description, &battalion.CreatedAt, &battalion.UpdatedAt}
+}
+
+// validate checks the battalion and that authority_id references the
+// Authority skill
+func (cc *BattalionController) validate(battalion *Battalion) error {
+	err := battalion.Validate()
+	if err != nil {
+		return err
+	}
+
+	skill, err := NewSkillsController(cc.db).getSkillByID(battalion.AuthorityID)
+	if err != nil {
+		return fmt.Errorf("error getting skill: %w", err)
+	}
+
+	if skill == nil || !strings.EqualFold(skill.Name, authoritySkill) {
+		return ValidationErrors{{Field: "authority_id", Message: "must reference the " + authoritySkill + " skill"}}
+	}
+
+	return nil
+}
+
+func (cc *BattalionController) GetOne(w http.ResponseWriter, r *http.Request) {
+	battalionID := mux.Vars(r)["battalionID"]
+	id, err := strconv.Atoi(battalionID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid battalion ID"))
+		return
+	}
+
+	battalion, err := cc.getBattalionByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting battalion: %w", err))
+		return
+	}
+
+	if battalion == nil {
+		writeError(w, r, NotFound("Battalion not found"))
+		return
+	}
+
+	if writeNotModified(w, r, etagFor(battalion.ID, battalion.UpdatedAt)) {
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, battalion)
+}
+
+func (cc *BattalionController) getBattalionByID(id int) (*Battalion, error) {
+	row := cc.db.QueryRow("SELECT * FROM battalions WHERE id = $1", id)
+
+	var battalion Battalion
+	err := row.Scan(battalionColumns(&battalion)...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &battalion, nil
+}
+
+func (cc *BattalionController) PostOne(w http.ResponseWriter, r *http.Request) {
+	var battalion Battalion
+	err := decodeJSON(r, &battalion)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
+		return
+	}
+
+	err = cc.validate(&battalion)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	battalion.CreatedAt = time.Now()
+	battalion.UpdatedAt = time.Now()
+
+	err = cc.insertBattalion(&battalion)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error inserting battalion: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(battalion.ID, battalion.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, battalion)
+}
+
+func (cc *BattalionController) insertBattalion(battalion *Battalion) error {
+	err := cc.db.QueryRow(`
+		INSERT INTO battalions (name, stat_bonus, endurance, authority_id, authority_rank,
+			gambit_id, description, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at, updated_at
+	`, battalion.Name, pq.Array(battalion.StatBonus), battalion.Endurance, battalion.AuthorityID,
+		battalion.AuthorityRank, battalion.GambitID, battalion.Description, battalion.CreatedAt,
+		battalion.UpdatedAt).Scan(&battalion.ID, &battalion.CreatedAt, &battalion.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cc *BattalionController) PutOne(w http.ResponseWriter, r *http.Request) {
+	battalionID := mux.Vars(r)["battalionID"]
+	id, err := strconv.Atoi(battalionID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid battalion ID"))
+		return
+	}
+
+	var updatedBattalion Battalion
+	err = decodeJSON(r, &updatedBattalion)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
+		return
+	}
+
+	err = cc.validate(&updatedBattalion)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	current, err := cc.getBattalionByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting battalion: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Battalion not found"))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedBattalion.UpdatedAt = time.Now()
+
+	err = cc.updateBattalion(id, &updatedBattalion, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating battalion: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedBattalion.ID, updatedBattalion.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedBattalion)
+}
+
+func (cc *BattalionController) PatchOne(w http.ResponseWriter, r *http.Request) {
+	battalionID := mux.Vars(r)["battalionID"]
+	id, err := strconv.Atoi(battalionID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid battalion ID"))
+		return
+	}
+
+	updatedBattalion, err := cc.getBattalionByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting battalion: %w", err))
+		return
+	}
+
+	if updatedBattalion == nil {
+		writeError(w, r, NotFound("Battalion not found"))
+		return
+	}
+
+	version := updatedBattalion.UpdatedAt
+	err = checkIfMatch(r, etagFor(updatedBattalion.ID, version))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = applyMergePatch(r, updatedBattalion)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = cc.validate(updatedBattalion)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedBattalion.UpdatedAt = time.Now()
+
+	err = cc.updateBattalion(id, updatedBattalion, version)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating battalion: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedBattalion.ID, updatedBattalion.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedBattalion)
+}
+
+func (cc *BattalionController) updateBattalion(id int, updatedBattalion *Battalion, version time.Time) error {
+	// Every column is written so that PUT replaces the whole battalion. The row is
+	// only updated if it has not changed since version was read.
+	err := cc.db.QueryRow(`
+		UPDATE battalions SET name = $1, stat_bonus = $2, endurance = $3, authority_id = $4,
+			authority_rank = $5, gambit_id = $6, description = $7, updated_at = $8
+		WHERE id = $9 AND updated_at = $10
+		RETURNING *
+	`, updatedBattalion.Name, pq.Array(updatedBattalion.StatBonus), updatedBattalion.Endurance,
+		updatedBattalion.AuthorityID, updatedBattalion.AuthorityRank, updatedBattalion.GambitID,
+		updatedBattalion.Description, updatedBattalion.UpdatedAt, id, version).Scan(
+		battalionColumns(updatedBattalion)...)
+
+	if err == sql.ErrNoRows {
+		return Conflict("Battalion with ID %d was modified or deleted by another request", id)
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cc *BattalionController) DeleteOne(w http.ResponseWriter, r *http.Request) {
+	battalionID := mux.Vars(r)["battalionID"]
+	id, err := strconv.Atoi(battalionID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid battalion ID"))
+		return
+	}
+
+	current, err := cc.getBattalionByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting battalion: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Battalion with ID %d not found", id))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = cc.deleteBattalion(id, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error deleting battalion: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, deleteResult{Success: true, Msg: "Battalion deleted successfully."})
+}
+
+func (cc *BattalionController) deleteBattalion(id int, version time.Time) error {
+	// Only delete the row if it has not changed since version was read
+	result, err := cc.db.Exec("DELETE FROM battalions WHERE id = $1 AND updated_at = $2", id, version)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return Conflict("Battalion with ID %d was modified or deleted by another request", id)
+	}
+
+	return nil
+}
@@ -2,12 +2,9 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -26,20 +23,12 @@ func NewCombatArtController(db *sql.DB) *CombatArtController {
 func (cc *CombatArtController) GetAll(w http.ResponseWriter, r *http.Request) {
 	combatArts, err := cc.getAllCombatArts()
 	if err != nil {
-		log.Printf("Error querying all combat arts: %s", err)
-		http.Error(w, fmt.Sprintf("Error getting combat arts: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting combat arts: %w", err))
 		return
 	}
 
 	// Convert combatArts to JSON and send it in the response
-	responseJSON, err := json.Marshal(combatArts)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding combat arts to JSON: %s", err), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	writeJSON(w, r, http.StatusOK, combatArts)
 }
 
 // Implement this method to retrieve all combatArts from the database
@@ -48,7 +37,6 @@ func (cc *CombatArtController) getAllCombatArts() ([]CombatArts, error) {
 	// Example:
 	rows, err := cc.db.Query("SELECT * FROM combat_arts")
 	if err != nil {
-		log.Printf("Error querying all combat arts: %s", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -73,29 +61,26 @@ func (cc *CombatArtController) GetOne(w http.ResponseWriter, r *http.Request) {
 	artID := mux.Vars(r)["artID"]
 	id, err := strconv.Atoi(artID)
 	if err != nil {
-		http.Error(w, "Invalid combat art ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid combat art ID"))
 		return
 	}
 
 	combatArt, err := cc.getCombatArtByID(id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting combat art: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting combat art: %w", err))
 		return
 	}
 
 	if combatArt == nil {
-		http.Error(w, "combat art not found", http.StatusNotFound)
+		writeError(w, r, NotFound("combat art not found"))
 		return
 	}
 
-	responseJSON, err := json.Marshal(combatArt)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding combat art to JSON: %s", err), http.StatusInternalServerError)
+	if writeNotModified(w, r, etagFor(combatArt.ID, combatArt.UpdatedAt)) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	writeJSON(w, r, http.StatusOK, combatArt)
 }
 
 func (cc *CombatArtController) getCombatArtByID(id int) (*CombatArts, error) {
@@ -118,29 +103,29 @@ func (cc *CombatArtController) getCombatArtByID(id int) (*CombatArts, error) {
 
 func (cc *CombatArtController) PostOne(w http.ResponseWriter, r *http.Request) {
 	var combatArt CombatArts
-	err := json.NewDecoder(r.Body).Decode(&combatArt)
+	err := decodeJSON(r, &combatArt)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error decoding request body: %s", err), http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
 		return
 	}
 
-	combatArt.CreatedAt = time.Now()
-	combatArt.UpdatedAt = time.Now()
-
-	err = cc.insertCombatArt(&combatArt)
+	err = combatArt.Validate()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error inserting combat art: %s", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	responseJSON, err := json.Marshal(combatArt)
+	combatArt.CreatedAt = time.Now()
+	combatArt.UpdatedAt = time.Now()
+
+	err = cc.insertCombatArt(&combatArt)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding combat art to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error inserting combat art: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	w.Header().Set("ETag", etagFor(combatArt.ID, combatArt.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, combatArt)
 }
 
 func (cc *CombatArtController) insertCombatArt(combatArt *CombatArts) error {
@@ -149,9 +134,9 @@ func (cc *CombatArtController) insertCombatArt(combatArt *CombatArts) error {
 		INSERT INTO combat_arts (name, type_id, str_mag, might, hit, critical, durability_cost,
 			 range_min, range_max, description, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11,$12)
-		RETURNING id
+		RETURNING id, created_at, updated_at
 	`, combatArt.Name, combatArt.TypeID, combatArt.StrMag, combatArt.Might, combatArt.Hit, combatArt.Critical, combatArt.DurabilityCost,
-		combatArt.RangeMin, combatArt.RangeMax, combatArt.Description, combatArt.CreatedAt, combatArt.UpdatedAt).Scan(&combatArt.ID)
+		combatArt.RangeMin, combatArt.RangeMax, combatArt.Description, combatArt.CreatedAt, combatArt.UpdatedAt).Scan(&combatArt.ID, &combatArt.CreatedAt, &combatArt.UpdatedAt)
 
 	if err != nil {
 		return err
@@ -164,94 +149,123 @@ func (cc *CombatArtController) PutOne(w http.ResponseWriter, r *http.Request) {
 	artID := mux.Vars(r)["artID"]
 	id, err := strconv.Atoi(artID)
 	if err != nil {
-		http.Error(w, "Invalid combat art ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid combat art ID"))
 		return
 	}
 
 	var updatedArt CombatArts
-	err = json.NewDecoder(r.Body).Decode(&updatedArt)
+	err = decodeJSON(r, &updatedArt)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error decoding request body: %s", err), http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
 		return
 	}
 
-	updatedArt.UpdatedAt = time.Now()
-
-	err = cc.updatedArt(id, &updatedArt)
+	err = updatedArt.Validate()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error updating combat art: %s", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	responseJSON, err := json.Marshal(updatedArt)
+	current, err := cc.getCombatArtByID(id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding updated combat art to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting combat art: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
-}
-
-func (cc *CombatArtController) updatedArt(id int, updatedArt *CombatArts) error {
-	// Start building the SQL query
-	query := "UPDATE combat_arts SET updated_at = $1"
-	args := []interface{}{updatedArt.UpdatedAt}
-
-	// Conditionally include fields in the update query
-	if updatedArt.Name != "" {
-		query += ", name = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedArt.Name)
+	if current == nil {
+		writeError(w, r, NotFound("Combat art not found"))
+		return
 	}
-	if updatedArt.TypeID != 0 {
-		query += ", type_id = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedArt.TypeID)
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	if updatedArt.StrMag != nil {
-		query += ", str_mag = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedArt.StrMag)
+
+	updatedArt.UpdatedAt = time.Now()
+
+	err = cc.updatedArt(id, &updatedArt, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating combat art: %w", err))
+		return
 	}
-	if updatedArt.Might != nil {
-		query += ", might = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedArt.Might)
+
+	w.Header().Set("ETag", etagFor(updatedArt.ID, updatedArt.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedArt)
+}
+
+func (cc *CombatArtController) PatchOne(w http.ResponseWriter, r *http.Request) {
+	artID := mux.Vars(r)["artID"]
+	id, err := strconv.Atoi(artID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid combat art ID"))
+		return
 	}
-	if updatedArt.Hit != nil {
-		query += ", hit = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedArt.Hit)
+
+	updatedArt, err := cc.getCombatArtByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting combat art: %w", err))
+		return
 	}
-	if updatedArt.Critical != nil {
-		query += ", critical = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedArt.Critical)
+
+	if updatedArt == nil {
+		writeError(w, r, NotFound("Combat art not found"))
+		return
 	}
-	if updatedArt.DurabilityCost != 0 {
-		query += ", durability_cost = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedArt.DurabilityCost)
+
+	version := updatedArt.UpdatedAt
+	err = checkIfMatch(r, etagFor(updatedArt.ID, version))
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
-	if updatedArt.RangeMin != 0 {
-		query += ", range_min = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedArt.RangeMin)
+	err = applyMergePatch(r, updatedArt)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	if updatedArt.RangeMax != nil {
-		query += ", range_max = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedArt.RangeMax)
+
+	err = updatedArt.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	if updatedArt.Description != nil {
-		query += ", description = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedArt.Description)
+
+	updatedArt.UpdatedAt = time.Now()
+
+	err = cc.updatedArt(id, updatedArt, version)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating combat art: %w", err))
+		return
 	}
 
-	// Finish the query with the WHERE clause
-	query += " WHERE id = $" + strconv.Itoa(len(args)+1)
-	args = append(args, id)
-	err := cc.db.QueryRow(query+" RETURNING *", args...).Scan(
+	w.Header().Set("ETag", etagFor(updatedArt.ID, updatedArt.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedArt)
+}
+
+func (cc *CombatArtController) updatedArt(id int, updatedArt *CombatArts, version time.Time) error {
+	// Every column is written so that PUT replaces the whole combat art. The row is
+	// only updated if it has not changed since version was read.
+	err := cc.db.QueryRow(`
+		UPDATE combat_arts SET name = $1, type_id = $2, str_mag = $3, might = $4, hit = $5,
+			critical = $6, durability_cost = $7, range_min = $8, range_max = $9,
+			description = $10, updated_at = $11
+		WHERE id = $12 AND updated_at = $13
+		RETURNING *
+	`, updatedArt.Name, updatedArt.TypeID, updatedArt.StrMag, updatedArt.Might,
+		updatedArt.Hit, updatedArt.Critical, updatedArt.DurabilityCost, updatedArt.RangeMin,
+		updatedArt.RangeMax, updatedArt.Description, updatedArt.UpdatedAt, id, version).Scan(
 		&updatedArt.ID, &updatedArt.Name, &updatedArt.TypeID, &updatedArt.StrMag,
 		&updatedArt.Might, &updatedArt.Hit, &updatedArt.Critical,
 		&updatedArt.DurabilityCost, &updatedArt.RangeMin,
 		&updatedArt.RangeMax, &updatedArt.Description, &updatedArt.CreatedAt,
 		&updatedArt.UpdatedAt)
 
-	if err != nil {
+	if err == sql.ErrNoRows {
+		return Conflict("Combat art with ID %d was modified or deleted by another request", id)
+	} else if err != nil {
 		return err
 	}
 
@@ -262,41 +276,51 @@ func (cc *CombatArtController) DeleteOne(w http.ResponseWriter, r *http.Request)
 	artID := mux.Vars(r)["artID"]
 	id, err := strconv.Atoi(artID)
 	if err != nil {
-		http.Error(w, "Invalid combat art ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid combat art ID"))
 		return
 	}
 
-	err = cc.deleteComabtArt(id)
+	current, err := cc.getCombatArtByID(id)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, fmt.Sprintf("Combat art with ID %d not found", id), http.StatusNotFound)
-		} else {
-			http.Error(w, fmt.Sprintf("Error deleting combat art: %s", err), http.StatusInternalServerError)
-		}
+		writeError(w, r, fmt.Errorf("error getting combat art: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"success": true, "msg": "Combat art deleted successfully."}`))
-}
+	if current == nil {
+		writeError(w, r, NotFound("Combat art with ID %d not found", id))
+		return
+	}
 
-func (cc *CombatArtController) deleteComabtArt(id int) error {
-	// Check if the combat art exists
-	var exists bool
-	err := cc.db.QueryRow("SELECT EXISTS (SELECT 1 FROM combat_arts WHERE id = $1)", id).Scan(&exists)
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
 	if err != nil {
-		return err
+		writeError(w, r, err)
+		return
+	}
+
+	err = cc.deleteComabtArt(id, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error deleting combat art: %w", err))
+		return
 	}
 
-	if !exists {
-		return fmt.Errorf("combat art with ID %d not found", id)
+	writeJSON(w, r, http.StatusOK, deleteResult{Success: true, Msg: "Combat art deleted successfully."})
+}
+
+func (cc *CombatArtController) deleteComabtArt(id int, version time.Time) error {
+	// Only delete the row if it has not changed since version was read
+	result, err := cc.db.Exec("DELETE FROM combat_arts WHERE id = $1 AND updated_at = $2", id, version)
+	if err != nil {
+		return err
 	}
 
-	// Combat art exists, proceed with deletion
-	_, err = cc.db.Exec("DELETE FROM combat_arts WHERE id = $1", id)
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if affected == 0 {
+		return Conflict("Combat art with ID %d was modified or deleted by another request", id)
+	}
+
 	return nil
 }
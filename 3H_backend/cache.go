@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheEntry is a successful GET response kept by the response cache
+type CacheEntry struct {
+	Body        []byte
+	ContentType string
+	ETag        string
+}
+
+// CacheBackend stores cached responses. The in-process memoryCache is the
+// default; a shared store can be plugged in by implementing this interface.
+type CacheBackend interface {
+	Get(key string) (CacheEntry, bool)
+	Set(key string, entry CacheEntry, ttl time.Duration)
+	// Clear drops every entry. It is called after each successful write.
+	Clear()
+	Len() int
+}
+
+// memoryCache is a CacheBackend holding entries in a map until they expire.
+// Once maxEntries is reached, expired entries are dropped and, if that is
+// not enough, the new entry is not stored.
+type memoryCache struct {
+	mu         sync.RWMutex
+	entries    map[string]memoryCacheItem
+	maxEntries int
+}
+
+type memoryCacheItem struct {
+	entry     CacheEntry
+	expiresAt time.Time
+}
+
+func newMemoryCache(maxEntries int) *memoryCache {
+	return &memoryCache{
+		entries:    map[string]memoryCacheItem{},
+		maxEntries: maxEntries,
+	}
+}
+
+func (mc *memoryCache) Get(key string) (CacheEntry, bool) {
+	mc.mu.RLock()
+	item, ok := mc.entries[key]
+	mc.mu.RUnlock()
+
+	if !ok || time.Now().After(item.expiresAt) {
+		return CacheEntry{}, false
+	}
+	return item.entry, true
+}
+
+func (mc *memoryCache) Set(key string, entry CacheEntry, ttl time.Duration) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if len(mc.entries) >= mc.maxEntries {
+		now := time.Now()
+		for k, item := range mc.entries {
+			if now.After(item.expiresAt) {
+				delete(mc.entries, k)
+			}
+		}
+		if len(mc.entries) >= mc.maxEntries {
+			return
+		}
+	}
+
+	mc.entries[key] = memoryCacheItem{entry: entry, expiresAt: time.Now().Add(ttl)}
+}
+
+func (mc *memoryCache) Clear() {
+	mc.mu.Lock()
+	mc.entries = map[string]memoryCacheItem{}
+	mc.mu.Unlock()
+}
+
+func (mc *memoryCache) Len() int {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	return len(mc.entries)
+}
+
+// CacheStats reports how effective the response cache is
+type CacheStats struct {
+	Hits          uint64  `json:"hits"`
+	Misses        uint64  `json:"misses"`
+	HitRate       float64 `json:"hit_rate"`
+	Invalidations uint64  `json:"invalidations"`
+	Entries       int     `json:"entries"`
+}
+
+// ResponseCache caches the responses of the read routes. The game data
+// rarely changes, so any successful write through this process simply
+// invalidates the whole cache.
+type ResponseCache struct {
+	backend CacheBackend
+	ttl     time.Duration
+	maxAge  time.Duration
+
+	// generation is incremented by every invalidation, under mu, so that a
+	// response computed before a write is not stored once it has completed
+	mu         sync.RWMutex
+	generation uint64
+
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	invalidations atomic.Uint64
+}
+
+// NewResponseCache creates a cache keeping entries for ttl and telling
+// clients they may reuse a response for maxAge
+func NewResponseCache(backend CacheBackend, ttl, maxAge time.Duration) *ResponseCache {
+	return &ResponseCache{
+		backend: backend,
+		ttl:     ttl,
+		maxAge:  maxAge,
+	}
+}
+
+func (rc *ResponseCache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			rec := newResponseRecorder(w)
+			next.ServeHTTP(rec, r)
+			if rec.Status() < http.StatusBadRequest {
+				rc.Invalidate()
+			}
+			return
+		}
+
+		key := rc.key(r)
+		if entry, ok := rc.backend.Get(key); ok {
+			rc.hits.Add(1)
+			rc.writeEntry(w, r, entry)
+			return
+		}
+		rc.misses.Add(1)
+		generation := rc.currentGeneration()
+
+		rec := newResponseRecorder(w)
+		rec.capture = true
+		rec.beforeHeader = func(status int) {
+			w.Header().Set("X-Cache", "MISS")
+			if status == http.StatusOK || status == http.StatusNotModified {
+				w.Header().Set("Cache-Control", rc.cacheControl())
+			}
+		}
+		next.ServeHTTP(rec, r)
+
+		if rec.Status() == http.StatusOK {
+			rc.store(key, generation, CacheEntry{
+				Body:        rec.body.Bytes(),
+				ContentType: w.Header().Get("Content-Type"),
+				ETag:        w.Header().Get("ETag"),
+			})
+		}
+	})
+}
+
+func (rc *ResponseCache) currentGeneration() uint64 {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	return rc.generation
+}
+
+// store caches the entry unless the cache was invalidated since generation
+// was read: the response may then predate the write
+func (rc *ResponseCache) store(key string, generation uint64, entry CacheEntry) {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	if rc.generation == generation {
+		rc.backend.Set(key, entry, rc.ttl)
+	}
+}
+
+func (rc *ResponseCache) writeEntry(w http.ResponseWriter, r *http.Request, entry CacheEntry) {
+	w.Header().Set("X-Cache", "HIT")
+	w.Header().Set("Cache-Control", rc.cacheControl())
+	varyOnShape(w)
+	if entry.ETag != "" && writeNotModified(w, r, entry.ETag) {
+		return
+	}
+
+	w.Header().Set("Content-Type", entry.ContentType)
+	w.Write(entry.Body)
+}
+
+// key identifies a response by its path, query string and JSON shape
+func (rc *ResponseCache) key(r *http.Request) string {
+	if wantsLegacyShape(r) {
+		return r.URL.RequestURI() + " " + legacyShape
+	}
+	return r.URL.RequestURI()
+}
+
+func (rc *ResponseCache) cacheControl() string {
+	return fmt.Sprintf("public, max-age=%d", int(rc.maxAge.Seconds()))
+}
+
+// Invalidate drops every cached response
+func (rc *ResponseCache) Invalidate() {
+	rc.mu.Lock()
+	rc.generation++
+	rc.backend.Clear()
+	rc.mu.Unlock()
+	rc.invalidations.Add(1)
+}
+
+func (rc *ResponseCache) Stats() CacheStats {
+	stats := CacheStats{
+		Hits:          rc.hits.Load(),
+		Misses:        rc.misses.Load(),
+		Invalidations: rc.invalidations.Load(),
+		Entries:       rc.backend.Len(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+func (rc *ResponseCache) GetStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, rc.Stats())
+}
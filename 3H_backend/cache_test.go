@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestCache() *ResponseCache {
+	return NewResponseCache(newMemoryCache(10), time.Minute, time.Minute)
+}
+
+func TestResponseCacheVariesOnShape(t *testing.T) {
+	rc := newTestCache()
+	handler := rc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if writeNotModified(w, r, etagFor(1, time.UnixMicro(1))) {
+			return
+		}
+		writeJSON(w, r, http.StatusOK, Stats{HP: 20})
+	}))
+
+	for _, test := range []struct {
+		name        string
+		ifNoneMatch string
+		cache       string
+		status      int
+	}{
+		{"miss", "", "MISS", http.StatusOK},
+		{"hit", "", "HIT", http.StatusOK},
+		{"not modified", etagFor(1, time.UnixMicro(1)), "HIT", http.StatusNotModified},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/stats", nil)
+			if test.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", test.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != test.status || w.Header().Get("X-Cache") != test.cache {
+				t.Fatalf("status %d, X-Cache %q", w.Code, w.Header().Get("X-Cache"))
+			}
+			if vary := w.Header().Values("Vary"); len(vary) != 1 || vary[0] != jsonShapeHeader {
+				t.Errorf("Vary = %q, want %s once", vary, jsonShapeHeader)
+			}
+		})
+	}
+}
+
+func TestResponseCacheSkipsResponsesOlderThanAWrite(t *testing.T) {
+	rc := newTestCache()
+	invalidate := true
+	handler := rc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A write completing while this response is computed
+		if invalidate {
+			rc.Invalidate()
+		}
+		writeJSON(w, r, http.StatusOK, Stats{HP: 20})
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/stats", nil))
+	if n := rc.backend.Len(); n != 0 {
+		t.Fatalf("stale response cached, %d entries", n)
+	}
+
+	invalidate = false
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/stats", nil))
+	if n := rc.backend.Len(); n != 1 {
+		t.Fatalf("%d entries, want 1", n)
+	}
+}
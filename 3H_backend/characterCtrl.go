@@ -2,15 +2,14 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 )
 
 type CharacterController struct {
@@ -26,20 +25,12 @@ func NewCharacterController(db *sql.DB) *CharacterController {
 func (cc *CharacterController) GetAll(w http.ResponseWriter, r *http.Request) {
 	characters, err := cc.getAllCharacters()
 	if err != nil {
-		log.Printf("Error querying all characters: %s", err)
-		http.Error(w, fmt.Sprintf("Error getting characters: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting characters: %w", err))
 		return
 	}
 
 	// Convert characters to JSON and send it in the response
-	responseJSON, err := json.Marshal(characters)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding characters to JSON: %s", err), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	writeJSON(w, r, http.StatusOK, characters)
 }
 
 // Implement this method to retrieve all characters from the database
@@ -48,7 +39,6 @@ func (cc *CharacterController) getAllCharacters() ([]Character, error) {
 	// Example:
 	rows, err := cc.db.Query("SELECT * FROM characters")
 	if err != nil {
-		log.Printf("Error querying all characters: %s", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -57,7 +47,7 @@ func (cc *CharacterController) getAllCharacters() ([]Character, error) {
 
 	for rows.Next() {
 		var character Character
-		err := rows.Scan(&character.ID, &character.Name, &character.ImageLink, &character.Affinity, &character.BaseLv, &character.HP, &character.HpGrowth, &character.Strength, &character.StrGrowth, &character.Magic, &character.MagGrowth, &character.Dexterity, &character.DexGrowth, &character.Speed, &character.SpdGrowth, &character.Luck, &character.LckGrowth, &character.Defence, &character.DefGrowth, &character.Resistance, &character.ResGrowth, &character.Charm, &character.ChaGrowth, &character.CreatedAt, &character.UpdatedAt)
+		err := rows.Scan(characterColumns(&character)...)
 		if err != nil {
 			return nil, err
 		}
@@ -67,33 +57,88 @@ func (cc *CharacterController) getAllCharacters() ([]Character, error) {
 	return characters, nil
 }
 
+// characterColumns returns the scan targets of a characters row in column
+// order, for queries selecting * or returning *
+func characterColumns(character *Character) []interface{} {
+	return []interface{}{&character.ID, &character.Name, &character.ImageLink, &character.Affinity,
+		&character.BaseLv, &character.HP, &character.HpGrowth, &character.Strength, &character.StrGrowth,
+		&character.Magic, &character.MagGrowth, &character.Dexterity, &character.DexGrowth,
+		&character.Speed, &character.SpdGrowth, &character.Luck, &character.LckGrowth,
+		&character.Defence, &character.DefGrowth, &character.Resistance, &character.ResGrowth,
+		&character.Charm, &character.ChaGrowth, &character.CreatedAt, &character.UpdatedAt,
+		&character.CrestID, &character.CrestStrength, (*IntArrayScanner)(&character.MaxStats)}
+}
+
 func (cc *CharacterController) GetOne(w http.ResponseWriter, r *http.Request) {
 	charID := mux.Vars(r)["charID"]
 	id, err := strconv.Atoi(charID)
 	if err != nil {
-		http.Error(w, "Invalid character ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid character ID"))
 		return
 	}
 
 	character, err := cc.getCharacterByID(id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting character: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting character: %w", err))
 		return
 	}
 
 	if character == nil {
-		http.Error(w, "Character not found", http.StatusNotFound)
+		writeError(w, r, NotFound("Character not found"))
 		return
 	}
 
-	responseJSON, err := json.Marshal(character)
+	if r.URL.Query().Get("caps") == "true" {
+		cc.writeWithCaps(w, r, character)
+		return
+	}
+
+	if writeNotModified(w, r, etagFor(character.ID, character.UpdatedAt)) {
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, character)
+}
+
+// CharacterWithCaps is the body of GET /characters/{charID}?caps=true
+type CharacterWithCaps struct {
+	Character
+	StatCaps StatCaps `json:"stat_caps"`
+}
+
+// writeWithCaps checks the base stats of the character against its caps
+// and, when class_id is given, those of the class
+func (cc *CharacterController) writeWithCaps(w http.ResponseWriter, r *http.Request, character *Character) {
+	classID, err := queryID(r, "class_id")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding character to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	// The caps depend on the class too, so its version is part of the tag
+	etag := etagWith(etagFor(character.ID, character.UpdatedAt), "caps")
+	var classCaps []int
+	if classID != nil {
+		class, err := NewClassController(cc.db).getClassByID(*classID)
+		if err != nil {
+			writeError(w, r, fmt.Errorf("error getting class: %w", err))
+			return
+		}
+		if class == nil {
+			writeError(w, r, NotFound("Class not found"))
+			return
+		}
+		classCaps = class.MaxStats
+		etag = etagWith(etag, strings.Trim(etagFor(class.ID, class.UpdatedAt), `"`))
+	}
+
+	if writeNotModified(w, r, etag) {
+		return
+	}
+
+	body := CharacterWithCaps{Character: *character,
+		StatCaps: applyCaps(characterStats(character), character.MaxStats, classCaps)}
+	writeJSON(w, r, http.StatusOK, body)
 }
 
 func (cc *CharacterController) getCharacterByID(id int) (*Character, error) {
@@ -102,7 +147,7 @@ func (cc *CharacterController) getCharacterByID(id int) (*Character, error) {
 	row := cc.db.QueryRow("SELECT * FROM characters WHERE id = $1", id)
 
 	var character Character
-	err := row.Scan(&character.ID, &character.Name, &character.ImageLink, &character.Affinity, &character.BaseLv, &character.HP, &character.HpGrowth, &character.Strength, &character.StrGrowth, &character.Magic, &character.MagGrowth, &character.Dexterity, &character.DexGrowth, &character.Speed, &character.SpdGrowth, &character.Luck, &character.LckGrowth, &character.Defence, &character.DefGrowth, &character.Resistance, &character.ResGrowth, &character.Charm, &character.ChaGrowth, &character.CreatedAt, &character.UpdatedAt)
+	err := row.Scan(characterColumns(&character)...)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	} else if err != nil {
@@ -116,29 +161,22 @@ func (cc *CharacterController) GetByAffinity(w http.ResponseWriter, r *http.Requ
 	affinity := mux.Vars(r)["affinity"]
 	// aff, err := strconv.Atoi(affinity)
 	// if err != nil {
-	// 	http.Error(w, "Invalid character affinity", http.StatusBadRequest)
+	// 	writeError(w, r, BadRequest("Invalid character affinity"))
 	// 	return
 	// }
 
 	character, err := cc.getCharacterByAffinity(affinity)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting character: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting character: %w", err))
 		return
 	}
 
 	if character == nil {
-		http.Error(w, "Character not found", http.StatusNotFound)
+		writeError(w, r, NotFound("Character not found"))
 		return
 	}
 
-	responseJSON, err := json.Marshal(character)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding character to JSON: %s", err), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	writeJSON(w, r, http.StatusOK, character)
 }
 
 func (cc *CharacterController) getCharacterByAffinity(affinity string) ([]Character, error) {
@@ -146,7 +184,6 @@ func (cc *CharacterController) getCharacterByAffinity(affinity string) ([]Charac
 	// Example:
 	rows, err := cc.db.Query("SELECT * FROM characters WHERE affinity = $1", affinity)
 	if err != nil {
-		log.Printf("Error querying all characters: %s", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -155,7 +192,7 @@ func (cc *CharacterController) getCharacterByAffinity(affinity string) ([]Charac
 
 	for rows.Next() {
 		var character Character
-		err := rows.Scan(&character.ID, &character.Name, &character.ImageLink, &character.Affinity, &character.BaseLv, &character.HP, &character.HpGrowth, &character.Strength, &character.StrGrowth, &character.Magic, &character.MagGrowth, &character.Dexterity, &character.DexGrowth, &character.Speed, &character.SpdGrowth, &character.Luck, &character.LckGrowth, &character.Defence, &character.DefGrowth, &character.Resistance, &character.ResGrowth, &character.Charm, &character.ChaGrowth, &character.CreatedAt, &character.UpdatedAt)
+		err := rows.Scan(characterColumns(&character)...)
 		if err != nil {
 			return nil, err
 		}
@@ -169,23 +206,20 @@ func (cc *CharacterController) GetByName(w http.ResponseWriter, r *http.Request)
 
 	character, err := cc.getCharacterByName(charName)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting character: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting character: %w", err))
 		return
 	}
 
 	if character == nil {
-		http.Error(w, "Character not found", http.StatusNotFound)
+		writeError(w, r, NotFound("Character not found"))
 		return
 	}
 
-	responseJSON, err := json.Marshal(character)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding character to JSON: %s", err), http.StatusInternalServerError)
+	if writeNotModified(w, r, etagFor(character.ID, character.UpdatedAt)) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	writeJSON(w, r, http.StatusOK, character)
 }
 
 func (cc *CharacterController) getCharacterByName(name string) (*Character, error) {
@@ -195,7 +229,7 @@ func (cc *CharacterController) getCharacterByName(name string) (*Character, erro
 	row := cc.db.QueryRow("SELECT * FROM characters WHERE name = $1", name)
 
 	var character Character
-	err := row.Scan(&character.ID, &character.Name, &character.ImageLink, &character.Affinity, &character.BaseLv, &character.HP, &character.HpGrowth, &character.Strength, &character.StrGrowth, &character.Magic, &character.MagGrowth, &character.Dexterity, &character.DexGrowth, &character.Speed, &character.SpdGrowth, &character.Luck, &character.LckGrowth, &character.Defence, &character.DefGrowth, &character.Resistance, &character.ResGrowth, &character.Charm, &character.ChaGrowth, &character.CreatedAt, &character.UpdatedAt)
+	err := row.Scan(characterColumns(&character)...)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	} else if err != nil {
@@ -207,29 +241,29 @@ func (cc *CharacterController) getCharacterByName(name string) (*Character, erro
 
 func (cc *CharacterController) PostOne(w http.ResponseWriter, r *http.Request) {
 	var character Character
-	err := json.NewDecoder(r.Body).Decode(&character)
+	err := decodeJSON(r, &character)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error decoding request body: %s", err), http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
 		return
 	}
 
-	character.CreatedAt = time.Now()
-	character.UpdatedAt = time.Now()
-
-	err = cc.insertCharacter(&character)
+	err = character.Validate()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error inserting character: %s", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	responseJSON, err := json.Marshal(character)
+	character.CreatedAt = time.Now()
+	character.UpdatedAt = time.Now()
+
+	err = cc.insertCharacter(&character)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding character to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error inserting character: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	w.Header().Set("ETag", etagFor(character.ID, character.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, character)
 }
 
 func (cc *CharacterController) insertCharacter(character *Character) error {
@@ -238,16 +272,17 @@ func (cc *CharacterController) insertCharacter(character *Character) error {
 		INSERT INTO characters (name, image_link, affinity, base_lv, hp, hp_growth,
 			 strength, str_growth, magic, mag_growth, dexterity, dex_growth, speed, 
 			 spd_growth, luck, lck_growth, defence, def_growth, resistance, res_growth, 
-			 charm, cha_growth, created_at, updated_at)
+			 charm, cha_growth, crest_id, crest_strength, max_stats, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, 
-			$17, $18, $19, $20, $21, $22, $23, $24)
-		RETURNING id
+			$17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27)
+		RETURNING id, created_at, updated_at
 	`, character.Name, character.ImageLink, character.Affinity, character.BaseLv,
 		character.HP, character.HpGrowth, character.Strength, character.StrGrowth,
 		character.Magic, character.MagGrowth, character.Dexterity, character.DexGrowth,
 		character.Speed, character.SpdGrowth, character.Luck, character.LckGrowth,
 		character.Defence, character.DefGrowth, character.Resistance, character.ResGrowth,
-		character.Charm, character.ChaGrowth, character.CreatedAt, character.UpdatedAt).Scan(&character.ID)
+		character.Charm, character.ChaGrowth, character.CrestID, character.CrestStrength,
+		pq.Array(character.MaxStats), character.CreatedAt, character.UpdatedAt).Scan(&character.ID, &character.CreatedAt, &character.UpdatedAt)
 
 	if err != nil {
 		return err
@@ -260,145 +295,127 @@ func (cc *CharacterController) PutOne(w http.ResponseWriter, r *http.Request) {
 	charID := mux.Vars(r)["charID"]
 	id, err := strconv.Atoi(charID)
 	if err != nil {
-		http.Error(w, "Invalid character ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid character ID"))
 		return
 	}
 
 	var updatedCharacter Character
-	err = json.NewDecoder(r.Body).Decode(&updatedCharacter)
+	err = decodeJSON(r, &updatedCharacter)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error decoding request body: %s", err), http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
 		return
 	}
 
-	updatedCharacter.UpdatedAt = time.Now()
+	err = updatedCharacter.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	current, err := cc.getCharacterByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting character: %w", err))
+		return
+	}
 
-	err = cc.updateCharacter(id, &updatedCharacter)
+	if current == nil {
+		writeError(w, r, NotFound("Character not found"))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error updating character: %s", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	responseJSON, err := json.Marshal(updatedCharacter)
+	updatedCharacter.UpdatedAt = time.Now()
+
+	err = cc.updateCharacter(id, &updatedCharacter, current.UpdatedAt)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding updated character to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error updating character: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	w.Header().Set("ETag", etagFor(updatedCharacter.ID, updatedCharacter.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedCharacter)
 }
 
-func (cc *CharacterController) updateCharacter(id int, updatedCharacter *Character) error {
-	// Start building the SQL query
-	query := "UPDATE characters SET updated_at = $1"
-	args := []interface{}{updatedCharacter.UpdatedAt}
-
-	// Conditionally include fields in the update query
-	if updatedCharacter.Name != "" {
-		query += ", name = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.Name)
-	}
-	if updatedCharacter.Affinity != "" {
-		query += ", affinity = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.Affinity)
-	}
-	if updatedCharacter.ImageLink != "" {
-		query += ", image_link = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.ImageLink)
-	}
-	if updatedCharacter.BaseLv != 0 {
-		query += ", base_lv = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.BaseLv)
-	}
-	if updatedCharacter.HP != 0 {
-		query += ", hp = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.HP)
-	}
-	if updatedCharacter.HpGrowth != 0 {
-		query += ", hp_growth = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.HpGrowth)
-	}
-	if updatedCharacter.Strength != 0 {
-		query += ", strength = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.Strength)
-	}
-	if updatedCharacter.StrGrowth != 0 {
-		query += ", str_growth = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.StrGrowth)
-	}
-	if updatedCharacter.Magic != 0 {
-		query += ", magic = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.Magic)
-	}
-	if updatedCharacter.MagGrowth != 0 {
-		query += ", mag_growth = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.MagGrowth)
-	}
-	if updatedCharacter.Dexterity != 0 {
-		query += ", dexterity = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.Dexterity)
-	}
-	if updatedCharacter.DexGrowth != 0 {
-		query += ", dex_growth = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.DexGrowth)
-	}
-	if updatedCharacter.Speed != 0 {
-		query += ", speed = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.Speed)
-	}
-	if updatedCharacter.SpdGrowth != 0 {
-		query += ", spd_growth = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.SpdGrowth)
-	}
-	if updatedCharacter.Luck != 0 {
-		query += ", luck = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.Luck)
-	}
-	if updatedCharacter.LckGrowth != 0 {
-		query += ", lck_growth = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.LckGrowth)
-	}
-	if updatedCharacter.Defence != 0 {
-		query += ", defence = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.Defence)
-	}
-	if updatedCharacter.DefGrowth != 0 {
-		query += ", def_growth = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.DefGrowth)
-	}
-	if updatedCharacter.Resistance != 0 {
-		query += ", resistance = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.Resistance)
-	}
-	if updatedCharacter.ResGrowth != 0 {
-		query += ", res_growth = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.ResGrowth)
-	}
-	if updatedCharacter.Charm != 0 {
-		query += ", charm = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.Charm)
-	}
-	if updatedCharacter.ChaGrowth != 0 {
-		query += ", cha_growth = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedCharacter.ChaGrowth)
-	}
-
-	// Finish the query with the WHERE clause
-	query += " WHERE id = $" + strconv.Itoa(len(args)+1)
-	args = append(args, id)
-	err := cc.db.QueryRow(query+" RETURNING *", args...).Scan(
-		&updatedCharacter.ID, &updatedCharacter.Name, &updatedCharacter.ImageLink,
-		&updatedCharacter.Affinity, &updatedCharacter.BaseLv, &updatedCharacter.HP,
-		&updatedCharacter.HpGrowth, &updatedCharacter.Strength, &updatedCharacter.StrGrowth,
-		&updatedCharacter.Magic, &updatedCharacter.MagGrowth, &updatedCharacter.Dexterity,
-		&updatedCharacter.DexGrowth, &updatedCharacter.Speed, &updatedCharacter.SpdGrowth,
-		&updatedCharacter.Luck, &updatedCharacter.LckGrowth, &updatedCharacter.Defence,
-		&updatedCharacter.DefGrowth, &updatedCharacter.Resistance, &updatedCharacter.ResGrowth,
-		&updatedCharacter.Charm, &updatedCharacter.ChaGrowth, &updatedCharacter.CreatedAt,
-		&updatedCharacter.UpdatedAt)
+func (cc *CharacterController) PatchOne(w http.ResponseWriter, r *http.Request) {
+	charID := mux.Vars(r)["charID"]
+	id, err := strconv.Atoi(charID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid character ID"))
+		return
+	}
+
+	updatedCharacter, err := cc.getCharacterByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting character: %w", err))
+		return
+	}
+
+	if updatedCharacter == nil {
+		writeError(w, r, NotFound("Character not found"))
+		return
+	}
+
+	version := updatedCharacter.UpdatedAt
+	err = checkIfMatch(r, etagFor(updatedCharacter.ID, version))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = applyMergePatch(r, updatedCharacter)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = updatedCharacter.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedCharacter.UpdatedAt = time.Now()
 
+	err = cc.updateCharacter(id, updatedCharacter, version)
 	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating character: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedCharacter.ID, updatedCharacter.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedCharacter)
+}
+
+func (cc *CharacterController) updateCharacter(id int, updatedCharacter *Character, version time.Time) error {
+	// Every column is written so that PUT replaces the whole character. The row is
+	// only updated if it has not changed since version was read.
+	err := cc.db.QueryRow(`
+		UPDATE characters SET name = $1, image_link = $2, affinity = $3, base_lv = $4, hp = $5,
+			hp_growth = $6, strength = $7, str_growth = $8, magic = $9, mag_growth = $10,
+			dexterity = $11, dex_growth = $12, speed = $13, spd_growth = $14, luck = $15,
+			lck_growth = $16, defence = $17, def_growth = $18, resistance = $19, res_growth = $20,
+			charm = $21, cha_growth = $22, crest_id = $23, crest_strength = $24, max_stats = $25,
+			updated_at = $26
+		WHERE id = $27 AND updated_at = $28
+		RETURNING *
+	`, updatedCharacter.Name, updatedCharacter.ImageLink, updatedCharacter.Affinity,
+		updatedCharacter.BaseLv, updatedCharacter.HP, updatedCharacter.HpGrowth,
+		updatedCharacter.Strength, updatedCharacter.StrGrowth, updatedCharacter.Magic,
+		updatedCharacter.MagGrowth, updatedCharacter.Dexterity, updatedCharacter.DexGrowth,
+		updatedCharacter.Speed, updatedCharacter.SpdGrowth, updatedCharacter.Luck,
+		updatedCharacter.LckGrowth, updatedCharacter.Defence, updatedCharacter.DefGrowth,
+		updatedCharacter.Resistance, updatedCharacter.ResGrowth, updatedCharacter.Charm,
+		updatedCharacter.ChaGrowth, updatedCharacter.CrestID, updatedCharacter.CrestStrength,
+		pq.Array(updatedCharacter.MaxStats), updatedCharacter.UpdatedAt, id, version).Scan(characterColumns(updatedCharacter)...)
+
+	if err == sql.ErrNoRows {
+		return Conflict("Character with ID %d was modified or deleted by another request", id)
+	} else if err != nil {
 		return err
 	}
 
@@ -409,41 +426,51 @@ func (cc *CharacterController) DeleteOne(w http.ResponseWriter, r *http.Request)
 	charID := mux.Vars(r)["charID"]
 	id, err := strconv.Atoi(charID)
 	if err != nil {
-		http.Error(w, "invalid character ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid character ID"))
 		return
 	}
 
-	err = cc.deleteCharacter(id)
+	current, err := cc.getCharacterByID(id)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, fmt.Sprintf("Character with ID %d not found", id), http.StatusNotFound)
-		} else {
-			http.Error(w, fmt.Sprintf("Error deleting character: %s", err), http.StatusInternalServerError)
-		}
+		writeError(w, r, fmt.Errorf("error getting character: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"success": true, "msg": "Character deleted successfully."}`))
-}
+	if current == nil {
+		writeError(w, r, NotFound("Character with ID %d not found", id))
+		return
+	}
 
-func (cc *CharacterController) deleteCharacter(id int) error {
-	// Check if the character exists
-	var exists bool
-	err := cc.db.QueryRow("SELECT EXISTS (SELECT 1 FROM characters WHERE id = $1)", id).Scan(&exists)
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
 	if err != nil {
-		return err
+		writeError(w, r, err)
+		return
+	}
+
+	err = cc.deleteCharacter(id, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error deleting character: %w", err))
+		return
 	}
 
-	if !exists {
-		return fmt.Errorf("character with ID %d not found", id)
+	writeJSON(w, r, http.StatusOK, deleteResult{Success: true, Msg: "Character deleted successfully."})
+}
+
+func (cc *CharacterController) deleteCharacter(id int, version time.Time) error {
+	// Only delete the row if it has not changed since version was read
+	result, err := cc.db.Exec("DELETE FROM characters WHERE id = $1 AND updated_at = $2", id, version)
+	if err != nil {
+		return err
 	}
 
-	// Character exists, proceed with deletion
-	_, err = cc.db.Exec("DELETE FROM characters WHERE id = $1", id)
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if affected == 0 {
+		return Conflict("Character with ID %d was modified or deleted by another request", id)
+	}
+
 	return nil
 }
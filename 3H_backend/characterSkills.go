@@ -2,9 +2,7 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -56,20 +54,12 @@ func NewCharSkillsController(db *sql.DB) *CharSkillsController {
 func (cc *CharSkillsController) GetAll(w http.ResponseWriter, r *http.Request) {
 	lists, err := cc.getAllLists()
 	if err != nil {
-		log.Printf("Error querying all lists: %s", err)
-		http.Error(w, fmt.Sprintf("Error getting lists: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting lists: %w", err))
 		return
 	}
 
 	// Convert lists to JSON and send it in the response
-	responseJSON, err := json.Marshal(lists)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding lists to JSON: %s", err), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	writeJSON(w, r, http.StatusOK, lists)
 }
 
 // Implement this method to retrieve all lists from the database
@@ -78,7 +68,6 @@ func (cc *CharSkillsController) getAllLists() ([]CharSkill, error) {
 	// Example:
 	rows, err := cc.db.Query("SELECT * FROM character_skills")
 	if err != nil {
-		log.Printf("Error querying all lists: %s", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -103,29 +92,26 @@ func (cc *CharSkillsController) GetOneByID(w http.ResponseWriter, r *http.Reques
 	listID := mux.Vars(r)["listID"]
 	id, err := strconv.Atoi(listID)
 	if err != nil {
-		http.Error(w, "Invalid character ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid character ID"))
 		return
 	}
 
 	character, err := cc.getListByID(id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting list: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting list: %w", err))
 		return
 	}
 
 	if character == nil {
-		http.Error(w, "List not found", http.StatusNotFound)
+		writeError(w, r, NotFound("List not found"))
 		return
 	}
 
-	responseJSON, err := json.Marshal(character)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding character to JSON: %s", err), http.StatusInternalServerError)
+	if writeNotModified(w, r, etagFor(character.ID, character.UpdatedAt)) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	writeJSON(w, r, http.StatusOK, character)
 }
 
 func (cc *CharSkillsController) getListByID(id int) (*CharSkill, error) {
@@ -148,29 +134,26 @@ func (cc *CharSkillsController) GetOneByCharID(w http.ResponseWriter, r *http.Re
 	charID := mux.Vars(r)["charID"]
 	id, err := strconv.Atoi(charID)
 	if err != nil {
-		http.Error(w, "Invalid character ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid character ID"))
 		return
 	}
 
 	character, err := cc.getListByCharID(id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting character: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting character: %w", err))
 		return
 	}
 
 	if character == nil {
-		http.Error(w, "Character not found", http.StatusNotFound)
+		writeError(w, r, NotFound("Character not found"))
 		return
 	}
 
-	responseJSON, err := json.Marshal(character)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding character to JSON: %s", err), http.StatusInternalServerError)
+	if writeNotModified(w, r, etagFor(character.ID, character.UpdatedAt)) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	writeJSON(w, r, http.StatusOK, character)
 }
 
 func (cc *CharSkillsController) getListByCharID(id int) (*CharSkill, error) {
@@ -192,29 +175,29 @@ func (cc *CharSkillsController) getListByCharID(id int) (*CharSkill, error) {
 
 func (cc *CharSkillsController) PostOne(w http.ResponseWriter, r *http.Request) {
 	var list CharSkill
-	err := json.NewDecoder(r.Body).Decode(&list)
+	err := decodeJSON(r, &list)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error decoding request body: %s", err), http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
 		return
 	}
 
-	list.CreatedAt = time.Now()
-	list.UpdatedAt = time.Now()
-
-	err = cc.insertCharSkillList(&list)
+	err = list.Validate()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error inserting character skill list: %s", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	responseJSON, err := json.Marshal(list)
+	list.CreatedAt = time.Now()
+	list.UpdatedAt = time.Now()
+
+	err = cc.insertCharSkillList(&list)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding list to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error inserting character skill list: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	w.Header().Set("ETag", etagFor(list.ID, list.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, list)
 }
 
 func (cc *CharSkillsController) insertCharSkillList(list *CharSkill) error {
@@ -223,10 +206,10 @@ func (cc *CharSkillsController) insertCharSkillList(list *CharSkill) error {
 	err := cc.db.QueryRow(`
 		INSERT INTO character_skills (name, char_id, spell_list, ca_list, boons, banes, budding_talent, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id
+		RETURNING id, created_at, updated_at
 	`, list.Name, list.CharID, pq.Array(list.SpellList), pq.Array(list.CAList), pq.Array(list.Boons),
 		pq.Array(list.Banes), list.Budding, list.CreatedAt,
-		list.UpdatedAt).Scan(&list.ID)
+		list.UpdatedAt).Scan(&list.ID, &list.CreatedAt, &list.UpdatedAt)
 
 	if err != nil {
 		return err
@@ -239,84 +222,121 @@ func (cc *CharSkillsController) PutOne(w http.ResponseWriter, r *http.Request) {
 	listID := mux.Vars(r)["listID"]
 	id, err := strconv.Atoi(listID)
 	if err != nil {
-		http.Error(w, "Invalid list ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid list ID"))
 		return
 	}
 
 	var updatedList CharSkill
-	err = json.NewDecoder(r.Body).Decode(&updatedList)
+	err = decodeJSON(r, &updatedList)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
+		return
+	}
+
+	err = updatedList.Validate()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error decoding request body: %s", err), http.StatusBadRequest)
+		writeError(w, r, err)
+		return
+	}
+
+	current, err := cc.getListByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting list: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("List not found"))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
 	updatedList.UpdatedAt = time.Now()
 
-	err = cc.updateList(id, &updatedList)
+	err = cc.updateList(id, &updatedList, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating list: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedList.ID, updatedList.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedList)
+}
+
+func (cc *CharSkillsController) PatchOne(w http.ResponseWriter, r *http.Request) {
+	listID := mux.Vars(r)["listID"]
+	id, err := strconv.Atoi(listID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid list ID"))
+		return
+	}
+
+	updatedList, err := cc.getListByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting list: %w", err))
+		return
+	}
+
+	if updatedList == nil {
+		writeError(w, r, NotFound("List not found"))
+		return
+	}
+
+	version := updatedList.UpdatedAt
+	err = checkIfMatch(r, etagFor(updatedList.ID, version))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = applyMergePatch(r, updatedList)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = updatedList.Validate()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error updating list: %s", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	responseJSON, err := json.Marshal(updatedList)
+	updatedList.UpdatedAt = time.Now()
+
+	err = cc.updateList(id, updatedList, version)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding updated list to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error updating list: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	w.Header().Set("ETag", etagFor(updatedList.ID, updatedList.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedList)
 }
 
-func (cc *CharSkillsController) updateList(id int, updatedList *CharSkill) error {
-	// Start building the SQL query
-	query := "UPDATE character_skills SET updated_at = $1"
-	args := []interface{}{updatedList.UpdatedAt}
-
-	// Conditionally include fields in the update query
-	if updatedList.Name != "" {
-		query += ", name = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedList.Name)
-	}
-	if updatedList.CharID != 0 {
-		query += ", char_id = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedList.CharID)
-	}
-	if len(updatedList.SpellList) != 0 {
-		pqArray := pq.Array(updatedList.SpellList)
-		query += ", spell_list = $" + strconv.Itoa(len(args)+1)
-		args = append(args, pqArray)
-	}
-	if len(updatedList.CAList) != 0 {
-		pqArray := pq.Array(updatedList.CAList)
-		query += ", ca_list = $" + strconv.Itoa(len(args)+1)
-		args = append(args, pqArray)
-	}
-	if updatedList.Boons != nil {
-		pqArray := pq.Array(updatedList.Boons)
-		query += ", boons = $" + strconv.Itoa(len(args)+1)
-		args = append(args, pqArray)
-	}
-	if updatedList.Banes != nil {
-		pqArray := pq.Array(updatedList.Banes)
-		query += ", banes = $" + strconv.Itoa(len(args)+1)
-		args = append(args, pqArray)
-	}
-	if updatedList.Budding != nil {
-		query += ", budding_talent = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedList.Budding)
-	}
-
-	// Finish the query with the WHERE clause
-	query += " WHERE id = $" + strconv.Itoa(len(args)+1)
-	args = append(args, id)
-	err := cc.db.QueryRow(query+" RETURNING *", args...).Scan(
+func (cc *CharSkillsController) updateList(id int, updatedList *CharSkill, version time.Time) error {
+	// Every column is written so that PUT replaces the whole list. The row is
+	// only updated if it has not changed since version was read.
+	err := cc.db.QueryRow(`
+		UPDATE character_skills SET name = $1, char_id = $2, spell_list = $3, ca_list = $4,
+			boons = $5, banes = $6, budding_talent = $7, updated_at = $8
+		WHERE id = $9 AND updated_at = $10
+		RETURNING *
+	`, updatedList.Name, updatedList.CharID, pq.Array(updatedList.SpellList),
+		pq.Array(updatedList.CAList), pq.Array(updatedList.Boons), pq.Array(updatedList.Banes),
+		updatedList.Budding, updatedList.UpdatedAt, id, version).Scan(
 		&updatedList.ID, &updatedList.Name, &updatedList.CharID,
 		(*IntArrayScanner)(&updatedList.SpellList), (*IntArrayScanner)(&updatedList.CAList), (*IntArrayScanner)(&updatedList.Boons),
 		(*IntArrayScanner)(&updatedList.Banes), &updatedList.Budding, &updatedList.CreatedAt,
 		&updatedList.UpdatedAt)
 
-	if err != nil {
+	if err == sql.ErrNoRows {
+		return Conflict("List with ID %d was modified or deleted by another request", id)
+	} else if err != nil {
 		return err
 	}
 
@@ -327,41 +347,51 @@ func (cc *CharSkillsController) DeleteOne(w http.ResponseWriter, r *http.Request
 	listID := mux.Vars(r)["listID"]
 	id, err := strconv.Atoi(listID)
 	if err != nil {
-		http.Error(w, "Invalid list ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid list ID"))
 		return
 	}
 
-	err = cc.deleteList(id)
+	current, err := cc.getListByID(id)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, fmt.Sprintf("List with ID %d not found", id), http.StatusNotFound)
-		} else {
-			http.Error(w, fmt.Sprintf("Error deleting list: %s", err), http.StatusInternalServerError)
-		}
+		writeError(w, r, fmt.Errorf("error getting list: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"success": true, "msg": "Character deleted successfully."}`))
-}
+	if current == nil {
+		writeError(w, r, NotFound("List with ID %d not found", id))
+		return
+	}
 
-func (cc *CharSkillsController) deleteList(id int) error {
-	// Check if the character exists
-	var exists bool
-	err := cc.db.QueryRow("SELECT EXISTS (SELECT 1 FROM character_skills WHERE id = $1)", id).Scan(&exists)
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
 	if err != nil {
-		return err
+		writeError(w, r, err)
+		return
 	}
 
-	if !exists {
-		return fmt.Errorf("list with ID %d not found", id)
+	err = cc.deleteList(id, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error deleting list: %w", err))
+		return
 	}
 
-	// Character exists, proceed with deletion
-	_, err = cc.db.Exec("DELETE FROM character_skills WHERE id = $1", id)
+	writeJSON(w, r, http.StatusOK, deleteResult{Success: true, Msg: "Character deleted successfully."})
+}
+
+func (cc *CharSkillsController) deleteList(id int, version time.Time) error {
+	// Only delete the row if it has not changed since version was read
+	result, err := cc.db.Exec("DELETE FROM character_skills WHERE id = $1 AND updated_at = $2", id, version)
 	if err != nil {
 		return err
 	}
 
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return Conflict("List with ID %d was modified or deleted by another request", id)
+	}
+
 	return nil
 }
@@ -2,10 +2,10 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"log"
+	"hash/fnv"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -14,6 +14,13 @@ import (
 	"github.com/lib/pq"
 )
 
+// defaultMovement is the movement of the classes that do not set one
+const defaultMovement = 4
+
+// classAbilityIDs selects the AbilityIDs of a class: the abilities whose
+// class_id references it. It follows the columns of the classes table.
+const classAbilityIDs = "ARRAY(SELECT abilities.id FROM abilities WHERE abilities.class_id = classes.id ORDER BY abilities.id)"
+
 type ClassController struct {
 	db *sql.DB
 }
@@ -24,32 +31,30 @@ func NewClassController(db *sql.DB) *ClassController {
 	}
 }
 
+// GetAll lists the classes, narrowed down by the rank, unit_type,
+// proficiency, ability_id, gender and char_id query parameters when present
 func (cc *ClassController) GetAll(w http.ResponseWriter, r *http.Request) {
-	classes, err := cc.getAllClass()
+	filter, err := parseClassFilter(r)
 	if err != nil {
-		log.Printf("Error querying all classes: %s", err)
-		http.Error(w, fmt.Sprintf("Error getting classes: %s", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	// Convert characters to JSON and send it in the response
-	responseJSON, err := json.Marshal(classes)
+	classes, err := cc.getAllClass(filter)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding classes to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting classes: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	// Convert characters to JSON and send it in the response
+	writeJSON(w, r, http.StatusOK, classes)
 }
 
 // Implement this method to retrieve all characters from the database
-func (cc *ClassController) getAllClass() ([]Classes, error) {
-	// Implement the logic to fetch all characters from the database
-	// Example:
-	rows, err := cc.db.Query("SELECT * FROM classes")
+func (cc *ClassController) getAllClass(filter classFilter) ([]Classes, error) {
+	query, args := filter.where()
+	rows, err := cc.db.Query("SELECT *, "+classAbilityIDs+" FROM classes"+query+" ORDER BY id", args...)
 	if err != nil {
-		log.Printf("Error querying all classes: %s", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -58,8 +63,7 @@ func (cc *ClassController) getAllClass() ([]Classes, error) {
 
 	for rows.Next() {
 		var class Classes
-		err := rows.Scan(&class.ID, &class.Name, &class.Rank, (*IntArrayScanner)(&class.Base), (*IntArrayScanner)(&class.Bonus),
-			(*IntArrayScanner)(&class.Growth), &class.CreatedAt, &class.UpdatedAt)
+		err := rows.Scan(classColumns(&class)...)
 		if err != nil {
 			return nil, err
 		}
@@ -69,43 +73,202 @@ func (cc *ClassController) getAllClass() ([]Classes, error) {
 	return classes, nil
 }
 
+// classETag also covers the AbilityIDs, which change when an ability is
+// moved to or from the class without the classes row being written
+func classETag(class *Classes) string {
+	hash := fnv.New32a()
+	for _, id := range class.AbilityIDs {
+		fmt.Fprintf(hash, "%d,", id)
+	}
+	return etagWith(etagFor(class.ID, class.UpdatedAt), fmt.Sprintf("%x", hash.Sum32()))
+}
+
+// classColumns returns the scan targets of a classes row in column order,
+// followed by classAbilityIDs
+func classColumns(class *Classes) []interface{} {
+	return []interface{}{&class.ID, &class.Name, &class.Rank, (*IntArrayScanner)(&class.Base),
+		(*IntArrayScanner)(&class.Bonus), (*IntArrayScanner)(&class.Growth), &class.CreatedAt,
+		&class.UpdatedAt, &class.MasteryAbilityID, &class.MasteryArtID, &class.MasteryExp,
+		&class.Movement, pq.Array(&class.UnitTypes), (*IntArrayScanner)(&class.Proficiencies),
+		(*IntArrayScanner)(&class.ExclusiveCharIDs), jsonColumn{&class.Requirements},
+		(*IntArrayScanner)(&class.MaxStats), (*IntArrayScanner)(&class.AbilityIDs)}
+}
+
+// classFilter narrows down getAllClass; zero fields match every class
+type classFilter struct {
+	rank          string
+	unitTypes     []string
+	proficiencies []int
+	abilityID     *int
+	gender        string
+	charID        *int
+}
+
+func parseClassFilter(r *http.Request) (classFilter, error) {
+	query := r.URL.Query()
+	filter := classFilter{rank: query.Get("rank"), unitTypes: query["unit_type"], gender: query.Get("gender")}
+
+	if filter.rank != "" && !slices.Contains(validClassRanks, filter.rank) {
+		return filter, BadRequest("Unknown class rank %q", filter.rank)
+	}
+	for _, unitType := range filter.unitTypes {
+		if !slices.Contains(validClassTypes, unitType) {
+			return filter, BadRequest("Unknown unit type %q", unitType)
+		}
+	}
+	if filter.gender != "" && filter.gender != "female" && filter.gender != "male" {
+		return filter, BadRequest("gender must be female or male")
+	}
+	for _, value := range query["proficiency"] {
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			return filter, BadRequest("Invalid proficiency")
+		}
+		filter.proficiencies = append(filter.proficiencies, id)
+	}
+
+	var err error
+	filter.abilityID, err = queryID(r, "ability_id")
+	if err != nil {
+		return filter, err
+	}
+	filter.charID, err = queryID(r, "char_id")
+	return filter, err
+}
+
+// where returns the WHERE clause of the filter and its arguments. A gender
+// excludes the classes restricted to the other one; a character excludes
+// the classes exclusive to other characters.
+func (f classFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.rank != "" {
+		add("rank = $%d", f.rank)
+	}
+	if len(f.unitTypes) > 0 {
+		add("unit_types @> $%d", pq.Array(f.unitTypes))
+	}
+	if len(f.proficiencies) > 0 {
+		add("proficiencies @> $%d", pq.Array(f.proficiencies))
+	}
+	if f.abilityID != nil {
+		// The abilities of a class are those whose class_id references it
+		add("id IN (SELECT class_id FROM abilities WHERE id = $%d)", *f.abilityID)
+	}
+	if f.gender == "female" {
+		add("NOT COALESCE(unit_types, '{}') @> $%d", pq.Array([]string{"male-only"}))
+	}
+	if f.gender == "male" {
+		add("NOT COALESCE(unit_types, '{}') @> $%d", pq.Array([]string{"female-only"}))
+	}
+	if f.charID != nil {
+		add("(COALESCE(cardinality(exclusive_char_ids), 0) = 0 OR $%d = ANY (exclusive_char_ids))", *f.charID)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// validate checks the class and that the skills, characters and skill
+// requirements it lists exist, as its ID arrays have no foreign keys
+func (cc *ClassController) validate(class *Classes) error {
+	err := class.Validate()
+	if err != nil {
+		return err
+	}
+
+	var requirementSkills []int
+	for _, requirement := range class.Requirements {
+		requirementSkills = append(requirementSkills, requirement.SkillID)
+	}
+
+	var errs ValidationErrors
+	for _, references := range []struct {
+		field, table string
+		ids          []int
+	}{
+		{"proficiencies", "skills", class.Proficiencies},
+		{"exclusive_char_ids", "characters", class.ExclusiveCharIDs},
+		{"requirements", "skills", requirementSkills},
+	} {
+		missing, err := cc.missingIDs(references.table, references.ids)
+		if err != nil {
+			return fmt.Errorf("error checking %s: %w", references.field, err)
+		}
+		if len(missing) > 0 {
+			errs = append(errs, FieldError{Field: references.field,
+				Message: fmt.Sprintf("references missing %s %v", references.table, missing)})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// missingIDs returns the IDs that are not in table
+func (cc *ClassController) missingIDs(table string, ids []int) ([]int, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var found []int
+	err := cc.db.QueryRow("SELECT array_agg(id) FROM "+table+" WHERE id = ANY ($1)",
+		pq.Array(ids)).Scan((*IntArrayScanner)(&found))
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []int
+	for _, id := range ids {
+		if !slices.Contains(found, id) && !slices.Contains(missing, id) {
+			missing = append(missing, id)
+		}
+	}
+	return missing, nil
+}
+
 func (cc *ClassController) GetOne(w http.ResponseWriter, r *http.Request) {
 	classID := mux.Vars(r)["classID"]
 	id, err := strconv.Atoi(classID)
 	if err != nil {
-		http.Error(w, "Invalid class ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid class ID"))
 		return
 	}
 
 	class, err := cc.getClassByID(id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting class: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting class: %w", err))
 		return
 	}
 
 	if class == nil {
-		http.Error(w, "Class not found", http.StatusNotFound)
+		writeError(w, r, NotFound("Class not found"))
 		return
 	}
 
-	responseJSON, err := json.Marshal(class)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding class to JSON: %s", err), http.StatusInternalServerError)
+	if writeNotModified(w, r, classETag(class)) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	writeJSON(w, r, http.StatusOK, class)
 }
 
 func (cc *ClassController) getClassByID(id int) (*Classes, error) {
 	// Implement the logic to fetch a character by ID from the database
 	// Example:
-	row := cc.db.QueryRow("SELECT * FROM classes WHERE id = $1", id)
+	row := cc.db.QueryRow("SELECT *, "+classAbilityIDs+" FROM classes WHERE id = $1", id)
 
 	var class Classes
-	err := row.Scan(&class.ID, &class.Name, &class.Rank, (*IntArrayScanner)(&class.Base),
-		(*IntArrayScanner)(&class.Bonus), (*IntArrayScanner)(&class.Growth), &class.CreatedAt, &class.UpdatedAt)
+	err := row.Scan(classColumns(&class)...)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	} else if err != nil {
@@ -117,45 +280,56 @@ func (cc *ClassController) getClassByID(id int) (*Classes, error) {
 
 func (cc *ClassController) PostOne(w http.ResponseWriter, r *http.Request) {
 	var class Classes
-	err := json.NewDecoder(r.Body).Decode(&class)
+	err := decodeJSON(r, &class)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error decoding request body: %s", err), http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
 		return
 	}
 
-	class.CreatedAt = time.Now()
-	class.UpdatedAt = time.Now()
-
-	err = cc.insertClass(&class)
+	err = cc.validate(&class)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error inserting class: %s", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	responseJSON, err := json.Marshal(class)
+	class.CreatedAt = time.Now()
+	class.UpdatedAt = time.Now()
+
+	err = cc.insertClass(&class)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding class to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error inserting class: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	w.Header().Set("ETag", classETag(&class))
+	writeJSON(w, r, http.StatusOK, class)
 }
 
 func (cc *ClassController) insertClass(class *Classes) error {
+	if class.Movement == 0 {
+		class.Movement = defaultMovement
+	}
+
 	// Perform the insert operation with the RETURNING clause to get the ID
 
 	err := cc.db.QueryRow(`
-		INSERT INTO classes (name, rank, base, bonus, growth, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id
+		INSERT INTO classes (name, rank, base, bonus, growth, mastery_ability_id, mastery_art_id,
+			mastery_exp, movement, unit_types, proficiencies, exclusive_char_ids, requirements,
+			max_stats, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		RETURNING id, created_at, updated_at
 	`, class.Name, class.Rank, pq.Array(class.Base), pq.Array(class.Bonus), pq.Array(class.Growth),
-		class.CreatedAt, class.UpdatedAt).Scan(&class.ID)
+		class.MasteryAbilityID, class.MasteryArtID, class.MasteryExp, class.Movement,
+		pq.Array(class.UnitTypes), pq.Array(class.Proficiencies), pq.Array(class.ExclusiveCharIDs),
+		jsonColumn{class.Requirements}, pq.Array(class.MaxStats), class.CreatedAt,
+		class.UpdatedAt).Scan(&class.ID, &class.CreatedAt, &class.UpdatedAt)
 
 	if err != nil {
 		return err
 	}
 
+	// No ability references a class that did not exist
+	class.AbilityIDs = []int{}
 	return nil
 }
 
@@ -163,75 +337,127 @@ func (cc *ClassController) PutOne(w http.ResponseWriter, r *http.Request) {
 	classID := mux.Vars(r)["classID"]
 	id, err := strconv.Atoi(classID)
 	if err != nil {
-		http.Error(w, "Invalid class ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid class ID"))
 		return
 	}
 
 	var updatedClass Classes
-	err = json.NewDecoder(r.Body).Decode(&updatedClass)
+	err = decodeJSON(r, &updatedClass)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error decoding request body: %s", err), http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
 		return
 	}
 
-	updatedClass.UpdatedAt = time.Now()
+	err = cc.validate(&updatedClass)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	current, err := cc.getClassByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting class: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Class not found"))
+		return
+	}
 
-	err = cc.updateClass(id, &updatedClass)
+	err = checkIfMatch(r, classETag(current))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error updating class: %s", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	responseJSON, err := json.Marshal(updatedClass)
+	updatedClass.UpdatedAt = time.Now()
+
+	err = cc.updateClass(id, &updatedClass, current.UpdatedAt)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding updated class to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error updating class: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	w.Header().Set("ETag", classETag(&updatedClass))
+	writeJSON(w, r, http.StatusOK, updatedClass)
 }
 
-func (cc *ClassController) updateClass(id int, updatedClass *Classes) error {
-	// Start building the SQL query
-	query := "UPDATE classes SET updated_at = $1"
-	args := []interface{}{updatedClass.UpdatedAt}
-
-	// Conditionally include fields in the update query
-	if updatedClass.Name != "" {
-		query += ", name = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedClass.Name)
-	}
-	if updatedClass.Rank != "" {
-		query += ", rank = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedClass.Rank)
-	}
-	if len(updatedClass.Base) != 0 {
-		pqArray := pq.Array(updatedClass.Base)
-		query += ", base = $" + strconv.Itoa(len(args)+1)
-		args = append(args, pqArray)
-	}
-	if len(updatedClass.Bonus) != 0 {
-		pqArray := pq.Array(updatedClass.Bonus)
-		query += ", bonus = $" + strconv.Itoa(len(args)+1)
-		args = append(args, pqArray)
-	}
-	if updatedClass.Growth != nil {
-		pqArray := pq.Array(updatedClass.Growth)
-		query += ", growth = $" + strconv.Itoa(len(args)+1)
-		args = append(args, pqArray)
-	}
-
-	// Finish the query with the WHERE clause
-	query += " WHERE id = $" + strconv.Itoa(len(args)+1)
-	args = append(args, id)
-	err := cc.db.QueryRow(query+" RETURNING *", args...).Scan(
-		&updatedClass.ID, &updatedClass.Name, &updatedClass.Rank,
-		(*IntArrayScanner)(&updatedClass.Base), (*IntArrayScanner)(&updatedClass.Bonus),
-		(*IntArrayScanner)(&updatedClass.Growth), &updatedClass.CreatedAt,
-		&updatedClass.UpdatedAt)
+func (cc *ClassController) PatchOne(w http.ResponseWriter, r *http.Request) {
+	classID := mux.Vars(r)["classID"]
+	id, err := strconv.Atoi(classID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid class ID"))
+		return
+	}
+
+	updatedClass, err := cc.getClassByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting class: %w", err))
+		return
+	}
+
+	if updatedClass == nil {
+		writeError(w, r, NotFound("Class not found"))
+		return
+	}
+
+	version := updatedClass.UpdatedAt
+	err = checkIfMatch(r, classETag(updatedClass))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = applyMergePatch(r, updatedClass)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 
+	err = cc.validate(updatedClass)
 	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedClass.UpdatedAt = time.Now()
+
+	err = cc.updateClass(id, updatedClass, version)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating class: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", classETag(updatedClass))
+	writeJSON(w, r, http.StatusOK, updatedClass)
+}
+
+func (cc *ClassController) updateClass(id int, updatedClass *Classes, version time.Time) error {
+	if updatedClass.Movement == 0 {
+		updatedClass.Movement = defaultMovement
+	}
+
+	// Every column is written so that PUT replaces the whole class. The row is
+	// only updated if it has not changed since version was read.
+	err := cc.db.QueryRow(`
+		UPDATE classes SET name = $1, rank = $2, base = $3, bonus = $4, growth = $5,
+			mastery_ability_id = $6, mastery_art_id = $7, mastery_exp = $8, movement = $9,
+			unit_types = $10, proficiencies = $11, exclusive_char_ids = $12, requirements = $13,
+			max_stats = $14, updated_at = $15
+		WHERE id = $16 AND updated_at = $17
+		RETURNING *, `+classAbilityIDs+`
+	`, updatedClass.Name, updatedClass.Rank, pq.Array(updatedClass.Base),
+		pq.Array(updatedClass.Bonus), pq.Array(updatedClass.Growth), updatedClass.MasteryAbilityID,
+		updatedClass.MasteryArtID, updatedClass.MasteryExp, updatedClass.Movement,
+		pq.Array(updatedClass.UnitTypes), pq.Array(updatedClass.Proficiencies),
+		pq.Array(updatedClass.ExclusiveCharIDs), jsonColumn{updatedClass.Requirements}, pq.Array(updatedClass.MaxStats), updatedClass.UpdatedAt,
+		id, version).Scan(
+		classColumns(updatedClass)...)
+
+	if err == sql.ErrNoRows {
+		return Conflict("Class with ID %d was modified or deleted by another request", id)
+	} else if err != nil {
 		return err
 	}
 
@@ -239,44 +465,54 @@ func (cc *ClassController) updateClass(id int, updatedClass *Classes) error {
 }
 
 func (cc *ClassController) DeleteOne(w http.ResponseWriter, r *http.Request) {
-	charID := mux.Vars(r)["charID"]
-	id, err := strconv.Atoi(charID)
+	classID := mux.Vars(r)["classID"]
+	id, err := strconv.Atoi(classID)
 	if err != nil {
-		http.Error(w, "invalid character ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid class ID"))
 		return
 	}
 
-	err = cc.deleteClass(id)
+	current, err := cc.getClassByID(id)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, fmt.Sprintf("Class with ID %d not found", id), http.StatusNotFound)
-		} else {
-			http.Error(w, fmt.Sprintf("Error deleting character: %s", err), http.StatusInternalServerError)
-		}
+		writeError(w, r, fmt.Errorf("error getting class: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"success": true, "msg": "Class deleted successfully."}`))
-}
+	if current == nil {
+		writeError(w, r, NotFound("Class with ID %d not found", id))
+		return
+	}
 
-func (cc *ClassController) deleteClass(id int) error {
-	// Check if the character exists
-	var exists bool
-	err := cc.db.QueryRow("SELECT EXISTS (SELECT 1 FROM characters WHERE id = $1)", id).Scan(&exists)
+	err = checkIfMatch(r, classETag(current))
 	if err != nil {
-		return err
+		writeError(w, r, err)
+		return
 	}
 
-	if !exists {
-		return fmt.Errorf("character with ID %d not found", id)
+	err = cc.deleteClass(id, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error deleting class: %w", err))
+		return
 	}
 
-	// Class exists, proceed with deletion
-	_, err = cc.db.Exec("DELETE FROM characters WHERE id = $1", id)
+	writeJSON(w, r, http.StatusOK, deleteResult{Success: true, Msg: "Class deleted successfully."})
+}
+
+func (cc *ClassController) deleteClass(id int, version time.Time) error {
+	// Only delete the row if it has not changed since version was read
+	result, err := cc.db.Exec("DELETE FROM classes WHERE id = $1 AND updated_at = $2", id, version)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if affected == 0 {
+		return Conflict("Class with ID %d was modified or deleted by another request", id)
+	}
+
 	return nil
 }
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// classTiers lists the ranks of the certification ladder, lowest first.
+// Unique classes cannot be certified into and have no edges.
+var classTiers = []string{"Starting", "Beginner", "Intermediate", "Advanced", "Master"}
+
+// ClassNode is a class of the progression graph
+type ClassNode struct {
+	ID           int                `json:"id"`
+	Name         string             `json:"name"`
+	Rank         string             `json:"rank"`
+	Requirements []ClassRequirement `json:"requirements"`
+}
+
+// ClassEdge is a certification from a class into one of the next tier.
+// Requirements are the skill ranks the exam of the target class asks for.
+type ClassEdge struct {
+	From         int                `json:"from"`
+	To           int                `json:"to"`
+	Requirements []ClassRequirement `json:"requirements"`
+}
+
+// ClassTree is the class progression as a directed graph
+type ClassTree struct {
+	Nodes []ClassNode `json:"nodes"`
+	Edges []ClassEdge `json:"edges"`
+}
+
+// ClassPath is a shortest certification path between two classes.
+// Requirements holds, for each skill, the highest rank asked for along it.
+type ClassPath struct {
+	From         int                `json:"from"`
+	To           int                `json:"to"`
+	Classes      []ClassNode        `json:"classes"`
+	Requirements []ClassRequirement `json:"requirements"`
+}
+
+// GetTree returns the class progression graph
+func (cc *ClassController) GetTree(w http.ResponseWriter, r *http.Request) {
+	classes, err := cc.getAllClass(classFilter{})
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting classes: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, classTree(classes))
+}
+
+// GetPath returns the shortest certification path between the classes given
+// by the from and to query parameters, each a class ID or name
+func (cc *ClassController) GetPath(w http.ResponseWriter, r *http.Request) {
+	classes, err := cc.getAllClass(classFilter{})
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting classes: %w", err))
+		return
+	}
+
+	from, err := findClass(classes, r.URL.Query().Get("from"), "from")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	to, err := findClass(classes, r.URL.Query().Get("to"), "to")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	path := classPath(classTree(classes), from.ID, to.ID)
+	if path == nil {
+		writeError(w, r, NotFound("No certification path from %s to %s", from.Name, to.Name))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, path)
+}
+
+// findClass looks a class up by ID or, case-insensitively, by name
+func findClass(classes []Classes, value, param string) (*Classes, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, BadRequest("%s is required", param)
+	}
+
+	id, err := strconv.Atoi(value)
+	for i := range classes {
+		if (err == nil && classes[i].ID == id) || strings.EqualFold(classes[i].Name, value) {
+			return &classes[i], nil
+		}
+	}
+	return nil, NotFound("Class %q not found", value)
+}
+
+// classTree links every class to the classes of the next tier whose exam
+// it prepares for: those sharing a required skill with it. Classes without
+// requirements, such as Commoner, can certify into any class of the next
+// tier, and any class into those of the next tier without requirements.
+func classTree(classes []Classes) ClassTree {
+	tree := ClassTree{Nodes: []ClassNode{}, Edges: []ClassEdge{}}
+	for _, class := range classes {
+		tree.Nodes = append(tree.Nodes, ClassNode{class.ID, class.Name, class.Rank, class.Requirements})
+	}
+	slices.SortFunc(tree.Nodes, func(a, b ClassNode) int { return a.ID - b.ID })
+
+	for _, from := range tree.Nodes {
+		tier := slices.Index(classTiers, from.Rank)
+		if tier < 0 || tier == len(classTiers)-1 {
+			continue
+		}
+		for _, to := range tree.Nodes {
+			if to.Rank == classTiers[tier+1] && sharesRequirement(from.Requirements, to.Requirements) {
+				tree.Edges = append(tree.Edges, ClassEdge{from.ID, to.ID, to.Requirements})
+			}
+		}
+	}
+	return tree
+}
+
+func sharesRequirement(a, b []ClassRequirement) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, x := range a {
+		for _, y := range b {
+			if x.SkillID == y.SkillID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// classPath searches the tree breadth first, so that the path found has the
+// fewest certifications. It returns nil when to cannot be reached.
+func classPath(tree ClassTree, from, to int) *ClassPath {
+	nodes := make(map[int]ClassNode, len(tree.Nodes))
+	for _, node := range tree.Nodes {
+		nodes[node.ID] = node
+	}
+
+	previous := map[int]int{from: from}
+	queue := []int{from}
+	for len(queue) > 0 && queue[0] != to {
+		current := queue[0]
+		queue = queue[1:]
+		for _, edge := range tree.Edges {
+			if _, seen := previous[edge.To]; edge.From == current && !seen {
+				previous[edge.To] = current
+				queue = append(queue, edge.To)
+			}
+		}
+	}
+	if _, reached := previous[to]; !reached {
+		return nil
+	}
+
+	path := &ClassPath{From: from, To: to}
+	for id := to; ; id = previous[id] {
+		path.Classes = append([]ClassNode{nodes[id]}, path.Classes...)
+		if id == from {
+			break
+		}
+	}
+
+	highest := map[int]string{}
+	var skills []int
+	for _, class := range path.Classes[1:] {
+		for _, requirement := range class.Requirements {
+			current, ok := highest[requirement.SkillID]
+			if !ok {
+				skills = append(skills, requirement.SkillID)
+			}
+			if !ok || slices.Index(validSkillRanks, requirement.Rank) > slices.Index(validSkillRanks, current) {
+				highest[requirement.SkillID] = requirement.Rank
+			}
+		}
+	}
+	path.Requirements = []ClassRequirement{}
+	for _, skill := range skills {
+		path.Requirements = append(path.Requirements, ClassRequirement{skill, highest[skill]})
+	}
+	return path
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testClasses is a small certification ladder: Commoner leads to both
+// beginner classes, Myrmidon to Mercenary by their shared sword requirement
+func testClasses() []Classes {
+	sword := ClassRequirement{SkillID: 1, Rank: "D"}
+	lance := ClassRequirement{SkillID: 2, Rank: "D"}
+	return []Classes{
+		{ID: 6, Name: "Swordmaster", Rank: "Advanced", Requirements: []ClassRequirement{{1, "A"}}},
+		{ID: 1, Name: "Commoner", Rank: "Starting"},
+		{ID: 2, Name: "Myrmidon", Rank: "Beginner", Requirements: []ClassRequirement{sword}},
+		{ID: 3, Name: "Soldier", Rank: "Beginner", Requirements: []ClassRequirement{lance}},
+		{ID: 4, Name: "Mercenary", Rank: "Intermediate", Requirements: []ClassRequirement{{1, "C"}}},
+		{ID: 5, Name: "Cavalier", Rank: "Intermediate", Requirements: []ClassRequirement{{2, "C"}, {3, "D"}}},
+		{ID: 7, Name: "Enlightened One", Rank: "Unique"},
+	}
+}
+
+func TestClassTree(t *testing.T) {
+	tree := classTree(testClasses())
+
+	var ids []int
+	for _, node := range tree.Nodes {
+		ids = append(ids, node.ID)
+	}
+	if want := []int{1, 2, 3, 4, 5, 6, 7}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("nodes %v, want %v", ids, want)
+	}
+
+	var edges [][2]int
+	for _, edge := range tree.Edges {
+		edges = append(edges, [2]int{edge.From, edge.To})
+	}
+	want := [][2]int{{1, 2}, {1, 3}, {2, 4}, {3, 5}, {4, 6}}
+	if !reflect.DeepEqual(edges, want) {
+		t.Errorf("edges %v, want %v", edges, want)
+	}
+}
+
+func TestClassPath(t *testing.T) {
+	tree := classTree(testClasses())
+
+	tests := []struct {
+		name         string
+		from, to     int
+		classes      []int
+		requirements []ClassRequirement
+	}{
+		{"same class", 2, 2, []int{2}, []ClassRequirement{}},
+		{"one certification", 1, 2, []int{1, 2}, []ClassRequirement{{1, "D"}}},
+		{"highest rank along the path", 1, 6, []int{1, 2, 4, 6}, []ClassRequirement{{1, "A"}}},
+		{"several skills", 1, 5, []int{1, 3, 5}, []ClassRequirement{{2, "C"}, {3, "D"}}},
+		{"unreachable", 2, 5, nil, nil},
+		{"downward", 4, 1, nil, nil},
+		{"unique class", 1, 7, nil, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := classPath(tree, test.from, test.to)
+			if test.classes == nil {
+				if path != nil {
+					t.Fatalf("classPath(%d, %d) = %+v, want nil", test.from, test.to, path)
+				}
+				return
+			}
+			if path == nil {
+				t.Fatalf("classPath(%d, %d) = nil", test.from, test.to)
+			}
+
+			var ids []int
+			for _, class := range path.Classes {
+				ids = append(ids, class.ID)
+			}
+			if !reflect.DeepEqual(ids, test.classes) {
+				t.Errorf("classes %v, want %v", ids, test.classes)
+			}
+			if !reflect.DeepEqual(path.Requirements, test.requirements) {
+				t.Errorf("requirements %v, want %v", path.Requirements, test.requirements)
+			}
+		})
+	}
+}
+
+func TestFindClass(t *testing.T) {
+	classes := testClasses()
+
+	for _, value := range []string{"4", "mercenary", " Mercenary "} {
+		class, err := findClass(classes, value, "from")
+		if err != nil || class.ID != 4 {
+			t.Errorf("findClass(%q) = %v, %v; want Mercenary", value, class, err)
+		}
+	}
+	if _, err := findClass(classes, "", "from"); err == nil || err.(*APIError).Code != CodeBadRequest {
+		t.Errorf("findClass with no value: error %v, want a bad request", err)
+	}
+	if _, err := findClass(classes, "Lord", "from"); err == nil || err.(*APIError).Code != CodeNotFound {
+		t.Errorf("findClass(Lord): error %v, want not found", err)
+	}
+}
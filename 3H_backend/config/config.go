@@ -0,0 +1,434 @@
+// Package config loads the settings of the API server.
+//
+// Values are resolved in increasing order of precedence from the built-in
+// defaults, an optional YAML file, an optional .env file, the environment
+// and the command line flags. The .env file never overrides variables that
+// are already set in the environment.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the effective configuration of the server
+type Config struct {
+	Database  DatabaseConfig  `yaml:"database"`
+	Server    ServerConfig    `yaml:"server"`
+	Cache     CacheConfig     `yaml:"cache"`
+	CORS      CORSConfig      `yaml:"cors"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	API       APIConfig       `yaml:"api"`
+	LogLevel  string          `yaml:"log_level"`
+
+	// PrintConfig asks the server to print the effective configuration and
+	// exit. It can only be set from the command line.
+	PrintConfig bool `yaml:"-"`
+}
+
+type DatabaseConfig struct {
+	// URL, when set, is used as the connection string and the individual
+	// connection fields below are ignored. SSLMode still applies when the URL
+	// has no sslmode parameter.
+	URL         string `yaml:"url"`
+	Host        string `yaml:"host"`
+	Port        int    `yaml:"port"`
+	User        string `yaml:"user"`
+	Password    string `yaml:"password"`
+	Name        string `yaml:"name"`
+	SSLMode     string `yaml:"ssl_mode"`
+	SSLRootCert string `yaml:"ssl_root_cert"`
+
+	MaxOpenConns    int      `yaml:"max_open_conns"`
+	MaxIdleConns    int      `yaml:"max_idle_conns"`
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime Duration `yaml:"conn_max_idle_time"`
+
+	ConnectAttempts   int      `yaml:"connect_attempts"`
+	ConnectBackoff    Duration `yaml:"connect_backoff"`
+	ConnectMaxBackoff Duration `yaml:"connect_max_backoff"`
+}
+
+type ServerConfig struct {
+	Port              int      `yaml:"port"`
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout"`
+	ReadTimeout       Duration `yaml:"read_timeout"`
+	WriteTimeout      Duration `yaml:"write_timeout"`
+	IdleTimeout       Duration `yaml:"idle_timeout"`
+	ShutdownTimeout   Duration `yaml:"shutdown_timeout"`
+}
+
+type CacheConfig struct {
+	TTL        Duration `yaml:"ttl"`
+	MaxAge     Duration `yaml:"max_age"`
+	MaxEntries int      `yaml:"max_entries"`
+}
+
+// CORSConfig holds one policy for the public read routes (GET and HEAD)
+// and one for the authenticated write routes
+type CORSConfig struct {
+	Read  CORSPolicy `yaml:"read"`
+	Write CORSPolicy `yaml:"write"`
+}
+
+type CORSPolicy struct {
+	AllowedOrigins   []string `yaml:"allowed_origins"`
+	AllowedMethods   []string `yaml:"allowed_methods"`
+	AllowedHeaders   []string `yaml:"allowed_headers"`
+	ExposedHeaders   []string `yaml:"exposed_headers"`
+	AllowCredentials bool     `yaml:"allow_credentials"`
+	MaxAge           Duration `yaml:"max_age"`
+}
+
+// RateLimitConfig sets the token buckets of the API routes. Clients sending
+// one of APIKeys are limited per key, everyone else per IP.
+type RateLimitConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	APIKeys []string `yaml:"api_keys"`
+	// TrustProxy takes the client IP from X-Forwarded-For, behind
+	// TrustedHops proxies that each append to the header. The client IP is
+	// the entry the outermost one appended, TrustedHops from the right;
+	// entries to its left are set by the client.
+	TrustProxy  bool            `yaml:"trust_proxy"`
+	TrustedHops int             `yaml:"trusted_hops"`
+	Read        RateLimitPolicy `yaml:"read"`
+	Write       RateLimitPolicy `yaml:"write"`
+}
+
+// RateLimitPolicy gives the sustained rate and the burst size of a bucket
+type RateLimitPolicy struct {
+	IPPerMinute  int `yaml:"ip_per_minute"`
+	IPBurst      int `yaml:"ip_burst"`
+	KeyPerMinute int `yaml:"key_per_minute"`
+	KeyBurst     int `yaml:"key_burst"`
+}
+
+// APIConfig controls the unversioned routes kept for clients written before
+// the /v1 prefix
+type APIConfig struct {
+	LegacyRoutes bool `yaml:"legacy_routes"`
+	// LegacySunset is the announced removal date of the legacy routes, as
+	// YYYY-MM-DD, sent in the Sunset header
+	LegacySunset string `yaml:"legacy_sunset"`
+}
+
+// LegacySunsetTime returns the removal date of the legacy routes, the zero
+// time when none has been announced
+func (api APIConfig) LegacySunsetTime() time.Time {
+	sunset, _ := time.Parse(time.DateOnly, api.LegacySunset)
+	return sunset
+}
+
+// Duration is a time.Duration written as "30s" or "5m" in the YAML file
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// sslModes are the values of sslmode understood by lib/pq
+var sslModes = []string{"disable", "require", "verify-ca", "verify-full"}
+
+// Default returns the configuration used when nothing is set
+func Default() *Config {
+	return &Config{
+		Database: DatabaseConfig{
+			Host:              "localhost",
+			Port:              5432,
+			SSLMode:           "disable",
+			MaxOpenConns:      25,
+			MaxIdleConns:      5,
+			ConnMaxLifetime:   Duration(30 * time.Minute),
+			ConnMaxIdleTime:   Duration(5 * time.Minute),
+			ConnectAttempts:   10,
+			ConnectBackoff:    Duration(500 * time.Millisecond),
+			ConnectMaxBackoff: Duration(15 * time.Second),
+		},
+		Server: ServerConfig{
+			Port:              2999,
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			ReadTimeout:       Duration(15 * time.Second),
+			WriteTimeout:      Duration(30 * time.Second),
+			IdleTimeout:       Duration(2 * time.Minute),
+			ShutdownTimeout:   Duration(20 * time.Second),
+		},
+		Cache: CacheConfig{
+			TTL:        Duration(5 * time.Minute),
+			MaxAge:     Duration(time.Minute),
+			MaxEntries: 1000,
+		},
+		CORS: CORSConfig{
+			Read: CORSPolicy{
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{"GET", "HEAD", "OPTIONS"},
+				AllowedHeaders: []string{"Content-Type", "If-None-Match", "X-Request-ID", "X-API-Key", "X-JSON-Shape"},
+				ExposedHeaders: []string{"ETag", "X-Request-ID", "X-Cache", "Retry-After",
+					"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Deprecation", "Sunset", "Link"},
+				MaxAge: Duration(10 * time.Minute),
+			},
+			Write: CORSPolicy{
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{"POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+				AllowedHeaders: []string{"Content-Type", "Authorization", "If-Match", "X-Request-ID", "X-API-Key", "X-JSON-Shape"},
+				ExposedHeaders: []string{"ETag", "X-Request-ID", "Retry-After",
+					"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Deprecation", "Sunset", "Link"},
+				MaxAge: Duration(10 * time.Minute),
+			},
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:     true,
+			TrustedHops: 1,
+			Read:        RateLimitPolicy{IPPerMinute: 120, IPBurst: 60, KeyPerMinute: 600, KeyBurst: 120},
+			Write:       RateLimitPolicy{IPPerMinute: 20, IPBurst: 10, KeyPerMinute: 120, KeyBurst: 30},
+		},
+		API: APIConfig{
+			LegacyRoutes: true,
+		},
+		LogLevel: "info",
+	}
+}
+
+// Load resolves the configuration from the command line arguments (without
+// the program name) and the environment, then validates it
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	fields := cfg.fields()
+
+	fs := flag.NewFlagSet("fe3h_backend", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML configuration file")
+	envFile := fs.String("env-file", ".env", "path to an optional .env file")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "print the effective configuration and exit")
+	flags := map[string]string{}
+	for _, f := range fields {
+		name := f.name
+		fs.Func(f.flag(), f.usage, func(value string) error {
+			flags[name] = value
+			return nil
+		})
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		err = cfg.loadFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Like godotenv.Load, the .env file does not override the environment
+	dotenv, err := godotenv.Read(*envFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error loading %s: %w", *envFile, err)
+	}
+	for key, value := range dotenv {
+		if _, ok := os.LookupEnv(key); !ok {
+			os.Setenv(key, value)
+		}
+	}
+
+	for _, f := range fields {
+		for _, key := range f.env {
+			value, ok := os.LookupEnv(key)
+			if !ok {
+				continue
+			}
+			if key != f.env[0] {
+				slog.Warn("Deprecated environment variable", slog.String("key", key), slog.String("use", f.env[0]))
+			}
+			err = f.set(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			break
+		}
+	}
+
+	for _, f := range fields {
+		if value, ok := flags[f.name]; ok {
+			err = f.set(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -%s: %w", f.flag(), err)
+			}
+		}
+	}
+
+	// USER used to set the database user, but it names the OS user in most
+	// shells, so it was renamed DB_USER rather than kept as an alias
+	if cfg.Database.URL == "" && cfg.Database.User == "" {
+		if _, ok := dotenv["USER"]; ok {
+			return nil, fmt.Errorf("database.user is required: USER in %s is no longer read, rename it to DB_USER", *envFile)
+		}
+		if _, ok := os.LookupEnv("USER"); ok {
+			return nil, errors.New("database.user is required: USER is no longer read, set DB_USER")
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func (cfg *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	err = decoder.Decode(cfg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks that the required values are present and consistent
+func (cfg *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	db := cfg.Database
+	if db.URL != "" {
+		u, err := url.Parse(db.URL)
+		check(err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql"),
+			"database.url must be a postgres:// URL")
+	} else {
+		check(db.Host != "", "database.host is required")
+		check(db.User != "", "database.user is required")
+		check(db.Name != "", "database.name is required")
+		check(db.Port > 0 && db.Port < 65536, "database.port must be between 1 and 65535")
+	}
+	check(contains(sslModes, db.SSLMode), "database.ssl_mode must be one of %s", strings.Join(sslModes, ", "))
+	check(db.MaxOpenConns >= 0, "database.max_open_conns must not be negative")
+	check(db.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+	check(db.MaxOpenConns == 0 || db.MaxIdleConns <= db.MaxOpenConns,
+		"database.max_idle_conns must not exceed database.max_open_conns")
+	check(db.ConnectAttempts >= 1, "database.connect_attempts must be at least 1")
+
+	check(cfg.Server.Port > 0 && cfg.Server.Port < 65536, "server.port must be between 1 and 65535")
+	check(cfg.Cache.MaxEntries >= 1, "cache.max_entries must be at least 1")
+
+	for _, cors := range []struct {
+		name   string
+		policy CORSPolicy
+	}{{"cors.read", cfg.CORS.Read}, {"cors.write", cfg.CORS.Write}} {
+		name, policy := cors.name, cors.policy
+		// Browsers reject credentialed responses that allow any origin
+		check(!policy.AllowCredentials || !contains(policy.AllowedOrigins, "*"),
+			"%s.allow_credentials cannot be used with the \"*\" origin", name)
+		check(len(policy.AllowedMethods) > 0, "%s.allowed_methods is required", name)
+	}
+
+	check(cfg.RateLimit.TrustedHops >= 1, "rate_limit.trusted_hops must be at least 1")
+	for _, limit := range []struct {
+		name   string
+		policy RateLimitPolicy
+	}{{"rate_limit.read", cfg.RateLimit.Read}, {"rate_limit.write", cfg.RateLimit.Write}} {
+		name, policy := limit.name, limit.policy
+		check(policy.IPPerMinute > 0 && policy.KeyPerMinute > 0, "%s rates must be positive", name)
+		check(policy.IPBurst >= 1 && policy.KeyBurst >= 1, "%s bursts must be at least 1", name)
+	}
+
+	if cfg.API.LegacySunset != "" {
+		_, err := time.Parse(time.DateOnly, cfg.API.LegacySunset)
+		check(err == nil, "api.legacy_sunset must be a date such as 2027-01-31")
+	}
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(cfg.LogLevel)) == nil, "log_level must be debug, info, warn or error")
+
+	return errors.Join(errs...)
+}
+
+// SlogLevel returns the configured log level
+func (cfg *Config) SlogLevel() slog.Level {
+	var level slog.Level
+	level.UnmarshalText([]byte(cfg.LogLevel))
+	return level
+}
+
+// DSN returns the connection string passed to lib/pq
+func (db DatabaseConfig) DSN() string {
+	if db.URL != "" {
+		u, err := url.Parse(db.URL)
+		if err != nil || u.Query().Has("sslmode") {
+			return db.URL
+		}
+		query := u.Query()
+		query.Set("sslmode", db.SSLMode)
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+
+	params := []string{
+		"host=" + quoteDSN(db.Host),
+		"port=" + strconv.Itoa(db.Port),
+		"user=" + quoteDSN(db.User),
+		"password=" + quoteDSN(db.Password),
+		"dbname=" + quoteDSN(db.Name),
+		"sslmode=" + quoteDSN(db.SSLMode),
+	}
+	if db.SSLRootCert != "" {
+		params = append(params, "sslrootcert="+quoteDSN(db.SSLRootCert))
+	}
+	return strings.Join(params, " ")
+}
+
+func quoteDSN(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+// Print writes the effective configuration with secrets redacted
+func (cfg *Config) Print(w io.Writer) {
+	for _, f := range cfg.fields() {
+		fmt.Fprintf(w, "%s = %s\n", f.name, f.display())
+	}
+}
+
+// LogValue lets the configuration be logged with slog, secrets redacted
+func (cfg *Config) LogValue() slog.Value {
+	fields := cfg.fields()
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		attrs = append(attrs, slog.String(f.name, f.display()))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// clearEnv unsets the variables for the duration of the test
+func clearEnv(t *testing.T, keys ...string) {
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := "database:\n  user: fodlan\n  name: fe3h\n  port: 5433\nserver:\n  port: 3000\n"
+
+	tests := []struct {
+		name   string
+		env    string // DB_PORT in the environment
+		dotenv string // content of the .env file
+		flags  []string
+		want   int
+	}{
+		{"file over default", "", "", nil, 5433},
+		{".env over file", "", "DB_PORT=5434\n", nil, 5434},
+		{"environment over .env", "5435", "DB_PORT=5434\n", nil, 5435},
+		{"flag over environment", "5435", "DB_PORT=5434\n", []string{"-database-port", "5436"}, 5436},
+		{"deprecated variable", "", "SQL_PORT=5437\n", nil, 5437},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clearEnv(t, "CONFIG_FILE", "DATABASE_URL", "DB_HOST", "HOST", "DB_USER", "DB_NAME", "DB_PORT", "SQL_PORT")
+			if test.env != "" {
+				t.Setenv("DB_PORT", test.env)
+			}
+
+			args := []string{"-config", writeFile(t, "config.yaml", yamlFile),
+				"-env-file", writeFile(t, ".env", test.dotenv)}
+			cfg, err := Load(append(args, test.flags...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cfg.Database.Port != test.want {
+				t.Errorf("database.port = %d, want %d", cfg.Database.Port, test.want)
+			}
+			// Settings no layer overrides keep their value
+			if cfg.Database.Host != "localhost" || cfg.Database.User != "fodlan" || cfg.Server.Port != 3000 {
+				t.Errorf("host %q, user %q, server port %d", cfg.Database.Host, cfg.Database.User, cfg.Server.Port)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	clearEnv(t, "CONFIG_FILE", "DATABASE_URL", "DB_HOST", "HOST", "DB_USER", "DB_NAME", "DB_PORT", "SQL_PORT")
+	noEnvFile := filepath.Join(t.TempDir(), "missing.env")
+
+	tests := []struct {
+		name string
+		yaml string
+		args []string
+	}{
+		{"unknown setting", "database:\n  usr: fodlan\n", nil},
+		{"invalid flag value", "database:\n  user: fodlan\n  name: fe3h\n", []string{"-database-port", "many"}},
+		{"missing required values", "database:\n  user: fodlan\n", nil},
+		{"no cache entries", "database:\n  user: fodlan\n  name: fe3h\ncache:\n  max_entries: 0\n", nil},
+		{"no trusted hops", "database:\n  user: fodlan\n  name: fe3h\nrate_limit:\n  trusted_hops: 0\n", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := append([]string{"-config", writeFile(t, "config.yaml", test.yaml), "-env-file", noEnvFile}, test.args...)
+			if _, err := Load(args); err == nil {
+				t.Errorf("Load succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestLoadRenamedUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string // USER in the environment
+		dotenv  string
+		wantErr string
+	}{
+		{"USER in .env", "", "USER=fodlan\nDB_NAME=fe3h\n", "USER in "},
+		{"USER in the environment", "fodlan", "DB_NAME=fe3h\n", "USER is no longer read"},
+		{"DB_USER next to USER", "fodlan", "USER=fodlan\nDB_USER=fodlan\nDB_NAME=fe3h\n", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clearEnv(t, "CONFIG_FILE", "DATABASE_URL", "DB_HOST", "HOST", "DB_USER", "USER", "DB_NAME", "DB_PORT", "SQL_PORT")
+			if test.env != "" {
+				t.Setenv("USER", test.env)
+			}
+
+			_, err := Load([]string{"-env-file", writeFile(t, ".env", test.dotenv)})
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) || !strings.Contains(err.Error(), "DB_USER") {
+				t.Errorf("Load error = %v, want one naming DB_USER", err)
+			}
+		})
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Database.URL = "postgres://fodlan:hunter2@db:5432/fe3h"
+	cfg.Database.Password = "hunter2"
+	cfg.RateLimit.APIKeys = []string{"key-1", "key-2"}
+
+	var out bytes.Buffer
+	cfg.Print(&out)
+	printed := out.String()
+
+	for _, secret := range []string{"hunter2", "key-1", "key-2"} {
+		if strings.Contains(printed, secret) {
+			t.Errorf("Print shows %q:\n%s", secret, printed)
+		}
+	}
+	for _, line := range []string{"database.password = REDACTED", "rate_limit.api_keys = REDACTED", "database.host = localhost"} {
+		if !strings.Contains(printed, line+"\n") {
+			t.Errorf("Print does not show %q:\n%s", line, printed)
+		}
+	}
+	if !strings.Contains(printed, "postgres://fodlan:xxxxx@db:5432/fe3h") {
+		t.Errorf("Print does not show the redacted URL:\n%s", printed)
+	}
+
+	// Empty secrets are shown as empty, so that a missing one can be spotted
+	cfg = Default()
+	out.Reset()
+	cfg.Print(&out)
+	if !strings.Contains(out.String(), "database.password = \n") {
+		t.Errorf("empty password not shown as empty:\n%s", out.String())
+	}
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// field binds one setting to its environment variables and command line
+// flag. The first environment variable is the canonical one; the others are
+// accepted for older .env files and logged as deprecated.
+type field struct {
+	name   string
+	env    []string
+	usage  string
+	secret bool
+	set    func(string) error
+	get    func() string
+}
+
+// flag derives the flag name from the setting name, database.max_open_conns
+// becoming -database-max-open-conns
+func (f field) flag() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(f.name)
+}
+
+func (f field) display() string {
+	value := f.get()
+	if f.secret && value != "" {
+		return "REDACTED"
+	}
+	return value
+}
+
+func (cfg *Config) fields() []field {
+	db := &cfg.Database
+	server := &cfg.Server
+	cache := &cfg.Cache
+
+	fields := []field{
+		{name: "database.url", env: []string{"DATABASE_URL"}, usage: "Postgres connection URL, overrides the other database connection settings",
+			set: stringSetter(&db.URL), get: redactedURL(&db.URL)},
+		// USER is deliberately not accepted: it is set by the shell to the
+		// name of the logged-in user
+		{name: "database.host", env: []string{"DB_HOST", "HOST"}, usage: "Postgres host",
+			set: stringSetter(&db.Host), get: stringGetter(&db.Host)},
+		{name: "database.port", env: []string{"DB_PORT", "SQL_PORT"}, usage: "Postgres port",
+			set: intSetter(&db.Port), get: intGetter(&db.Port)},
+		{name: "database.user", env: []string{"DB_USER"}, usage: "Postgres user",
+			set: stringSetter(&db.User), get: stringGetter(&db.User)},
+		{name: "database.password", env: []string{"DB_PASSWORD", "PASSWORD"}, usage: "Postgres password", secret: true,
+			set: stringSetter(&db.Password), get: stringGetter(&db.Password)},
+		{name: "database.name", env: []string{"DB_NAME", "DBNAME"}, usage: "Postgres database name",
+			set: stringSetter(&db.Name), get: stringGetter(&db.Name)},
+		{name: "database.ssl_mode", env: []string{"DB_SSLMODE"}, usage: "disable, require, verify-ca or verify-full",
+			set: stringSetter(&db.SSLMode), get: stringGetter(&db.SSLMode)},
+		{name: "database.ssl_root_cert", env: []string{"DB_SSLROOTCERT"}, usage: "CA certificate used by verify-ca and verify-full",
+			set: stringSetter(&db.SSLRootCert), get: stringGetter(&db.SSLRootCert)},
+		{name: "database.max_open_conns", env: []string{"DB_MAX_OPEN_CONNS"}, usage: "maximum open connections, 0 for no limit",
+			set: intSetter(&db.MaxOpenConns), get: intGetter(&db.MaxOpenConns)},
+		{name: "database.max_idle_conns", env: []string{"DB_MAX_IDLE_CONNS"}, usage: "maximum idle connections",
+			set: intSetter(&db.MaxIdleConns), get: intGetter(&db.MaxIdleConns)},
+		{name: "database.conn_max_lifetime", env: []string{"DB_CONN_MAX_LIFETIME"}, usage: "maximum lifetime of a connection",
+			set: durationSetter(&db.ConnMaxLifetime), get: durationGetter(&db.ConnMaxLifetime)},
+		{name: "database.conn_max_idle_time", env: []string{"DB_CONN_MAX_IDLE_TIME"}, usage: "maximum idle time of a connection",
+			set: durationSetter(&db.ConnMaxIdleTime), get: durationGetter(&db.ConnMaxIdleTime)},
+		{name: "database.connect_attempts", env: []string{"DB_CONNECT_ATTEMPTS"}, usage: "connection attempts at startup",
+			set: intSetter(&db.ConnectAttempts), get: intGetter(&db.ConnectAttempts)},
+		{name: "database.connect_backoff", env: []string{"DB_CONNECT_BACKOFF"}, usage: "initial delay between connection attempts",
+			set: durationSetter(&db.ConnectBackoff), get: durationGetter(&db.ConnectBackoff)},
+		{name: "database.connect_max_backoff", env: []string{"DB_CONNECT_MAX_BACKOFF"}, usage: "maximum delay between connection attempts",
+			set: durationSetter(&db.ConnectMaxBackoff), get: durationGetter(&db.ConnectMaxBackoff)},
+
+		{name: "server.port", env: []string{"BACKEND_PORT"}, usage: "HTTP port",
+			set: intSetter(&server.Port), get: intGetter(&server.Port)},
+		{name: "server.read_header_timeout", env: []string{"HTTP_READ_HEADER_TIMEOUT"}, usage: "time allowed to read the request headers",
+			set: durationSetter(&server.ReadHeaderTimeout), get: durationGetter(&server.ReadHeaderTimeout)},
+		{name: "server.read_timeout", env: []string{"HTTP_READ_TIMEOUT"}, usage: "time allowed to read the whole request",
+			set: durationSetter(&server.ReadTimeout), get: durationGetter(&server.ReadTimeout)},
+		{name: "server.write_timeout", env: []string{"HTTP_WRITE_TIMEOUT"}, usage: "time allowed to write the response",
+			set: durationSetter(&server.WriteTimeout), get: durationGetter(&server.WriteTimeout)},
+		{name: "server.idle_timeout", env: []string{"HTTP_IDLE_TIMEOUT"}, usage: "time an idle keep-alive connection is kept",
+			set: durationSetter(&server.IdleTimeout), get: durationGetter(&server.IdleTimeout)},
+		{name: "server.shutdown_timeout", env: []string{"SHUTDOWN_TIMEOUT"}, usage: "time allowed to drain requests on shutdown",
+			set: durationSetter(&server.ShutdownTimeout), get: durationGetter(&server.ShutdownTimeout)},
+
+		{name: "cache.ttl", env: []string{"CACHE_TTL"}, usage: "how long responses stay in the cache",
+			set: durationSetter(&cache.TTL), get: durationGetter(&cache.TTL)},
+		{name: "cache.max_age", env: []string{"CACHE_MAX_AGE"}, usage: "max-age sent to clients",
+			set: durationSetter(&cache.MaxAge), get: durationGetter(&cache.MaxAge)},
+		{name: "cache.max_entries", env: []string{"CACHE_MAX_ENTRIES"}, usage: "maximum number of cached responses",
+			set: intSetter(&cache.MaxEntries), get: intGetter(&cache.MaxEntries)},
+
+		{name: "log_level", env: []string{"LOG_LEVEL"}, usage: "debug, info, warn or error",
+			set: stringSetter(&cfg.LogLevel), get: stringGetter(&cfg.LogLevel)},
+	}
+
+	fields = append(fields, corsFields("read", &cfg.CORS.Read)...)
+	fields = append(fields, corsFields("write", &cfg.CORS.Write)...)
+
+	rateLimit := &cfg.RateLimit
+	fields = append(fields,
+		field{name: "rate_limit.enabled", env: []string{"RATE_LIMIT_ENABLED"}, usage: "limit the request rate of the API routes",
+			set: boolSetter(&rateLimit.Enabled), get: boolGetter(&rateLimit.Enabled)},
+		field{name: "rate_limit.api_keys", env: []string{"RATE_LIMIT_API_KEYS"}, usage: "comma-separated list of API keys limited per key", secret: true,
+			set: listSetter(&rateLimit.APIKeys), get: listGetter(&rateLimit.APIKeys)},
+		field{name: "rate_limit.trust_proxy", env: []string{"RATE_LIMIT_TRUST_PROXY"}, usage: "take the client IP from X-Forwarded-For",
+			set: boolSetter(&rateLimit.TrustProxy), get: boolGetter(&rateLimit.TrustProxy)},
+		field{name: "rate_limit.trusted_hops", env: []string{"RATE_LIMIT_TRUSTED_HOPS"}, usage: "number of proxies appending to X-Forwarded-For",
+			set: intSetter(&rateLimit.TrustedHops), get: intGetter(&rateLimit.TrustedHops)},
+	)
+	fields = append(fields, rateLimitFields("read", &rateLimit.Read)...)
+	fields = append(fields, rateLimitFields("write", &rateLimit.Write)...)
+
+	fields = append(fields,
+		field{name: "api.legacy_routes", env: []string{"API_LEGACY_ROUTES"}, usage: "also serve the routes without the /v1 prefix, marked deprecated",
+			set: boolSetter(&cfg.API.LegacyRoutes), get: boolGetter(&cfg.API.LegacyRoutes)},
+		field{name: "api.legacy_sunset", env: []string{"API_LEGACY_SUNSET"}, usage: "removal date of the unversioned routes, as YYYY-MM-DD",
+			set: stringSetter(&cfg.API.LegacySunset), get: stringGetter(&cfg.API.LegacySunset)},
+	)
+	return fields
+}
+
+func rateLimitFields(name string, policy *RateLimitPolicy) []field {
+	prefix := "rate_limit." + name + "."
+	env := "RATE_LIMIT_" + strings.ToUpper(name) + "_"
+
+	return []field{
+		{name: prefix + "ip_per_minute", env: []string{env + "IP_PER_MINUTE"}, usage: "sustained requests per minute per client IP",
+			set: intSetter(&policy.IPPerMinute), get: intGetter(&policy.IPPerMinute)},
+		{name: prefix + "ip_burst", env: []string{env + "IP_BURST"}, usage: "burst size per client IP",
+			set: intSetter(&policy.IPBurst), get: intGetter(&policy.IPBurst)},
+		{name: prefix + "key_per_minute", env: []string{env + "KEY_PER_MINUTE"}, usage: "sustained requests per minute per API key",
+			set: intSetter(&policy.KeyPerMinute), get: intGetter(&policy.KeyPerMinute)},
+		{name: prefix + "key_burst", env: []string{env + "KEY_BURST"}, usage: "burst size per API key",
+			set: intSetter(&policy.KeyBurst), get: intGetter(&policy.KeyBurst)},
+	}
+}
+
+func corsFields(name string, policy *CORSPolicy) []field {
+	prefix := "cors." + name + "."
+	env := "CORS_" + strings.ToUpper(name) + "_"
+
+	return []field{
+		{name: prefix + "allowed_origins", env: []string{env + "ALLOWED_ORIGINS"}, usage: "comma-separated list of allowed origins",
+			set: listSetter(&policy.AllowedOrigins), get: listGetter(&policy.AllowedOrigins)},
+		{name: prefix + "allowed_methods", env: []string{env + "ALLOWED_METHODS"}, usage: "comma-separated list of allowed methods",
+			set: listSetter(&policy.AllowedMethods), get: listGetter(&policy.AllowedMethods)},
+		{name: prefix + "allowed_headers", env: []string{env + "ALLOWED_HEADERS"}, usage: "comma-separated list of allowed request headers",
+			set: listSetter(&policy.AllowedHeaders), get: listGetter(&policy.AllowedHeaders)},
+		{name: prefix + "exposed_headers", env: []string{env + "EXPOSED_HEADERS"}, usage: "comma-separated list of response headers readable by scripts",
+			set: listSetter(&policy.ExposedHeaders), get: listGetter(&policy.ExposedHeaders)},
+		{name: prefix + "allow_credentials", env: []string{env + "ALLOW_CREDENTIALS"}, usage: "allow cookies and HTTP authentication",
+			set: boolSetter(&policy.AllowCredentials), get: boolGetter(&policy.AllowCredentials)},
+		{name: prefix + "max_age", env: []string{env + "MAX_AGE"}, usage: "how long browsers may cache a preflight response",
+			set: durationSetter(&policy.MaxAge), get: durationGetter(&policy.MaxAge)},
+	}
+}
+
+func stringSetter(p *string) func(string) error {
+	return func(value string) error {
+		*p = value
+		return nil
+	}
+}
+
+func stringGetter(p *string) func() string {
+	return func() string { return *p }
+}
+
+func intSetter(p *int) func(string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*p = n
+		return nil
+	}
+}
+
+func intGetter(p *int) func() string {
+	return func() string { return strconv.Itoa(*p) }
+}
+
+func durationSetter(p *Duration) func(string) error {
+	return func(value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*p = Duration(d)
+		return nil
+	}
+}
+
+func durationGetter(p *Duration) func() string {
+	return func() string { return p.String() }
+}
+
+func boolSetter(p *bool) func(string) error {
+	return func(value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*p = b
+		return nil
+	}
+}
+
+func boolGetter(p *bool) func() string {
+	return func() string { return strconv.FormatBool(*p) }
+}
+
+func listSetter(p *[]string) func(string) error {
+	return func(value string) error {
+		*p = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+		return nil
+	}
+}
+
+func listGetter(p *[]string) func() string {
+	return func() string { return strings.Join(*p, ",") }
+}
+
+// redactedURL hides the password of a connection URL
+func redactedURL(p *string) func() string {
+	return func() string {
+		u, err := url.Parse(*p)
+		if err != nil {
+			if *p == "" {
+				return ""
+			}
+			return "REDACTED"
+		}
+		return u.Redacted()
+	}
+}
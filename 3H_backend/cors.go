@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"fe3h_backend/config"
+
+	"github.com/rs/cors"
+)
+
+// corsPolicies applies the read policy to GET and HEAD requests and the
+// write policy to everything else. Preflight requests are matched on the
+// method they announce in Access-Control-Request-Method.
+type corsPolicies struct {
+	read  *cors.Cors
+	write *cors.Cors
+}
+
+func newCORSPolicies(cfg config.CORSConfig) *corsPolicies {
+	return &corsPolicies{
+		read:  newCORS(cfg.Read),
+		write: newCORS(cfg.Write),
+	}
+}
+
+func newCORS(policy config.CORSPolicy) *cors.Cors {
+	maxAge := int(time.Duration(policy.MaxAge).Seconds())
+	if maxAge == 0 {
+		maxAge = -1
+	}
+
+	return cors.New(cors.Options{
+		AllowedOrigins:   policy.AllowedOrigins,
+		AllowedMethods:   policy.AllowedMethods,
+		AllowedHeaders:   policy.AllowedHeaders,
+		ExposedHeaders:   policy.ExposedHeaders,
+		AllowCredentials: policy.AllowCredentials,
+		MaxAge:           maxAge,
+	})
+}
+
+func (cp *corsPolicies) Handler(next http.Handler) http.Handler {
+	read := cp.read.Handler(next)
+	write := cp.write.Handler(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := r.Method
+		if method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			method = r.Header.Get("Access-Control-Request-Method")
+		}
+
+		if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+			read.ServeHTTP(w, r)
+		} else {
+			write.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type CrestController struct {
+	db *sql.DB
+}
+
+func NewCrestController(db *sql.DB) *CrestController {
+	return &CrestController{
+		db: db,
+	}
+}
+
+func (cc *CrestController) GetAll(w http.ResponseWriter, r *http.Request) {
+	crests, err := cc.getAllCrests()
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting crests: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, crests)
+}
+
+func (cc *CrestController) getAllCrests() ([]Crest, error) {
+	rows, err := cc.db.Query("SELECT * FROM crests")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var crests []Crest
+
+	for rows.Next() {
+		var crest Crest
+		err := rows.Scan(crestColumns(&crest)...)
+		if err != nil {
+			return nil, err
+		}
+		crests = append(crests, crest)
+	}
+
+	return crests, nil
+}
+
+// crestColumns returns the scan targets of a crests row in column order
+func crestColumns(crest *Crest) []interface{} {
+	return []interface{}{&crest.ID, &crest.Name, &crest.ActivationEffect, &crest.Trigger,
+		&crest.EffectType, &crest.EffectValue, &crest.MajorRate, &crest.MinorRate,
+		&crest.Description, &crest.CreatedAt, &crest.UpdatedAt}
+}
+
+func (cc *CrestController) GetOne(w http.ResponseWriter, r *http.Request) {
+	crestID := mux.Vars(r)["crestID"]
+	id, err := strconv.Atoi(crestID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid crest ID"))
+		return
+	}
+
+	crest, err := cc.getCrestByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting crest: %w", err))
+		return
+	}
+
+	if crest == nil {
+		writeError(w, r, NotFound("Crest not found"))
+		return
+	}
+
+	if writeNotModified(w, r, etagFor(crest.ID, crest.UpdatedAt)) {
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, crest)
+}
+
+func (cc *CrestController) getCrestByID(id int) (*Crest, error) {
+	row := cc.db.QueryRow("SELECT * FROM crests WHERE id = $1", id)
+
+	var crest Crest
+	err := row.Scan(crestColumns(&crest)...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &crest, nil
+}
+
+func (cc *CrestController) PostOne(w http.ResponseWriter, r *http.Request) {
+	var crest Crest
+	err := decodeJSON(r, &crest)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
+		return
+	}
+
+	err = crest.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	crest.CreatedAt = time.Now()
+	crest.UpdatedAt = time.Now()
+
+	err = cc.insertCrest(&crest)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error inserting crest: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(crest.ID, crest.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, crest)
+}
+
+func (cc *CrestController) insertCrest(crest *Crest) error {
+	err := cc.db.QueryRow(`
+		INSERT INTO crests (name, activation_effect, trigger, effect_type, effect_value,
+			major_rate, minor_rate, description, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at, updated_at
+	`, crest.Name, crest.ActivationEffect, crest.Trigger, crest.EffectType, crest.EffectValue,
+		crest.MajorRate, crest.MinorRate, crest.Description, crest.CreatedAt, crest.UpdatedAt).Scan(
+		&crest.ID, &crest.CreatedAt, &crest.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cc *CrestController) PutOne(w http.ResponseWriter, r *http.Request) {
+	crestID := mux.Vars(r)["crestID"]
+	id, err := strconv.Atoi(crestID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid crest ID"))
+		return
+	}
+
+	var updatedCrest Crest
+	err = decodeJSON(r, &updatedCrest)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
+		return
+	}
+
+	err = updatedCrest.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	current, err := cc.getCrestByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting crest: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Crest not found"))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedCrest.UpdatedAt = time.Now()
+
+	err = cc.updateCrest(id, &updatedCrest, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating crest: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedCrest.ID, updatedCrest.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedCrest)
+}
+
+func (cc *CrestController) PatchOne(w http.ResponseWriter, r *http.Request) {
+	crestID := mux.Vars(r)["crestID"]
+	id, err := strconv.Atoi(crestID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid crest ID"))
+		return
+	}
+
+	updatedCrest, err := cc.getCrestByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting crest: %w", err))
+		return
+	}
+
+	if updatedCrest == nil {
+		writeError(w, r, NotFound("Crest not found"))
+		return
+	}
+
+	version := updatedCrest.UpdatedAt
+	err = checkIfMatch(r, etagFor(updatedCrest.ID, version))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = applyMergePatch(r, updatedCrest)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = updatedCrest.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedCrest.UpdatedAt = time.Now()
+
+	err = cc.updateCrest(id, updatedCrest, version)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating crest: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedCrest.ID, updatedCrest.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedCrest)
+}
+
+func (cc *CrestController) updateCrest(id int, updatedCrest *Crest, version time.Time) error {
+	// Every column is written so that PUT replaces the whole crest. The row is
+	// only updated if it has not changed since version was read.
+	err := cc.db.QueryRow(`
+		UPDATE crests SET name = $1, activation_effect = $2, trigger = $3, effect_type = $4,
+			effect_value = $5, major_rate = $6, minor_rate = $7, description = $8, updated_at = $9
+		WHERE id = $10 AND updated_at = $11
+		RETURNING *
+	`, updatedCrest.Name, updatedCrest.ActivationEffect, updatedCrest.Trigger, updatedCrest.EffectType,
+		updatedCrest.EffectValue, updatedCrest.MajorRate, updatedCrest.MinorRate, updatedCrest.Description,
+		updatedCrest.UpdatedAt, id, version).Scan(crestColumns(updatedCrest)...)
+
+	if err == sql.ErrNoRows {
+		return Conflict("Crest with ID %d was modified or deleted by another request", id)
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cc *CrestController) DeleteOne(w http.ResponseWriter, r *http.Request) {
+	crestID := mux.Vars(r)["crestID"]
+	id, err := strconv.Atoi(crestID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid crest ID"))
+		return
+	}
+
+	current, err := cc.getCrestByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting crest: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Crest with ID %d not found", id))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = cc.deleteCrest(id, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error deleting crest: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, deleteResult{Success: true, Msg: "Crest deleted successfully."})
+}
+
+func (cc *CrestController) deleteCrest(id int, version time.Time) error {
+	// Only delete the row if it has not changed since version was read
+	result, err := cc.db.Exec("DELETE FROM crests WHERE id = $1 AND updated_at = $2", id, version)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return Conflict("Crest with ID %d was modified or deleted by another request", id)
+	}
+
+	return nil
+}
+
+// GetBearers lists the characters bearing the crest, with either strength
+func (cc *CrestController) GetBearers(w http.ResponseWriter, r *http.Request) {
+	crestID := mux.Vars(r)["crestID"]
+	id, err := strconv.Atoi(crestID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid crest ID"))
+		return
+	}
+
+	crest, err := cc.getCrestByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting crest: %w", err))
+		return
+	}
+
+	if crest == nil {
+		writeError(w, r, NotFound("Crest not found"))
+		return
+	}
+
+	bearers, err := cc.getBearers(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting crest bearers: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, bearers)
+}
+
+func (cc *CrestController) getBearers(crestID int) ([]Character, error) {
+	rows, err := cc.db.Query("SELECT * FROM characters WHERE crest_id = $1 ORDER BY crest_strength, name", crestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bearers []Character
+
+	for rows.Next() {
+		var character Character
+		err := rows.Scan(characterColumns(&character)...)
+		if err != nil {
+			return nil, err
+		}
+		bearers = append(bearers, character)
+	}
+
+	return bearers, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/lib/pq"
+)
+
+// ErrorCode is the machine-readable category of an API error
+type ErrorCode string
+
+const (
+	CodeBadRequest ErrorCode = "bad_request"
+	CodeNotFound   ErrorCode = "not_found"
+	CodeConflict   ErrorCode = "conflict"
+	CodeValidation ErrorCode = "validation"
+	CodeInternal   ErrorCode = "internal"
+
+	CodeMethodNotAllowed   ErrorCode = "method_not_allowed"
+	CodePreconditionFailed ErrorCode = "precondition_failed"
+	CodeRateLimited        ErrorCode = "rate_limited"
+)
+
+var errorStatus = map[ErrorCode]int{
+	CodeBadRequest: http.StatusBadRequest,
+	CodeNotFound:   http.StatusNotFound,
+	CodeConflict:   http.StatusConflict,
+	CodeValidation: http.StatusUnprocessableEntity,
+	CodeInternal:   http.StatusInternalServerError,
+
+	CodeMethodNotAllowed:   http.StatusMethodNotAllowed,
+	CodePreconditionFailed: http.StatusPreconditionFailed,
+	CodeRateLimited:        http.StatusTooManyRequests,
+}
+
+// APIError is an error that can be sent to the client. Err holds the
+// underlying cause, which is logged but never exposed.
+type APIError struct {
+	Code    ErrorCode
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func (e *APIError) Status() int {
+	return errorStatus[e.Code]
+}
+
+func BadRequest(format string, args ...interface{}) *APIError {
+	return &APIError{Code: CodeBadRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+func NotFound(format string, args ...interface{}) *APIError {
+	return &APIError{Code: CodeNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+func Conflict(format string, args ...interface{}) *APIError {
+	return &APIError{Code: CodeConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+func MethodNotAllowed(format string, args ...interface{}) *APIError {
+	return &APIError{Code: CodeMethodNotAllowed, Message: fmt.Sprintf(format, args...)}
+}
+
+func PreconditionFailed(format string, args ...interface{}) *APIError {
+	return &APIError{Code: CodePreconditionFailed, Message: fmt.Sprintf(format, args...)}
+}
+
+func TooManyRequests(format string, args ...interface{}) *APIError {
+	return &APIError{Code: CodeRateLimited, Message: fmt.Sprintf(format, args...)}
+}
+
+func Internal(err error) *APIError {
+	return &APIError{Code: CodeInternal, Message: "Internal server error", Err: err}
+}
+
+// toAPIError classifies any error returned by a controller. Errors that are
+// not recognised become internal errors so database details never leak.
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var ve ValidationErrors
+	if errors.As(err, &ve) {
+		return &APIError{Code: CodeValidation, Message: "Request body failed validation", Fields: ve, Err: err}
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return &APIError{Code: CodeNotFound, Message: "Resource not found", Err: err}
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Name() {
+		case "unique_violation":
+			return &APIError{Code: CodeConflict, Message: "A resource with the same unique value already exists", Err: err}
+		case "foreign_key_violation":
+			return &APIError{Code: CodeConflict, Message: "The resource references, or is referenced by, another resource", Err: err}
+		case "not_null_violation", "check_violation":
+			field := pqErr.Column
+			if field == "" {
+				field = pqErr.Constraint
+			}
+			return &APIError{
+				Code:    CodeValidation,
+				Message: "Request body failed validation",
+				Fields:  []FieldError{{Field: field, Message: "is missing or out of range"}},
+				Err:     err,
+			}
+		}
+	}
+
+	return Internal(err)
+}
+
+// errorResponse is the envelope of every error response
+type errorResponse struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code      ErrorCode    `json:"code"`
+	Message   string       `json:"message"`
+	RequestID string       `json:"request_id"`
+	Fields    []FieldError `json:"fields,omitempty"`
+}
+
+// writeError sends err in the JSON error envelope. Internal errors are logged
+// with the request ID so they can be matched with the client's report.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := toAPIError(err)
+	requestID := requestIDFrom(r.Context())
+
+	if apiErr.Code == CodeInternal {
+		loggerFrom(r.Context()).Error("request failed",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("error", err.Error()))
+	}
+
+	responseJSON, _ := json.Marshal(errorResponse{Error: errorDetail{
+		Code:      apiErr.Code,
+		Message:   apiErr.Message,
+		RequestID: requestID,
+		Fields:    apiErr.Fields,
+	}})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Status())
+	w.Write(responseJSON)
+}
+
+// writeJSON encodes v and sends it with the given status
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	if wantsLegacyShape(r) {
+		v = toLegacyShape(v)
+	}
+	responseJSON, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error encoding response to JSON: %w", err))
+		return
+	}
+
+	if etag := w.Header().Get("ETag"); etag != "" {
+		w.Header().Set("ETag", shapedETag(r, etag))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	varyOnShape(w)
+	w.WriteHeader(status)
+	w.Write(responseJSON)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// etagFor derives a strong entity tag from the row's ID and the time it was
+// last updated, which changes on every write
+func etagFor(id int, updatedAt time.Time) string {
+	return fmt.Sprintf(`"%d-%x"`, id, updatedAt.UnixMicro())
+}
+
+// etagWith derives the entity tag of a variant of a resource, such as a
+// representation that includes another row, by appending suffix to its tag
+func etagWith(etag, suffix string) string {
+	return strings.TrimSuffix(etag, `"`) + "-" + suffix + `"`
+}
+
+// shapedETag folds the JSON shape of the request into an entity tag, so that
+// the legacy and the current representations of a resource never share one.
+// Tags that already carry the shape are returned as is.
+func shapedETag(r *http.Request, etag string) string {
+	if etag == "" || !wantsLegacyShape(r) || strings.HasSuffix(etag, "-"+legacyShape+`"`) {
+		return etag
+	}
+	return etagWith(etag, legacyShape)
+}
+
+// etagListContains reports whether a comma-separated If-Match or
+// If-None-Match header lists etag. Weak tags only match when weak is set.
+func etagListContains(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch fails with 412 when the request carries an If-Match header
+// that does not list the current entity tag of the resource
+func checkIfMatch(r *http.Request, etag string) error {
+	etag = shapedETag(r, etag)
+	header := r.Header.Get("If-Match")
+	if header == "" || etagListContains(header, etag, false) {
+		return nil
+	}
+	return PreconditionFailed("The resource has been modified since it was read")
+}
+
+// writeNotModified sets the ETag header and answers 304 when the request's
+// If-None-Match header already lists it. It reports whether it responded.
+func writeNotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	etag = shapedETag(r, etag)
+	w.Header().Set("ETag", etag)
+	varyOnShape(w)
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagListContains(header, etag, true) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
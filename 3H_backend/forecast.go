@@ -0,0 +1,648 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Stats is a stat line, in the order of the class stat arrays
+type Stats struct {
+	HP  int `json:"hp"`
+	Str int `json:"str"`
+	Mag int `json:"mag"`
+	Dex int `json:"dex"`
+	Spd int `json:"spd"`
+	Lck int `json:"lck"`
+	Def int `json:"def"`
+	Res int `json:"res"`
+	Cha int `json:"cha"`
+}
+
+// at returns the stat at index i of a class stat array
+func (s *Stats) at(i int) *int {
+	return [statCount]*int{&s.HP, &s.Str, &s.Mag, &s.Dex, &s.Spd, &s.Lck, &s.Def, &s.Res, &s.Cha}[i]
+}
+
+// add adds a stat array such as a class bonus; nil arrays are ignored
+func (s *Stats) add(values []int) {
+	for i := 0; i < len(values) && i < statCount; i++ {
+		*s.at(i) += values[i]
+	}
+}
+
+// formulaVars exposes the stats and level to a formula
+func (s Stats) formulaVars(level int) map[string]float64 {
+	vars := map[string]float64{"lv": float64(level)}
+	for i, name := range formulaVariables[1:] {
+		vars[name] = float64(*s.at(i))
+	}
+	return vars
+}
+
+func characterStats(c *Character) Stats {
+	return Stats{c.HP, c.Strength, c.Magic, c.Dexterity, c.Speed, c.Luck, c.Defence, c.Resistance, c.Charm}
+}
+
+func characterGrowths(c *Character) Stats {
+	return Stats{c.HpGrowth, c.StrGrowth, c.MagGrowth, c.DexGrowth, c.SpdGrowth, c.LckGrowth, c.DefGrowth, c.ResGrowth, c.ChaGrowth}
+}
+
+// StatCaps reports a stat line against the caps that apply to it: the
+// lowest of the character's and the class's max stats
+type StatCaps struct {
+	// Caps is nil when neither the character nor the class has max stats
+	Caps     *Stats `json:"caps"`
+	Capped   Stats  `json:"capped"`
+	Uncapped Stats  `json:"uncapped"`
+	// Exceeded names the stats that would be above their cap
+	Exceeded []string `json:"exceeded"`
+}
+
+// applyCaps caps stats with every non-empty array of max stats given
+func applyCaps(stats Stats, maxStats ...[]int) StatCaps {
+	result := StatCaps{Capped: stats, Uncapped: stats, Exceeded: []string{}}
+	for _, values := range maxStats {
+		if len(values) == 0 {
+			continue
+		}
+		if result.Caps == nil {
+			result.Caps = &Stats{}
+			for i := 0; i < statCount; i++ {
+				*result.Caps.at(i) = math.MaxInt
+			}
+		}
+		for i := 0; i < len(values) && i < statCount; i++ {
+			*result.Caps.at(i) = min(*result.Caps.at(i), values[i])
+		}
+	}
+	if result.Caps == nil {
+		return result
+	}
+
+	for i := 0; i < statCount; i++ {
+		if limit := *result.Caps.at(i); *stats.at(i) > limit {
+			*result.Capped.at(i) = limit
+			result.Exceeded = append(result.Exceeded, validStatNames[i])
+		}
+	}
+	return result
+}
+
+// CombatValues are the figures shown in the in-game combat forecast
+type CombatValues struct {
+	Attack      int `json:"attack"`
+	Hit         int `json:"hit"`
+	Avoid       int `json:"avoid"`
+	Critical    int `json:"critical"`
+	AttackSpeed int `json:"attack_speed"`
+}
+
+// CrestForecast describes how the unit's crest changes the forecast when it
+// activates
+type CrestForecast struct {
+	CrestID  int    `json:"crest_id"`
+	Name     string `json:"name"`
+	Strength string `json:"strength"`
+	Effect   string `json:"effect"`
+	// ActivationRate is the chance, in percent, that the crest activates on
+	// this attack; 0 when its trigger does not match the attack
+	ActivationRate int          `json:"activation_rate"`
+	Activated      CombatValues `json:"activated"`
+	HealPercent    int          `json:"heal_percent"`
+}
+
+type Forecast struct {
+	CharacterID int  `json:"character_id"`
+	Level       int  `json:"level"`
+	ClassID     *int `json:"class_id"`
+	WeaponID    *int `json:"weapon_id"`
+	SpellID     *int `json:"spell_id"`
+	CombatArtID *int `json:"combat_art_id"`
+	BattalionID *int `json:"battalion_id"`
+	ItemID      *int `json:"item_id"`
+	// Stats are capped; StatCaps tells which stats reached their cap
+	Stats    Stats          `json:"stats"`
+	StatCaps StatCaps       `json:"stat_caps"`
+	Combat   CombatValues   `json:"combat"`
+	Crest    *CrestForecast `json:"crest"`
+	// Supports lists the bonuses of the adjacent allies given in ally,
+	// already added to Combat
+	Supports []AllySupport `json:"supports"`
+	// Gambit is set when the character leads a battalion with a gambit
+	Gambit *GambitForecast `json:"gambit"`
+}
+
+// GambitForecast is the forecast of the gambit of the battalion led. Its
+// attack adds the gambit might to the higher of the leader's Str and Mag,
+// 0 for gambits without might; its hit rate is the gambit's own.
+type GambitForecast struct {
+	GambitID  int    `json:"gambit_id"`
+	Name      string `json:"name"`
+	Attack    int    `json:"attack"`
+	Hit       int    `json:"hit"`
+	RangeMin  int    `json:"range_min"`
+	RangeMax  *int   `json:"range_max"`
+	Uses      int    `json:"uses"`
+	Area      string `json:"area"`
+	Effect    string `json:"effect"`
+	Endurance int    `json:"endurance"`
+}
+
+// AllySupport is the bonus an adjacent ally confers at the rank reached in
+// its support with the character
+type AllySupport struct {
+	AllyID int `json:"ally_id"`
+	SupportBonus
+}
+
+// attackSource is the weapon, spell or combat art an attack is made with
+type attackSource struct {
+	might, hit, critical, weight int
+	magic                        bool
+	spell                        bool
+	combatArt                    bool
+}
+
+// ForecastController computes combat forecasts from the data of the other
+// resources
+type ForecastController struct {
+	characters *CharacterController
+	classes    *ClassController
+	weapons    *WeaponsController
+	spells     *SpellsController
+	combatArts *CombatArtController
+	crests     *CrestController
+	supports   *SupportController
+	battalions *BattalionController
+	gambits    *GambitController
+	items      *ItemController
+	inventory  *InventoryController
+}
+
+func NewForecastController(db *sql.DB) *ForecastController {
+	return &ForecastController{
+		characters: NewCharacterController(db),
+		classes:    NewClassController(db),
+		weapons:    NewWeaponsController(db),
+		spells:     NewSpellsController(db),
+		combatArts: NewCombatArtController(db),
+		crests:     NewCrestController(db),
+		supports:   NewSupportController(db),
+		battalions: NewBattalionController(db),
+		gambits:    NewGambitController(db),
+		items:      NewItemController(db),
+		inventory:  NewInventoryController(db),
+	}
+}
+
+// GetForecast computes the forecast of a character at a level, in a class
+// and attacking with a weapon, spell or combat art, all optional
+func (fc *ForecastController) GetForecast(w http.ResponseWriter, r *http.Request) {
+	charID := mux.Vars(r)["charID"]
+	id, err := strconv.Atoi(charID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid character ID"))
+		return
+	}
+
+	character, err := fc.characters.getCharacterByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting character: %w", err))
+		return
+	}
+
+	if character == nil {
+		writeError(w, r, NotFound("Character not found"))
+		return
+	}
+
+	forecast, err := fc.forecast(r, character)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, forecast)
+}
+
+func (fc *ForecastController) forecast(r *http.Request, character *Character) (*Forecast, error) {
+	forecast := &Forecast{CharacterID: character.ID, Level: character.BaseLv}
+
+	query := r.URL.Query()
+	if value := query.Get("level"); value != "" {
+		level, err := strconv.Atoi(value)
+		if err != nil || level < character.BaseLv || level > 99 {
+			return nil, BadRequest("level must be between the base level %d and 99", character.BaseLv)
+		}
+		forecast.Level = level
+	}
+
+	// The IDs are read in a fixed order so that a request with several bad
+	// IDs always reports the same one
+	var err error
+	for _, id := range []struct {
+		param  string
+		target **int
+	}{
+		{"class_id", &forecast.ClassID},
+		{"weapon_id", &forecast.WeaponID},
+		{"spell_id", &forecast.SpellID},
+		{"combat_art_id", &forecast.CombatArtID},
+		{"battalion_id", &forecast.BattalionID},
+		{"item_id", &forecast.ItemID},
+	} {
+		*id.target, err = queryID(r, id.param)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if forecast.WeaponID != nil && forecast.SpellID != nil {
+		return nil, BadRequest("weapon_id and spell_id cannot be combined")
+	}
+	if forecast.CombatArtID != nil && forecast.WeaponID == nil {
+		return nil, BadRequest("combat_art_id requires weapon_id")
+	}
+
+	var class *Classes
+	if forecast.ClassID != nil {
+		class, err = fc.classes.getClassByID(*forecast.ClassID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting class: %w", err)
+		}
+		if class == nil {
+			return nil, NotFound("Class not found")
+		}
+	}
+	var classCaps []int
+	if class != nil {
+		classCaps = class.MaxStats
+	}
+	forecast.StatCaps = applyCaps(statsAtLevel(character, class, forecast.Level), character.MaxStats, classCaps)
+	forecast.Stats = forecast.StatCaps.Capped
+
+	// Accessory and battalion bonuses apply on top of the caps
+	err = fc.resolveItem(forecast)
+	if err != nil {
+		return nil, err
+	}
+	if forecast.ItemID != nil {
+		err = fc.applyItem(forecast)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if forecast.BattalionID != nil {
+		err = fc.applyBattalion(forecast)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	source, err := fc.attackSource(forecast)
+	if err != nil {
+		return nil, err
+	}
+	forecast.Combat = combatValues(forecast.Stats, source)
+
+	forecast.Supports, err = fc.allySupports(r, character)
+	if err != nil {
+		return nil, err
+	}
+	for _, ally := range forecast.Supports {
+		forecast.Combat.Hit += ally.Hit
+		forecast.Combat.Avoid += ally.Avoid
+		forecast.Combat.Critical += ally.Critical
+	}
+
+	if character.CrestID != nil && character.CrestStrength != nil {
+		crest, err := fc.crests.getCrestByID(*character.CrestID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting crest: %w", err)
+		}
+		if crest != nil {
+			forecast.Crest = crestForecast(crest, *character.CrestStrength, forecast, source)
+		}
+	}
+
+	return forecast, nil
+}
+
+func (fc *ForecastController) attackSource(forecast *Forecast) (attackSource, error) {
+	var source attackSource
+
+	if forecast.SpellID != nil {
+		spell, err := fc.spells.getSpellByID(*forecast.SpellID)
+		if err != nil {
+			return source, fmt.Errorf("error getting spell: %w", err)
+		}
+		if spell == nil {
+			return source, NotFound("Spell not found")
+		}
+		source = attackSource{might: intOrZero(spell.Might), hit: intOrZero(spell.Hit),
+			critical: intOrZero(spell.Critical), weight: intOrZero(spell.Weight), magic: true, spell: true}
+	}
+
+	if forecast.WeaponID != nil {
+		weapon, err := fc.weapons.getWeaponByID(*forecast.WeaponID)
+		if err != nil {
+			return source, fmt.Errorf("error getting weapon: %w", err)
+		}
+		if weapon == nil {
+			return source, NotFound("Weapon not found")
+		}
+		source = attackSource{might: intOrZero(weapon.Might), hit: intOrZero(weapon.Hit),
+			critical: intOrZero(weapon.Critical), weight: weapon.Weight, magic: weapon.StrMag != nil && *weapon.StrMag}
+	}
+
+	if forecast.CombatArtID != nil {
+		art, err := fc.combatArts.getCombatArtByID(*forecast.CombatArtID)
+		if err != nil {
+			return source, fmt.Errorf("error getting combat art: %w", err)
+		}
+		if art == nil {
+			return source, NotFound("Combat art not found")
+		}
+		source.might += intOrZero(art.Might)
+		source.hit += intOrZero(art.Hit)
+		source.critical += intOrZero(art.Critical)
+		if art.StrMag != nil {
+			source.magic = *art.StrMag
+		}
+		source.combatArt = true
+	}
+
+	return source, nil
+}
+
+// resolveItem checks that the item given in item_id is in the inventory of
+// the character, to forecast equipping it; without item_id, the accessory
+// the character has equipped is used
+func (fc *ForecastController) resolveItem(forecast *Forecast) error {
+	entries, err := fc.inventory.getInventory(forecast.CharacterID)
+	if err != nil {
+		return fmt.Errorf("error getting inventory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.ItemID == nil {
+			continue
+		}
+		if forecast.ItemID == nil && entry.Equipped {
+			forecast.ItemID = entry.ItemID
+			return nil
+		}
+		if forecast.ItemID != nil && *forecast.ItemID == *entry.ItemID {
+			return nil
+		}
+	}
+
+	if forecast.ItemID != nil {
+		return BadRequest("Character %d does not carry item %d", forecast.CharacterID, *forecast.ItemID)
+	}
+	return nil
+}
+
+// applyItem adds the stat bonuses of the equipped shield or ring to the stats
+func (fc *ForecastController) applyItem(forecast *Forecast) error {
+	item, err := fc.items.getItemByID(*forecast.ItemID)
+	if err != nil {
+		return fmt.Errorf("error getting item: %w", err)
+	}
+	if item == nil {
+		return NotFound("Item not found")
+	}
+	if item.Category != "shield" && item.Category != "ring" {
+		return BadRequest("item_id must reference a shield or a ring")
+	}
+
+	for _, effect := range item.Effects {
+		if effect.Type == "stat_bonus" && effect.Stat != nil && effect.Value != nil {
+			if i := slices.Index(validStatNames, *effect.Stat); i >= 0 {
+				*forecast.Stats.at(i) += *effect.Value
+			}
+		}
+	}
+	return nil
+}
+
+// applyBattalion adds the stat bonus of the battalion led to the stats and
+// forecasts its gambit
+func (fc *ForecastController) applyBattalion(forecast *Forecast) error {
+	battalion, err := fc.battalions.getBattalionByID(*forecast.BattalionID)
+	if err != nil {
+		return fmt.Errorf("error getting battalion: %w", err)
+	}
+	if battalion == nil {
+		return NotFound("Battalion not found")
+	}
+	forecast.Stats.add(battalion.StatBonus)
+
+	if battalion.GambitID == nil {
+		return nil
+	}
+	gambit, err := fc.gambits.getGambitByID(*battalion.GambitID)
+	if err != nil {
+		return fmt.Errorf("error getting gambit: %w", err)
+	}
+	if gambit != nil {
+		attack := 0
+		if gambit.Might != nil {
+			attack = max(forecast.Stats.Str, forecast.Stats.Mag) + *gambit.Might
+		}
+		forecast.Gambit = &GambitForecast{
+			GambitID:  gambit.ID,
+			Name:      gambit.Name,
+			Attack:    attack,
+			Hit:       intOrZero(gambit.Hit),
+			RangeMin:  gambit.RangeMin,
+			RangeMax:  gambit.RangeMax,
+			Uses:      gambit.Uses,
+			Area:      gambit.Area,
+			Effect:    gambit.Effect,
+			Endurance: battalion.Endurance,
+		}
+	}
+	return nil
+}
+
+// maxAdjacentAllies is the number of tiles next to a unit
+const maxAdjacentAllies = 4
+
+// allySupports reads the adjacent allies from the ally query parameter, which
+// may be repeated, and looks up their support with the character. Each value
+// is an ally ID and the support rank reached with it, such as 12:B.
+func (fc *ForecastController) allySupports(r *http.Request, character *Character) ([]AllySupport, error) {
+	allies, err := parseAllies(r.URL.Query()["ally"], character.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(allies) == 0 {
+		return allies, nil
+	}
+
+	allyIDs := make([]int, len(allies))
+	for i, ally := range allies {
+		allyIDs[i] = ally.AllyID
+	}
+	supports, err := fc.supports.getSupports(character.ID, allyIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error getting supports: %w", err)
+	}
+
+	for i, ally := range allies {
+		support, ok := supports[ally.AllyID]
+		if !ok {
+			return nil, BadRequest("Character %d has no support with ally %d", character.ID, ally.AllyID)
+		}
+		if !slices.Contains(support.Ranks, ally.Rank) {
+			return nil, BadRequest("The support with ally %d cannot reach rank %s", ally.AllyID, ally.Rank)
+		}
+		allies[i].SupportBonus = supportBonuses[ally.Rank]
+	}
+	return allies, nil
+}
+
+// parseAllies parses the values of the ally query parameter. An ally can
+// only be given once and at most maxAdjacentAllies can be adjacent.
+func parseAllies(values []string, charID int) ([]AllySupport, error) {
+	allies := []AllySupport{}
+	for _, value := range values {
+		id, rank, found := strings.Cut(strings.TrimSpace(value), ":")
+		allyID, err := strconv.Atoi(id)
+		if err != nil || !found || allyID <= 0 || allyID == charID {
+			return nil, BadRequest("Invalid ally %q, expected an ally ID and a support rank such as 12:B", value)
+		}
+		if !slices.Contains(validSupportRanks, rank) {
+			return nil, BadRequest("Invalid support rank %q, expected one of %s", rank, strings.Join(validSupportRanks, ", "))
+		}
+		if slices.ContainsFunc(allies, func(ally AllySupport) bool { return ally.AllyID == allyID }) {
+			return nil, BadRequest("Ally %d is given more than once", allyID)
+		}
+		allies = append(allies, AllySupport{AllyID: allyID, SupportBonus: SupportBonus{Rank: rank}})
+	}
+	if len(allies) > maxAdjacentAllies {
+		return nil, BadRequest("At most %d allies can be adjacent", maxAdjacentAllies)
+	}
+	return allies, nil
+}
+
+// statsAtLevel averages the character's growth, plus the class growth
+// modifiers, over the levels gained since its base level. A class raises
+// stats below its base stats to them and then adds its bonus.
+func statsAtLevel(character *Character, class *Classes, level int) Stats {
+	stats := characterStats(character)
+	growths := characterGrowths(character)
+	if class != nil {
+		growths.add(class.Growth)
+	}
+
+	gained := level - character.BaseLv
+	for i := 0; i < statCount; i++ {
+		*stats.at(i) += *growths.at(i) * gained / 100
+	}
+
+	if class != nil {
+		for i := 0; i < len(class.Base) && i < statCount; i++ {
+			*stats.at(i) = max(*stats.at(i), class.Base[i])
+		}
+		stats.add(class.Bonus)
+	}
+	return stats
+}
+
+// combatValues applies the formulas of the game: physical attacks use Str
+// and Dex for hit, magic uses Mag and (Dex + Lck) / 2 for hit, and weight
+// above Str / 5 slows the unit down
+func combatValues(stats Stats, source attackSource) CombatValues {
+	values := CombatValues{
+		Attack:      stats.Str + source.might,
+		Hit:         stats.Dex + source.hit,
+		Critical:    (stats.Dex+stats.Lck)/2 + source.critical,
+		AttackSpeed: stats.Spd - max(0, source.weight-stats.Str/5),
+	}
+	if source.magic {
+		values.Attack = stats.Mag + source.might
+	}
+	if source.spell {
+		values.Hit = (stats.Dex+stats.Lck)/2 + source.hit
+	}
+	values.Avoid = values.AttackSpeed
+	return values
+}
+
+func crestForecast(crest *Crest, strength string, forecast *Forecast, source attackSource) *CrestForecast {
+	result := &CrestForecast{
+		CrestID:   crest.ID,
+		Name:      crest.Name,
+		Strength:  strength,
+		Effect:    crest.ActivationEffect,
+		Activated: forecast.Combat,
+	}
+
+	rateFormula := crest.MinorRate
+	if strength == "Major" {
+		rateFormula = crest.MajorRate
+	}
+	if f, err := parseFormula(rateFormula); err == nil && crestTriggers(crest.Trigger, source) {
+		rate := f.Eval(forecast.Stats.formulaVars(forecast.Level))
+		result.ActivationRate = int(math.Max(0, math.Min(100, math.Floor(rate))))
+	}
+
+	value := intOrZero(crest.EffectValue)
+	switch crest.EffectType {
+	case "might_bonus":
+		result.Activated.Attack += value
+	case "might_multiplier":
+		result.Activated.Attack += source.might * (value - 1)
+	case "hit_bonus":
+		result.Activated.Hit += value
+	case "avoid_bonus":
+		result.Activated.Avoid += value
+	case "critical_bonus":
+		result.Activated.Critical += value
+	case "heal_percent":
+		result.HealPercent = value
+	}
+	return result
+}
+
+// crestTriggers reports whether a crest with the given trigger can activate
+// on the attack
+func crestTriggers(trigger string, source attackSource) bool {
+	switch trigger {
+	case "attack":
+		return !source.spell
+	case "combat_art":
+		return source.combatArt
+	case "spell":
+		return source.spell
+	}
+	return trigger == "any"
+}
+
+// queryID reads an optional positive ID from the query string
+func queryID(r *http.Request, param string) (*int, error) {
+	value := strings.TrimSpace(r.URL.Query().Get(param))
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		return nil, BadRequest("Invalid %s", param)
+	}
+	return &id, nil
+}
+
+func intOrZero(value *int) int {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
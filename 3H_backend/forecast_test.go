@@ -0,0 +1,183 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAllies(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []AllySupport
+		wantErr bool
+	}{
+		{"none", nil, []AllySupport{}, false},
+		{"one", []string{"2:B"}, []AllySupport{{2, SupportBonus{Rank: "B"}}}, false},
+		{"several", []string{"2:C", " 3:S "}, []AllySupport{{2, SupportBonus{Rank: "C"}}, {3, SupportBonus{Rank: "S"}}}, false},
+		{"no rank", []string{"2"}, nil, true},
+		{"unknown rank", []string{"2:D"}, nil, true},
+		{"invalid ID", []string{"x:B"}, nil, true},
+		{"the character itself", []string{"1:B"}, nil, true},
+		{"repeated ally", []string{"2:B", "2:A"}, nil, true},
+		{"too many allies", []string{"2:C", "3:C", "4:C", "5:C", "6:C"}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseAllies(test.values, 1)
+			if test.wantErr {
+				if _, ok := err.(*APIError); !ok {
+					t.Fatalf("parseAllies(%q) error = %v, want an API error", test.values, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseAllies(%q) = %v, want %v", test.values, got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyCaps(t *testing.T) {
+	stats := Stats{HP: 60, Str: 45, Mag: 10, Dex: 30, Spd: 30, Lck: 20, Def: 25, Res: 15, Cha: 20}
+
+	tests := []struct {
+		name     string
+		maxStats [][]int
+		capped   Stats
+		exceeded []string
+		hasCaps  bool
+	}{
+		{"no caps", nil, stats, []string{}, false},
+		{"empty caps", [][]int{nil, {}}, stats, []string{}, false},
+		{"one array", [][]int{{70, 40, 99, 99, 99, 99, 99, 99, 99}}, Stats{60, 40, 10, 30, 30, 20, 25, 15, 20}, []string{"str"}, true},
+		{"lowest of both arrays", [][]int{{50, 50}, {99, 44, 5}}, Stats{50, 44, 5, 30, 30, 20, 25, 15, 20}, []string{"hp", "str", "mag"}, true},
+		{"at the cap", [][]int{{60}}, stats, []string{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := applyCaps(stats, test.maxStats...)
+			if result.Uncapped != stats {
+				t.Errorf("uncapped %v, want %v", result.Uncapped, stats)
+			}
+			if result.Capped != test.capped {
+				t.Errorf("capped %v, want %v", result.Capped, test.capped)
+			}
+			if !reflect.DeepEqual(result.Exceeded, test.exceeded) {
+				t.Errorf("exceeded %v, want %v", result.Exceeded, test.exceeded)
+			}
+			if (result.Caps != nil) != test.hasCaps {
+				t.Errorf("caps = %v", result.Caps)
+			}
+		})
+	}
+}
+
+func TestStatsAtLevel(t *testing.T) {
+	character := &Character{BaseLv: 5, HP: 30, HpGrowth: 50, Strength: 10, StrGrowth: 45, Magic: 5, MagGrowth: 20,
+		Dexterity: 8, DexGrowth: 30, Speed: 9, SpdGrowth: 40, Luck: 6, LckGrowth: 25, Defence: 7, DefGrowth: 30,
+		Resistance: 4, ResGrowth: 15, Charm: 8, ChaGrowth: 40}
+	class := &Classes{
+		Base:   []int{0, 0, 12},
+		Bonus:  []int{0, 2, 0, 0, 1},
+		Growth: []int{10, 5, -10},
+	}
+
+	tests := []struct {
+		name  string
+		class *Classes
+		level int
+		want  Stats
+	}{
+		{"base level", nil, 5, Stats{30, 10, 5, 8, 9, 6, 7, 4, 8}},
+		{"growths are averaged and truncated", nil, 15, Stats{35, 14, 7, 11, 13, 8, 10, 5, 12}},
+		{"class growths, base and bonus", class, 15, Stats{36, 17, 12, 11, 14, 8, 10, 5, 12}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := statsAtLevel(character, test.class, test.level); got != test.want {
+				t.Errorf("statsAtLevel = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCombatValues(t *testing.T) {
+	stats := Stats{HP: 40, Str: 20, Mag: 15, Dex: 18, Spd: 16, Lck: 10}
+
+	tests := []struct {
+		name   string
+		source attackSource
+		want   CombatValues
+	}{
+		{"unarmed", attackSource{}, CombatValues{Attack: 20, Hit: 18, Avoid: 16, Critical: 14, AttackSpeed: 16}},
+		{"light weapon", attackSource{might: 8, hit: 90, critical: 5, weight: 4},
+			CombatValues{Attack: 28, Hit: 108, Avoid: 16, Critical: 19, AttackSpeed: 16}},
+		{"heavy weapon", attackSource{might: 16, hit: 60, weight: 10},
+			CombatValues{Attack: 36, Hit: 78, Avoid: 10, Critical: 14, AttackSpeed: 10}},
+		{"magic weapon", attackSource{might: 7, hit: 80, weight: 5, magic: true},
+			CombatValues{Attack: 22, Hit: 98, Avoid: 15, Critical: 14, AttackSpeed: 15}},
+		{"spell", attackSource{might: 5, hit: 70, weight: 2, magic: true, spell: true},
+			CombatValues{Attack: 20, Hit: 84, Avoid: 16, Critical: 14, AttackSpeed: 16}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := combatValues(stats, test.source); got != test.want {
+				t.Errorf("combatValues = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCrestForecast(t *testing.T) {
+	forecast := &Forecast{Level: 10, Stats: Stats{Str: 20, Dex: 12, Lck: 8},
+		Combat: CombatValues{Attack: 30, Hit: 90, Avoid: 20, Critical: 10, AttackSpeed: 20}}
+	weapon := attackSource{might: 10}
+
+	tests := []struct {
+		name     string
+		crest    Crest
+		strength string
+		source   attackSource
+		rate     int
+		combat   CombatValues
+		heal     int
+	}{
+		{"might bonus, minor", Crest{Trigger: "attack", EffectType: "might_bonus", EffectValue: intPtr(5),
+			MajorRate: "lck / 2", MinorRate: "lck / 4"}, "Minor", weapon, 2,
+			CombatValues{Attack: 35, Hit: 90, Avoid: 20, Critical: 10, AttackSpeed: 20}, 0},
+		{"might multiplier, major", Crest{Trigger: "attack", EffectType: "might_multiplier", EffectValue: intPtr(2),
+			MajorRate: "dex + lck", MinorRate: "dex"}, "Major", weapon, 20,
+			CombatValues{Attack: 40, Hit: 90, Avoid: 20, Critical: 10, AttackSpeed: 20}, 0},
+		{"rate capped at 100", Crest{Trigger: "any", EffectType: "hit_bonus", EffectValue: intPtr(15),
+			MajorRate: "str * 10", MinorRate: "str"}, "Major", weapon, 100,
+			CombatValues{Attack: 30, Hit: 105, Avoid: 20, Critical: 10, AttackSpeed: 20}, 0},
+		{"trigger not matched", Crest{Trigger: "spell", EffectType: "heal_percent", EffectValue: intPtr(30),
+			MajorRate: "50", MinorRate: "25"}, "Minor", weapon, 0, forecast.Combat, 30},
+		{"combat art", Crest{Trigger: "combat_art", EffectType: "critical_bonus", EffectValue: intPtr(20),
+			MajorRate: "lv", MinorRate: "lv / 2"}, "Minor", attackSource{might: 10, combatArt: true}, 5,
+			CombatValues{Attack: 30, Hit: 90, Avoid: 20, Critical: 30, AttackSpeed: 20}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := crestForecast(&test.crest, test.strength, forecast, test.source)
+			if result.ActivationRate != test.rate {
+				t.Errorf("activation rate %d, want %d", result.ActivationRate, test.rate)
+			}
+			if result.Activated != test.combat {
+				t.Errorf("activated %+v, want %+v", result.Activated, test.combat)
+			}
+			if result.HealPercent != test.heal {
+				t.Errorf("heal percent %d, want %d", result.HealPercent, test.heal)
+			}
+		})
+	}
+}
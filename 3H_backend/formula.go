@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// formulaVariables are the identifiers a formula may use: the unit's level
+// and its stats, in the order of the class stat arrays
+var formulaVariables = []string{"lv", "hp", "str", "mag", "dex", "spd", "lck", "def", "res", "cha"}
+
+// Formulas come from request bodies, and the parser recurses once per
+// parenthesis or unary minus, so both the length and the nesting are bounded
+const (
+	maxFormulaLength = 200
+	maxFormulaDepth  = 16
+)
+
+// formula is a parsed arithmetic expression such as "(dex + lck) / 4 + 5".
+// It supports numbers, the formulaVariables, + - * / and parentheses.
+type formula struct {
+	root formulaNode
+}
+
+type formulaNode interface {
+	eval(vars map[string]float64) float64
+}
+
+type formulaNumber float64
+
+type formulaVariable string
+
+type formulaUnary struct {
+	operand formulaNode
+}
+
+type formulaBinary struct {
+	op          byte
+	left, right formulaNode
+}
+
+func (n formulaNumber) eval(vars map[string]float64) float64 {
+	return float64(n)
+}
+
+func (n formulaVariable) eval(vars map[string]float64) float64 {
+	return vars[string(n)]
+}
+
+func (n formulaUnary) eval(vars map[string]float64) float64 {
+	return -n.operand.eval(vars)
+}
+
+func (n formulaBinary) eval(vars map[string]float64) float64 {
+	left, right := n.left.eval(vars), n.right.eval(vars)
+	switch n.op {
+	case '+':
+		return left + right
+	case '-':
+		return left - right
+	case '*':
+		return left * right
+	}
+	if right == 0 {
+		return 0
+	}
+	return left / right
+}
+
+// Eval computes the formula; division by zero yields 0
+func (f *formula) Eval(vars map[string]float64) float64 {
+	return f.root.eval(vars)
+}
+
+func parseFormula(source string) (*formula, error) {
+	if len(source) > maxFormulaLength {
+		return nil, fmt.Errorf("longer than %d characters", maxFormulaLength)
+	}
+	p := &formulaParser{source: source}
+	root, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.source) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.source[p.pos], p.pos+1)
+	}
+	return &formula{root: root}, nil
+}
+
+// formulaParser is a recursive descent parser of the grammar
+//
+//	expression = term { ("+" | "-") term }
+//	term       = factor { ("*" | "/") factor }
+//	factor     = number | variable | "(" expression ")" | "-" factor
+type formulaParser struct {
+	source string
+	pos    int
+	depth  int
+}
+
+func (p *formulaParser) skipSpaces() {
+	for p.pos < len(p.source) && p.source[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *formulaParser) peek() byte {
+	p.skipSpaces()
+	if p.pos < len(p.source) {
+		return p.source[p.pos]
+	}
+	return 0
+}
+
+func (p *formulaParser) parseExpression() (formulaNode, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = formulaBinary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *formulaParser) parseTerm() (formulaNode, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = formulaBinary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *formulaParser) parseFactor() (formulaNode, error) {
+	c := p.peek()
+	if c == '-' || c == '(' {
+		if p.depth == maxFormulaDepth {
+			return nil, fmt.Errorf("nested deeper than %d levels at position %d", maxFormulaDepth, p.pos+1)
+		}
+		p.depth++
+		defer func() { p.depth-- }()
+	}
+
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of formula")
+	case c == '-':
+		p.pos++
+		operand, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return formulaUnary{operand: operand}, nil
+	case c == '(':
+		p.pos++
+		inner, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ) at position %d", p.pos+1)
+		}
+		p.pos++
+		return inner, nil
+	case c == '.' || unicode.IsDigit(rune(c)):
+		start := p.pos
+		for p.pos < len(p.source) && (p.source[p.pos] == '.' || unicode.IsDigit(rune(p.source[p.pos]))) {
+			p.pos++
+		}
+		value, err := strconv.ParseFloat(p.source[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", p.source[start:p.pos])
+		}
+		return formulaNumber(value), nil
+	case unicode.IsLetter(rune(c)):
+		start := p.pos
+		for p.pos < len(p.source) && unicode.IsLetter(rune(p.source[p.pos])) {
+			p.pos++
+		}
+		name := strings.ToLower(p.source[start:p.pos])
+		for _, variable := range formulaVariables {
+			if name == variable {
+				return formulaVariable(name), nil
+			}
+		}
+		return nil, fmt.Errorf("unknown variable %q, expected one of %s", name, strings.Join(formulaVariables, ", "))
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", c, p.pos+1)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseFormula(t *testing.T) {
+	vars := map[string]float64{"lv": 10, "str": 20, "dex": 12, "lck": 8, "spd": 0}
+
+	tests := []struct {
+		source string
+		want   float64
+	}{
+		{"5", 5},
+		{"1.5", 1.5},
+		{"str", 20},
+		{"STR", 20},
+		{"(dex + lck) / 4 + 5", 10},
+		{"dex + lck / 4", 14},
+		{"2 * 3 + 4", 10},
+		{"2 * (3 + 4)", 14},
+		{"10 - 3 - 2", 5},
+		{"16 / 4 / 2", 2},
+		{"-str + 25", 5},
+		{"--5", 5},
+		{"-(lv - 15)", 5},
+		{"str / spd", 0},
+		{"  lv*2  ", 20},
+		{"hp", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			f, err := parseFormula(test.source)
+			if err != nil {
+				t.Fatalf("parseFormula(%q) error: %v", test.source, err)
+			}
+			if got := f.Eval(vars); math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("Eval(%q) = %v, want %v", test.source, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseFormulaErrors(t *testing.T) {
+	for _, source := range []string{
+		"",
+		"   ",
+		"str +",
+		"(str + 2",
+		"str + 2)",
+		"str 2",
+		"atk + 2",
+		"1..2",
+		"str % 2",
+		"()",
+	} {
+		t.Run(source, func(t *testing.T) {
+			if _, err := parseFormula(source); err == nil {
+				t.Errorf("parseFormula(%q) succeeded, want an error", source)
+			}
+		})
+	}
+}
+
+func TestParseFormulaLimits(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat("(", depth) + "str" + strings.Repeat(")", depth)
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		valid  bool
+	}{
+		{"longest", "1" + strings.Repeat(" + 1", (maxFormulaLength-1)/4), true},
+		{"too long", strings.Repeat(" ", maxFormulaLength) + "1", false},
+		{"deepest parentheses", nested(maxFormulaDepth), true},
+		{"parentheses too deep", nested(maxFormulaDepth + 1), false},
+		{"deepest minus", strings.Repeat("-", maxFormulaDepth) + "5", true},
+		{"minus too deep", strings.Repeat("-", maxFormulaDepth+1) + "5", false},
+		{"huge body", strings.Repeat("(", 4_000_000), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseFormula(test.source)
+			if test.valid && err != nil {
+				t.Errorf("parseFormula error: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Errorf("parseFormula succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type GambitController struct {
+	db *sql.DB
+}
+
+func NewGambitController(db *sql.DB) *GambitController {
+	return &GambitController{
+		db: db,
+	}
+}
+
+func (cc *GambitController) GetAll(w http.ResponseWriter, r *http.Request) {
+	gambits, err := cc.getAllGambits()
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting gambits: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, gambits)
+}
+
+func (cc *GambitController) getAllGambits() ([]Gambit, error) {
+	rows, err := cc.db.Query("SELECT * FROM gambits")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gambits []Gambit
+
+	for rows.Next() {
+		var gambit Gambit
+		err := rows.Scan(gambitColumns(&gambit)...)
+		if err != nil {
+			return nil, err
+		}
+		gambits = append(gambits, gambit)
+	}
+
+	return gambits, nil
+}
+
+// gambitColumns returns the scan targets of a gambits row in column order
+func gambitColumns(gambit *Gambit) []interface{} {
+	return []interface{}{&gambit.ID, &gambit.Name, &gambit.Might, &gambit.Hit, &gambit.RangeMin,
+		&gambit.RangeMax, &gambit.Uses, &gambit.Area, &gambit.Effect, &gambit.Description,
+		&gambit.CreatedAt, &gambit.UpdatedAt}
+}
+
+func (cc *GambitController) GetOne(w http.ResponseWriter, r *http.Request) {
+	gambitID := mux.Vars(r)["gambitID"]
+	id, err := strconv.Atoi(gambitID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid gambit ID"))
+		return
+	}
+
+	gambit, err := cc.getGambitByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting gambit: %w", err))
+		return
+	}
+
+	if gambit == nil {
+		writeError(w, r, NotFound("Gambit not found"))
+		return
+	}
+
+	if writeNotModified(w, r, etagFor(gambit.ID, gambit.UpdatedAt)) {
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, gambit)
+}
+
+func (cc *GambitController) getGambitByID(id int) (*Gambit, error) {
+	row := cc.db.QueryRow("SELECT * FROM gambits WHERE id = $1", id)
+
+	var gambit Gambit
+	err := row.Scan(gambitColumns(&gambit)...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &gambit, nil
+}
+
+func (cc *GambitController) PostOne(w http.ResponseWriter, r *http.Request) {
+	var gambit Gambit
+	err := decodeJSON(r, &gambit)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
+		return
+	}
+
+	err = gambit.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	gambit.CreatedAt = time.Now()
+	gambit.UpdatedAt = time.Now()
+
+	err = cc.insertGambit(&gambit)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error inserting gambit: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(gambit.ID, gambit.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, gambit)
+}
+
+func (cc *GambitController) insertGambit(gambit *Gambit) error {
+	err := cc.db.QueryRow(`
+		INSERT INTO gambits (name, might, hit, range_min, range_max, uses, area, effect,
+			description, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, created_at, updated_at
+	`, gambit.Name, gambit.Might, gambit.Hit, gambit.RangeMin, gambit.RangeMax, gambit.Uses,
+		gambit.Area, gambit.Effect, gambit.Description, gambit.CreatedAt, gambit.UpdatedAt).Scan(
+		&gambit.ID, &gambit.CreatedAt, &gambit.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cc *GambitController) PutOne(w http.ResponseWriter, r *http.Request) {
+	gambitID := mux.Vars(r)["gambitID"]
+	id, err := strconv.Atoi(gambitID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid gambit ID"))
+		return
+	}
+
+	var updatedGambit Gambit
+	err = decodeJSON(r, &updatedGambit)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
+		return
+	}
+
+	err = updatedGambit.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	current, err := cc.getGambitByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting gambit: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Gambit not found"))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedGambit.UpdatedAt = time.Now()
+
+	err = cc.updateGambit(id, &updatedGambit, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating gambit: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedGambit.ID, updatedGambit.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedGambit)
+}
+
+func (cc *GambitController) PatchOne(w http.ResponseWriter, r *http.Request) {
+	gambitID := mux.Vars(r)["gambitID"]
+	id, err := strconv.Atoi(gambitID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid gambit ID"))
+		return
+	}
+
+	updatedGambit, err := cc.getGambitByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting gambit: %w", err))
+		return
+	}
+
+	if updatedGambit == nil {
+		writeError(w, r, NotFound("Gambit not found"))
+		return
+	}
+
+	version := updatedGambit.UpdatedAt
+	err = checkIfMatch(r, etagFor(updatedGambit.ID, version))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = applyMergePatch(r, updatedGambit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = updatedGambit.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedGambit.UpdatedAt = time.Now()
+
+	err = cc.updateGambit(id, updatedGambit, version)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating gambit: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedGambit.ID, updatedGambit.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedGambit)
+}
+
+func (cc *GambitController) updateGambit(id int, updatedGambit *Gambit, version time.Time) error {
+	// Every column is written so that PUT replaces the whole gambit. The row is
+	// only updated if it has not changed since version was read.
+	err := cc.db.QueryRow(`
+		UPDATE gambits SET name = $1, might = $2, hit = $3, range_min = $4, range_max = $5,
+			uses = $6, area = $7, effect = $8, description = $9, updated_at = $10
+		WHERE id = $11 AND updated_at = $12
+		RETURNING *
+	`, updatedGambit.Name, updatedGambit.Might, updatedGambit.Hit, updatedGambit.RangeMin,
+		updatedGambit.RangeMax, updatedGambit.Uses, updatedGambit.Area, updatedGambit.Effect,
+		updatedGambit.Description, updatedGambit.UpdatedAt, id, version).Scan(gambitColumns(updatedGambit)...)
+
+	if err == sql.ErrNoRows {
+		return Conflict("Gambit with ID %d was modified or deleted by another request", id)
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cc *GambitController) DeleteOne(w http.ResponseWriter, r *http.Request) {
+	gambitID := mux.Vars(r)["gambitID"]
+	id, err := strconv.Atoi(gambitID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid gambit ID"))
+		return
+	}
+
+	current, err := cc.getGambitByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting gambit: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Gambit with ID %d not found", id))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = cc.deleteGambit(id, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error deleting gambit: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, deleteResult{Success: true, Msg: "Gambit deleted successfully."})
+}
+
+func (cc *GambitController) deleteGambit(id int, version time.Time) error {
+	// Only delete the row if it has not changed since version was read
+	result, err := cc.db.Exec("DELETE FROM gambits WHERE id = $1 AND updated_at = $2", id, version)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return Conflict("Gambit with ID %d was modified or deleted by another request", id)
+	}
+
+	return nil
+}
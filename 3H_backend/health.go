@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// seededTables must contain at least one row for the API to be useful
+var seededTables = []string{"characters", "classes", "skills", "spells", "combat_arts", "weapons"}
+
+type HealthController struct {
+	db      *sql.DB
+	started time.Time
+	timeout time.Duration
+}
+
+func NewHealthController(db *sql.DB) *HealthController {
+	return &HealthController{
+		db:      db,
+		started: time.Now(),
+		timeout: 2 * time.Second,
+	}
+}
+
+type healthCheck struct {
+	Status  string   `json:"status"`
+	Error   string   `json:"error,omitempty"`
+	Details []string `json:"details,omitempty"`
+}
+
+type healthResponse struct {
+	Status        string                 `json:"status"`
+	UptimeSeconds int64                  `json:"uptime_seconds"`
+	Checks        map[string]healthCheck `json:"checks,omitempty"`
+}
+
+// Liveness reports that the process is up and serving requests. It does not
+// touch the database so that a database outage does not get the process
+// restarted.
+func (hc *HealthController) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, healthResponse{
+		Status:        "ok",
+		UptimeSeconds: int64(time.Since(hc.started).Seconds()),
+	})
+}
+
+// Readiness reports whether the database is reachable, fully migrated and
+// seeded. It answers 503 when any check fails.
+func (hc *HealthController) Readiness(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), hc.timeout)
+	defer cancel()
+
+	checks := map[string]healthCheck{
+		"database": hc.checkDatabase(ctx),
+	}
+	if checks["database"].Status == "ok" {
+		checks["migrations"] = hc.checkMigrations(ctx)
+		checks["seed_data"] = hc.checkSeedData(ctx)
+	}
+
+	response := healthResponse{
+		Status:        "ok",
+		UptimeSeconds: int64(time.Since(hc.started).Seconds()),
+		Checks:        checks,
+	}
+	status := http.StatusOK
+	for _, check := range checks {
+		if check.Status != "ok" {
+			response.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, status, response)
+}
+
+// failing logs the error of a check and reports it without the database
+// details, as the readiness endpoint is not authenticated
+func failing(ctx context.Context, check string, err error) healthCheck {
+	loggerFrom(ctx).Warn("readiness check failed", slog.String("check", check), slog.String("error", err.Error()))
+	return healthCheck{Status: "failing"}
+}
+
+func (hc *HealthController) checkDatabase(ctx context.Context) healthCheck {
+	err := hc.db.PingContext(ctx)
+	if err != nil {
+		return failing(ctx, "database", err)
+	}
+	return healthCheck{Status: "ok"}
+}
+
+func (hc *HealthController) checkMigrations(ctx context.Context) healthCheck {
+	pending, err := pendingMigrations(ctx, hc.db)
+	if err != nil {
+		return failing(ctx, "migrations", err)
+	}
+
+	if len(pending) > 0 {
+		check := healthCheck{Status: "failing", Error: "migrations pending"}
+		for _, m := range pending {
+			check.Details = append(check.Details, fmt.Sprintf("%d_%s", m.version, m.name))
+		}
+		return check
+	}
+	return healthCheck{Status: "ok"}
+}
+
+func (hc *HealthController) checkSeedData(ctx context.Context) healthCheck {
+	var empty []string
+	for _, table := range seededTables {
+		var exists bool
+		err := hc.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM "+table+")").Scan(&exists)
+		if err != nil {
+			return failing(ctx, "seed_data", err)
+		}
+		if !exists {
+			empty = append(empty, table)
+		}
+	}
+
+	if len(empty) > 0 {
+		return healthCheck{Status: "failing", Error: "tables without data", Details: empty}
+	}
+	return healthCheck{Status: "ok"}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// inventorySlots is the number of items and weapons a character can carry,
+// besides the shield or ring equipped in the accessory slot
+const inventorySlots = 6
+
+// Inventory is what a character carries
+type Inventory struct {
+	CharacterID int              `json:"character_id"`
+	Slots       int              `json:"slots"`
+	Used        int              `json:"used"`
+	Entries     []InventoryEntry `json:"entries"`
+}
+
+type InventoryController struct {
+	db *sql.DB
+}
+
+func NewInventoryController(db *sql.DB) *InventoryController {
+	return &InventoryController{
+		db: db,
+	}
+}
+
+// GetAll lists the inventory of a character
+func (cc *InventoryController) GetAll(w http.ResponseWriter, r *http.Request) {
+	charID, err := strconv.Atoi(mux.Vars(r)["charID"])
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid character ID"))
+		return
+	}
+
+	character, err := NewCharacterController(cc.db).getCharacterByID(charID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting character: %w", err))
+		return
+	}
+
+	if character == nil {
+		writeError(w, r, NotFound("Character not found"))
+		return
+	}
+
+	entries, err := cc.getInventory(charID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting inventory: %w", err))
+		return
+	}
+
+	inventory := Inventory{CharacterID: charID, Slots: inventorySlots, Entries: entries}
+	for _, entry := range entries {
+		if !entry.Equipped {
+			inventory.Used++
+		}
+	}
+
+	writeJSON(w, r, http.StatusOK, inventory)
+}
+
+func (cc *InventoryController) getInventory(charID int) ([]InventoryEntry, error) {
+	rows, err := cc.db.Query("SELECT * FROM inventory WHERE char_id = $1 ORDER BY id", charID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []InventoryEntry{}
+
+	for rows.Next() {
+		var entry InventoryEntry
+		err := rows.Scan(inventoryColumns(&entry)...)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// inventoryColumns returns the scan targets of an inventory row in column order
+func inventoryColumns(entry *InventoryEntry) []interface{} {
+	return []interface{}{&entry.ID, &entry.CharID, &entry.ItemID, &entry.WeaponID, &entry.Uses,
+		&entry.Equipped, &entry.CreatedAt, &entry.UpdatedAt}
+}
+
+func (cc *InventoryController) getEntry(charID, id int) (*InventoryEntry, error) {
+	row := cc.db.QueryRow("SELECT * FROM inventory WHERE id = $1 AND char_id = $2", id, charID)
+
+	var entry InventoryEntry
+	err := row.Scan(inventoryColumns(&entry)...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// PostOne puts an item or a weapon in the inventory of a character
+func (cc *InventoryController) PostOne(w http.ResponseWriter, r *http.Request) {
+	charID, err := strconv.Atoi(mux.Vars(r)["charID"])
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid character ID"))
+		return
+	}
+
+	var entry InventoryEntry
+	err = decodeJSON(r, &entry)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
+		return
+	}
+
+	err = cc.validate(&entry)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	entry.CharID = charID
+	entry.CreatedAt = time.Now()
+	entry.UpdatedAt = time.Now()
+
+	err = cc.insertEntry(&entry)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error adding to inventory: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(entry.ID, entry.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, entry)
+}
+
+// validate checks the entry and the item or weapon it references. Only a
+// shield or a ring can be equipped; Uses defaults to those of a new item or
+// to the durability of the weapon, and cannot exceed them.
+func (cc *InventoryController) validate(entry *InventoryEntry) error {
+	err := entry.Validate()
+	if err != nil {
+		return err
+	}
+
+	if entry.ItemID != nil {
+		item, err := NewItemController(cc.db).getItemByID(*entry.ItemID)
+		if err != nil {
+			return fmt.Errorf("error getting item: %w", err)
+		}
+		if item == nil {
+			return ValidationErrors{{Field: "item_id", Message: "must reference an item"}}
+		}
+		if entry.Equipped && item.Category != "shield" && item.Category != "ring" {
+			return ValidationErrors{{Field: "equipped", Message: "only a shield or a ring can be equipped"}}
+		}
+		if entry.Uses == nil {
+			entry.Uses = item.Uses
+		}
+		return checkUses(entry.Uses, item.Uses)
+	}
+
+	weapon, err := NewWeaponsController(cc.db).getWeaponByID(*entry.WeaponID)
+	if err != nil {
+		return fmt.Errorf("error getting weapon: %w", err)
+	}
+	if weapon == nil {
+		return ValidationErrors{{Field: "weapon_id", Message: "must reference a weapon"}}
+	}
+	if entry.Uses == nil {
+		entry.Uses = &weapon.Durability
+	}
+	return checkUses(entry.Uses, &weapon.Durability)
+}
+
+// checkUses checks the uses left of an entry against those of a new item or
+// weapon, limit; items without uses, such as rings, cannot have any left
+func checkUses(uses, limit *int) error {
+	switch {
+	case uses == nil:
+		return nil
+	case limit == nil:
+		return ValidationErrors{{Field: "uses", Message: "must be null for an item without uses"}}
+	case *uses > *limit:
+		return ValidationErrors{{Field: "uses", Message: fmt.Sprintf("must be at most %d", *limit)}}
+	}
+	return nil
+}
+
+func (cc *InventoryController) insertEntry(entry *InventoryEntry) error {
+	tx, err := cc.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockSlots(tx, entry, 0)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO inventory (char_id, item_id, weapon_id, uses, equipped, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at
+	`, entry.CharID, entry.ItemID, entry.WeaponID, entry.Uses, entry.Equipped, entry.CreatedAt,
+		entry.UpdatedAt).Scan(&entry.ID, &entry.CreatedAt, &entry.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockSlots locks the character of the entry, so that concurrent requests
+// cannot both take its last slot, and checks that the entry fits in its
+// inventory once the entry with ID replacing, if any, is taken out
+func lockSlots(tx *sql.Tx, entry *InventoryEntry, replacing int) error {
+	var id int
+	err := tx.QueryRow("SELECT id FROM characters WHERE id = $1 FOR UPDATE", entry.CharID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return NotFound("Character not found")
+	} else if err != nil {
+		return err
+	}
+
+	var carried, equipped int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE NOT equipped), COUNT(*) FILTER (WHERE equipped)
+		FROM inventory WHERE char_id = $1 AND id <> $2
+	`, entry.CharID, replacing).Scan(&carried, &equipped)
+	if err != nil {
+		return err
+	}
+
+	return checkSlots(entry, carried, equipped)
+}
+
+// checkSlots checks that the entry fits next to the carried entries and the
+// equipped accessory already in the inventory
+func checkSlots(entry *InventoryEntry, carried, equipped int) error {
+	if entry.Equipped && equipped > 0 {
+		return Conflict("Character %d already has an accessory equipped", entry.CharID)
+	}
+	if !entry.Equipped && carried >= inventorySlots {
+		return Conflict("The inventory of character %d is full (%d slots)", entry.CharID, inventorySlots)
+	}
+
+	return nil
+}
+
+// PutOne replaces an entry of the inventory, for instance to equip it or to
+// record the uses left
+func (cc *InventoryController) PutOne(w http.ResponseWriter, r *http.Request) {
+	charID, err := strconv.Atoi(mux.Vars(r)["charID"])
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid character ID"))
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["entryID"])
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid inventory entry ID"))
+		return
+	}
+
+	var updatedEntry InventoryEntry
+	err = decodeJSON(r, &updatedEntry)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
+		return
+	}
+
+	err = cc.validate(&updatedEntry)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	current, err := cc.getEntry(charID, id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting inventory entry: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Inventory entry not found"))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedEntry.CharID = charID
+	updatedEntry.UpdatedAt = time.Now()
+
+	err = cc.updateEntry(id, &updatedEntry, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating inventory entry: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedEntry.ID, updatedEntry.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedEntry)
+}
+
+// PatchOne partially updates an entry of the inventory
+func (cc *InventoryController) PatchOne(w http.ResponseWriter, r *http.Request) {
+	charID, err := strconv.Atoi(mux.Vars(r)["charID"])
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid character ID"))
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["entryID"])
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid inventory entry ID"))
+		return
+	}
+
+	updatedEntry, err := cc.getEntry(charID, id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting inventory entry: %w", err))
+		return
+	}
+
+	if updatedEntry == nil {
+		writeError(w, r, NotFound("Inventory entry not found"))
+		return
+	}
+
+	version := updatedEntry.UpdatedAt
+	err = checkIfMatch(r, etagFor(updatedEntry.ID, version))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = applyMergePatch(r, updatedEntry)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = cc.validate(updatedEntry)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedEntry.CharID = charID
+	updatedEntry.UpdatedAt = time.Now()
+
+	err = cc.updateEntry(id, updatedEntry, version)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating inventory entry: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedEntry.ID, updatedEntry.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedEntry)
+}
+
+func (cc *InventoryController) updateEntry(id int, updatedEntry *InventoryEntry, version time.Time) error {
+	tx, err := cc.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockSlots(tx, updatedEntry, id)
+	if err != nil {
+		return err
+	}
+
+	// The row is only updated if it has not changed since version was read
+	err = tx.QueryRow(`
+		UPDATE inventory SET item_id = $1, weapon_id = $2, uses = $3, equipped = $4, updated_at = $5
+		WHERE id = $6 AND char_id = $7 AND updated_at = $8
+		RETURNING *
+	`, updatedEntry.ItemID, updatedEntry.WeaponID, updatedEntry.Uses, updatedEntry.Equipped,
+		updatedEntry.UpdatedAt, id, updatedEntry.CharID, version).Scan(inventoryColumns(updatedEntry)...)
+
+	if err == sql.ErrNoRows {
+		return Conflict("Inventory entry with ID %d was modified or deleted by another request", id)
+	} else if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteOne takes an entry out of the inventory of a character
+func (cc *InventoryController) DeleteOne(w http.ResponseWriter, r *http.Request) {
+	charID, err := strconv.Atoi(mux.Vars(r)["charID"])
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid character ID"))
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["entryID"])
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid inventory entry ID"))
+		return
+	}
+
+	current, err := cc.getEntry(charID, id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting inventory entry: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Inventory entry with ID %d not found", id))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = cc.deleteEntry(id, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error deleting inventory entry: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, deleteResult{Success: true, Msg: "Inventory entry deleted successfully."})
+}
+
+func (cc *InventoryController) deleteEntry(id int, version time.Time) error {
+	// Only delete the row if it has not changed since version was read
+	result, err := cc.db.Exec("DELETE FROM inventory WHERE id = $1 AND updated_at = $2", id, version)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return Conflict("Inventory entry with ID %d was modified or deleted by another request", id)
+	}
+
+	return nil
+}
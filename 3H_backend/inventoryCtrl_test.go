@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestCheckUses(t *testing.T) {
+	tests := []struct {
+		name        string
+		uses, limit *int
+		valid       bool
+	}{
+		{"no uses left to check", nil, intPtr(3), true},
+		{"within the limit", intPtr(2), intPtr(3), true},
+		{"at the limit", intPtr(3), intPtr(3), true},
+		{"above the limit", intPtr(4), intPtr(3), false},
+		{"item without uses", intPtr(1), nil, false},
+		{"item without uses, none given", nil, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkUses(test.uses, test.limit)
+			if (err == nil) != test.valid {
+				t.Errorf("checkUses error = %v, want valid %t", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestCheckSlots(t *testing.T) {
+	tests := []struct {
+		name                 string
+		equipped             bool
+		carried, accessories int
+		valid                bool
+	}{
+		{"empty inventory", false, 0, 0, true},
+		{"last slot", false, inventorySlots - 1, 1, true},
+		{"full inventory", false, inventorySlots, 0, false},
+		{"accessory next to a full inventory", true, inventorySlots, 0, true},
+		{"second accessory", true, 0, 1, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry := &InventoryEntry{CharID: 1, Equipped: test.equipped}
+			err := checkSlots(entry, test.carried, test.accessories)
+			if (err == nil) != test.valid {
+				t.Errorf("checkSlots error = %v, want valid %t", err, test.valid)
+			}
+			if err != nil && err.(*APIError).Code != CodeConflict {
+				t.Errorf("checkSlots error code = %s, want %s", err.(*APIError).Code, CodeConflict)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type ItemController struct {
+	db *sql.DB
+}
+
+func NewItemController(db *sql.DB) *ItemController {
+	return &ItemController{
+		db: db,
+	}
+}
+
+// GetAll lists the items, only those of the category query parameter when
+// present
+func (cc *ItemController) GetAll(w http.ResponseWriter, r *http.Request) {
+	category := r.URL.Query().Get("category")
+	if category != "" && !slices.Contains(validItemCategories, category) {
+		writeError(w, r, BadRequest("Unknown item category %q", category))
+		return
+	}
+
+	items, err := cc.getAllItems(category)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting items: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, items)
+}
+
+func (cc *ItemController) getAllItems(category string) ([]Item, error) {
+	rows, err := cc.db.Query("SELECT * FROM items WHERE $1 = '' OR category = $1 ORDER BY id", category)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []Item
+
+	for rows.Next() {
+		var item Item
+		err := rows.Scan(itemColumns(&item)...)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// itemColumns returns the scan targets of an items row in column order
+func itemColumns(item *Item) []interface{} {
+	return []interface{}{&item.ID, &item.Name, &item.Category, &item.Uses, jsonColumn{&item.Effects},
+		&item.Description, &item.CreatedAt, &item.UpdatedAt}
+}
+
+func (cc *ItemController) GetOne(w http.ResponseWriter, r *http.Request) {
+	itemID := mux.Vars(r)["itemID"]
+	id, err := strconv.Atoi(itemID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid item ID"))
+		return
+	}
+
+	item, err := cc.getItemByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting item: %w", err))
+		return
+	}
+
+	if item == nil {
+		writeError(w, r, NotFound("Item not found"))
+		return
+	}
+
+	if writeNotModified(w, r, etagFor(item.ID, item.UpdatedAt)) {
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, item)
+}
+
+func (cc *ItemController) getItemByID(id int) (*Item, error) {
+	row := cc.db.QueryRow("SELECT * FROM items WHERE id = $1", id)
+
+	var item Item
+	err := row.Scan(itemColumns(&item)...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+func (cc *ItemController) PostOne(w http.ResponseWriter, r *http.Request) {
+	var item Item
+	err := decodeJSON(r, &item)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
+		return
+	}
+
+	err = item.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	item.CreatedAt = time.Now()
+	item.UpdatedAt = time.Now()
+
+	err = cc.insertItem(&item)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error inserting item: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(item.ID, item.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, item)
+}
+
+func (cc *ItemController) insertItem(item *Item) error {
+	if item.Effects == nil {
+		item.Effects = []ItemEffect{}
+	}
+
+	err := cc.db.QueryRow(`
+		INSERT INTO items (name, category, uses, effects, description, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at
+	`, item.Name, item.Category, item.Uses, jsonColumn{item.Effects}, item.Description,
+		item.CreatedAt, item.UpdatedAt).Scan(&item.ID, &item.CreatedAt, &item.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cc *ItemController) PutOne(w http.ResponseWriter, r *http.Request) {
+	itemID := mux.Vars(r)["itemID"]
+	id, err := strconv.Atoi(itemID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid item ID"))
+		return
+	}
+
+	var updatedItem Item
+	err = decodeJSON(r, &updatedItem)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
+		return
+	}
+
+	err = updatedItem.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	current, err := cc.getItemByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting item: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Item not found"))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedItem.UpdatedAt = time.Now()
+
+	err = cc.updateItem(id, &updatedItem, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating item: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedItem.ID, updatedItem.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedItem)
+}
+
+func (cc *ItemController) PatchOne(w http.ResponseWriter, r *http.Request) {
+	itemID := mux.Vars(r)["itemID"]
+	id, err := strconv.Atoi(itemID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid item ID"))
+		return
+	}
+
+	updatedItem, err := cc.getItemByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting item: %w", err))
+		return
+	}
+
+	if updatedItem == nil {
+		writeError(w, r, NotFound("Item not found"))
+		return
+	}
+
+	version := updatedItem.UpdatedAt
+	err = checkIfMatch(r, etagFor(updatedItem.ID, version))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = applyMergePatch(r, updatedItem)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = updatedItem.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedItem.UpdatedAt = time.Now()
+
+	err = cc.updateItem(id, updatedItem, version)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating item: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedItem.ID, updatedItem.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedItem)
+}
+
+func (cc *ItemController) updateItem(id int, updatedItem *Item, version time.Time) error {
+	if updatedItem.Effects == nil {
+		updatedItem.Effects = []ItemEffect{}
+	}
+
+	// Every column is written so that PUT replaces the whole item. The row is
+	// only updated if it has not changed since version was read.
+	err := cc.db.QueryRow(`
+		UPDATE items SET name = $1, category = $2, uses = $3, effects = $4, description = $5,
+			updated_at = $6
+		WHERE id = $7 AND updated_at = $8
+		RETURNING *
+	`, updatedItem.Name, updatedItem.Category, updatedItem.Uses, jsonColumn{updatedItem.Effects},
+		updatedItem.Description, updatedItem.UpdatedAt, id, version).Scan(itemColumns(updatedItem)...)
+
+	if err == sql.ErrNoRows {
+		return Conflict("Item with ID %d was modified or deleted by another request", id)
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cc *ItemController) DeleteOne(w http.ResponseWriter, r *http.Request) {
+	itemID := mux.Vars(r)["itemID"]
+	id, err := strconv.Atoi(itemID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid item ID"))
+		return
+	}
+
+	current, err := cc.getItemByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting item: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Item with ID %d not found", id))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = cc.deleteItem(id, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error deleting item: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, deleteResult{Success: true, Msg: "Item deleted successfully."})
+}
+
+func (cc *ItemController) deleteItem(id int, version time.Time) error {
+	// Only delete the row if it has not changed since version was read
+	result, err := cc.db.Exec("DELETE FROM items WHERE id = $1 AND updated_at = $2", id, version)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return Conflict("Item with ID %d was modified or deleted by another request", id)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// jsonColumn maps a JSONB column to a Go value. Wrap a pointer to scan,
+// jsonColumn{&weapon.Effects}, and the value itself to write,
+// jsonColumn{weapon.Effects}. NULL and nil are mapped to each other.
+type jsonColumn struct {
+	v interface{}
+}
+
+func (c jsonColumn) Scan(src interface{}) error {
+	target := reflect.ValueOf(c.v)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("jsonColumn: cannot scan into %T", c.v)
+	}
+
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		target.Elem().Set(reflect.Zero(target.Elem().Type()))
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("jsonColumn: cannot scan %T", src)
+	}
+	return json.Unmarshal(data, c.v)
+}
+
+func (c jsonColumn) Value() (driver.Value, error) {
+	value := reflect.ValueOf(c.v)
+	switch value.Kind() {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Pointer, reflect.Slice, reflect.Map:
+		if value.IsNil() {
+			return nil, nil
+		}
+	}
+	return json.Marshal(c.v)
+}
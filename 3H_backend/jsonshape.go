@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Clients written against the untagged models can ask for the legacy JSON
+// shape, in which model fields use their Go names ("HpGrowth") and only the
+// timestamps are snake_case, with ?shape=legacy or the jsonShapeHeader. The
+// unversioned routes always use it.
+const (
+	jsonShapeHeader = "X-JSON-Shape"
+	jsonShapeParam  = "shape"
+	legacyShape     = "legacy"
+)
+
+const legacyShapeKey contextKey = "legacyShape"
+
+// legacyModels are the types that existed before the JSON contract was
+// tagged. Other types, such as error bodies, always had snake_case names.
+var legacyModels = map[reflect.Type]bool{
+	reflect.TypeOf(Character{}):  true,
+	reflect.TypeOf(Spells{}):     true,
+	reflect.TypeOf(Skills{}):     true,
+	reflect.TypeOf(CombatArts{}): true,
+	reflect.TypeOf(Weapons{}):    true,
+	reflect.TypeOf(CharSkill{}):  true,
+	reflect.TypeOf(Classes{}):    true,
+}
+
+// legacyShapeMiddleware makes every request of a router use the legacy shape
+func legacyShapeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), legacyShapeKey, true)))
+	})
+}
+
+// wantsLegacyShape reports whether the request and its response use the
+// legacy JSON shape
+func wantsLegacyShape(r *http.Request) bool {
+	if legacy, _ := r.Context().Value(legacyShapeKey).(bool); legacy {
+		return true
+	}
+	return r.URL.Query().Get(jsonShapeParam) == legacyShape || r.Header.Get(jsonShapeHeader) == legacyShape
+}
+
+// varyOnShape tells shared caches that the response depends on the JSON
+// shape header, once however many times it is called
+func varyOnShape(w http.ResponseWriter) {
+	for _, value := range w.Header().Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(name), jsonShapeHeader) {
+				return
+			}
+		}
+	}
+	w.Header().Add("Vary", jsonShapeHeader)
+}
+
+// legacyFieldName is the name a model field had before the JSON tags were
+// added: the Go name, except for the timestamps which were already tagged
+func legacyFieldName(field reflect.StructField) string {
+	if field.Type == timeType {
+		name, _ := jsonFieldName(field)
+		return name
+	}
+	return field.Name
+}
+
+// toLegacyShape converts models, wherever they are nested in v, into maps
+// keyed by the legacy field names. Values without models are returned as is.
+func toLegacyShape(v interface{}) interface{} {
+	return legacyValue(reflect.ValueOf(v))
+}
+
+func legacyValue(value reflect.Value) interface{} {
+	if !value.IsValid() {
+		return nil
+	}
+	if !containsLegacyModel(value.Type(), map[reflect.Type]bool{}) {
+		return value.Interface()
+	}
+
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return legacyValue(value.Elem())
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return nil
+		}
+		items := make([]interface{}, value.Len())
+		for i := range items {
+			items[i] = legacyValue(value.Index(i))
+		}
+		return items
+	case reflect.Map:
+		if value.IsNil() {
+			return nil
+		}
+		object := make(map[string]interface{}, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			object[fmt.Sprint(iter.Key().Interface())] = legacyValue(iter.Value())
+		}
+		return object
+	case reflect.Struct:
+		return legacyObject(value)
+	}
+	return value.Interface()
+}
+
+// legacyObject converts a struct into a map keyed as encoding/json would,
+// but with the legacy field names if it is a model
+func legacyObject(value reflect.Value) map[string]interface{} {
+	legacy := legacyModels[value.Type()]
+	object := make(map[string]interface{}, value.NumField())
+	var promoted []map[string]interface{}
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		switch {
+		case embeddedStruct(field):
+			// Like encoding/json, the fields of an embedded struct are
+			// promoted unless the outer struct has a field of that name
+			embedded := value.Field(i)
+			if embedded.Kind() == reflect.Pointer {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			promoted = append(promoted, legacyObject(embedded))
+		case !field.IsExported():
+		case legacy:
+			object[legacyFieldName(field)] = legacyValue(value.Field(i))
+		default:
+			name, omitempty := jsonFieldName(field)
+			if name != "-" && !(omitempty && value.Field(i).IsZero()) {
+				object[name] = legacyValue(value.Field(i))
+			}
+		}
+	}
+	for _, inner := range promoted {
+		for name, v := range inner {
+			if _, ok := object[name]; !ok {
+				object[name] = v
+			}
+		}
+	}
+	return object
+}
+
+// containsLegacyModel reports whether values of type t can hold a legacy
+// model, directly or nested in their fields, elements or pointers
+func containsLegacyModel(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if legacyModels[t] {
+		return true
+	}
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return containsLegacyModel(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if containsLegacyModel(t.Field(i).Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fromLegacyKeys renames the legacy members of a JSON object decoded for a
+// model of type t to the current names. Like encoding/json, legacy names
+// are matched case-insensitively.
+func fromLegacyKeys(t reflect.Type, object map[string]interface{}) map[string]interface{} {
+	if !legacyModels[t] {
+		return object
+	}
+
+	renamed := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		renamed[key] = value
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _ := jsonFieldName(field)
+		legacyName := legacyFieldName(field)
+		for key, value := range object {
+			if key != name && strings.EqualFold(key, legacyName) {
+				delete(renamed, key)
+				renamed[name] = value
+			}
+		}
+	}
+	return renamed
+}
+
+// decodeJSON decodes the request body into target, a pointer to a model,
+// accepting the legacy member names when the request uses the legacy shape.
+// Legacy bodies are decoded leniently, as the unversioned routes always
+// ignored the members a model does not have.
+func decodeJSON(r *http.Request, target interface{}) error {
+	limitBody(r)
+	if !wantsLegacyShape(r) {
+		return decodeStrict(r.Body, target)
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	var object map[string]interface{}
+	err = json.Unmarshal(body, &object)
+	if err != nil {
+		return err
+	}
+
+	body, err = json.Marshal(fromLegacyKeys(reflect.TypeOf(target).Elem(), object))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, target)
+}
+
+// maxBodyBytes bounds the size of the request bodies the API reads
+const maxBodyBytes = 1 << 20
+
+// limitBody makes reading more than maxBodyBytes of the body fail
+func limitBody(r *http.Request) {
+	r.Body = http.MaxBytesReader(nil, r.Body, maxBodyBytes)
+}
+
+// decodeStrict decodes a JSON body, rejecting members the model does not
+// have: PUT and POST replace every field, so a misspelt or wrongly shaped
+// member would otherwise silently zero the field it was meant for
+func decodeStrict(body io.Reader, target interface{}) error {
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(target)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToLegacyShapeCharacterWithCaps(t *testing.T) {
+	body := CharacterWithCaps{
+		Character: Character{ID: 3, Name: "Dimitri", HpGrowth: 55, UpdatedAt: time.Now()},
+		StatCaps:  applyCaps(Stats{HP: 28}, []int{20}),
+	}
+
+	object, ok := toLegacyShape(body).(map[string]interface{})
+	if !ok {
+		t.Fatalf("toLegacyShape returned %T, want a map", toLegacyShape(body))
+	}
+	for _, key := range []string{"ID", "Name", "HpGrowth", "updated_at", "stat_caps"} {
+		if _, ok := object[key]; !ok {
+			t.Errorf("missing key %q in %v", key, object)
+		}
+	}
+	for _, key := range []string{"Character", "hp_growth", "name"} {
+		if _, ok := object[key]; ok {
+			t.Errorf("unexpected key %q", key)
+		}
+	}
+}
+
+func TestETagWith(t *testing.T) {
+	etag := etagFor(3, time.UnixMicro(0x10))
+	if got, want := etagWith(etag, "caps"), `"3-10-caps"`; got != want {
+		t.Errorf("etagWith(%s, caps) = %s, want %s", etag, got, want)
+	}
+}
+
+func TestToLegacyShapeNestedModels(t *testing.T) {
+	body := []CharacterSupport{{
+		Support: Support{ID: 1, CharID: 3, PartnerID: 4, Ranks: []string{"C", "B"}},
+		Partner: Character{ID: 4, Name: "Dedue"},
+	}}
+
+	items, ok := toLegacyShape(body).([]interface{})
+	if !ok || len(items) != 1 {
+		t.Fatalf("toLegacyShape returned %#v", toLegacyShape(body))
+	}
+	object := items[0].(map[string]interface{})
+	for _, key := range []string{"id", "char_id", "partner_id", "ranks", "partner", "bonuses"} {
+		if _, ok := object[key]; !ok {
+			t.Errorf("missing key %q in %v", key, object)
+		}
+	}
+	partner, ok := object["partner"].(map[string]interface{})
+	if !ok || partner["Name"] != "Dedue" {
+		t.Errorf("partner = %#v, want the legacy shape", object["partner"])
+	}
+
+	// Values without models are left alone
+	stats := Stats{HP: 20}
+	if got := toLegacyShape(stats); got != stats {
+		t.Errorf("toLegacyShape(%v) = %v", stats, got)
+	}
+}
+
+func TestDecodeJSONUnknownFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		legacy bool
+		body   string
+		valid  bool
+	}{
+		{"current shape", false, `{"name": "Felix", "crest_id": 2}`, true},
+		{"legacy body on a versioned route", false, `{"Name": "Felix", "CrestID": 2}`, false},
+		{"legacy shape", true, `{"Name": "Felix", "CrestID": 2}`, true},
+		{"unknown member", false, `{"name": "Felix", "crest_id": 2, "crest": "Fraldarius"}`, false},
+		{"unknown legacy member is ignored", true, `{"Name": "Felix", "CrestID": 2, "Crest": "Fraldarius"}`, true},
+		{"too large", false, `{"name": "Felix", "crest_id": 2` + strings.Repeat(" ", maxBodyBytes) + `}`, false},
+		{"too large legacy", true, `{"Name": "Felix", "CrestID": 2` + strings.Repeat(" ", maxBodyBytes) + `}`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/v1/characters/1", strings.NewReader(test.body))
+			if test.legacy {
+				r.Header.Set(jsonShapeHeader, legacyShape)
+			}
+			var character Character
+			err := decodeJSON(r, &character)
+			if (err == nil) != test.valid {
+				t.Fatalf("decodeJSON(%s) error = %v", test.body, err)
+			}
+			if test.valid && (character.Name != "Felix" || character.CrestID == nil || *character.CrestID != 2) {
+				t.Errorf("decoded %+v", character)
+			}
+		})
+	}
+}
+
+func TestShapedETag(t *testing.T) {
+	etag := etagFor(3, time.UnixMicro(0x10))
+	r := httptest.NewRequest("GET", "/v1/characters/3", nil)
+	if got := shapedETag(r, etag); got != etag {
+		t.Errorf("shapedETag = %s, want %s", got, etag)
+	}
+
+	r.Header.Set(jsonShapeHeader, legacyShape)
+	legacy := shapedETag(r, etag)
+	if legacy == etag {
+		t.Errorf("the legacy shape shares the tag %s", etag)
+	}
+	if again := shapedETag(r, legacy); again != legacy {
+		t.Errorf("shapedETag is not idempotent: %s, then %s", legacy, again)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	loggerKey      contextKey = "logger"
+	requestMetaKey contextKey = "requestMeta"
+)
+
+// newLogger creates the JSON logger used by the whole process
+func newLogger(level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+}
+
+// loggerFrom returns the request-scoped logger, which carries the request ID
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// requestMeta is created by requestIDMiddleware and filled in by the router
+// once the request has been matched, so that middleware running outside the
+// router can see the route
+type requestMeta struct {
+	route string
+}
+
+// routeFrom returns the route template of the request, such as
+// "/characters/{charID}", or "" when no route matched
+func routeFrom(ctx context.Context) string {
+	if meta, ok := ctx.Value(requestMetaKey).(*requestMeta); ok {
+		return meta.route
+	}
+	return ""
+}
+
+// routeTemplateMiddleware must be installed on the router with Use. It
+// records the template of the matched route in the request metadata.
+func routeTemplateMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if meta, ok := r.Context().Value(requestMetaKey).(*requestMeta); ok {
+			if route := mux.CurrentRoute(r); route != nil {
+				meta.route, _ = route.GetPathTemplate()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// accessLogMiddleware writes one structured log line per request. It must
+// run inside requestIDMiddleware so the line carries the request ID.
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newResponseRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		ctx := r.Context()
+		route := routeFrom(ctx)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		level := slog.LevelInfo
+		if rec.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		} else if rec.Status() >= http.StatusBadRequest {
+			level = slog.LevelWarn
+		}
+
+		loggerFrom(ctx).LogAttrs(ctx, level, "request",
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.Status()),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", rec.bytes),
+			slog.String("remote_addr", r.RemoteAddr),
+		)
+	})
+}
+
+// fatal logs err and stops the process
+func fatal(msg string, err error) {
+	slog.Error(msg, slog.String("error", err.Error()))
+	os.Exit(1)
+}
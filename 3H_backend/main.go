@@ -1,151 +1,173 @@
-package main
-
-import (
-	"database/sql"
-
-	"fmt"
-	"log"
-	"net/http"
-	"os"
-
-	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
-	"github.com/rs/cors"
-)
-
-func createTable(db *sql.DB) {
-	_, err := db.Exec(`
-        CREATE TABLE IF NOT EXISTS classes (
-            id SERIAL PRIMARY KEY,
-            name VARCHAR(255) NOT NULL,
-            rank VARCHAR(255) NOT NULL,
-			base INTEGER[] NOT NULL,			
-			bonus INTEGER[],
-			growth INTEGER[],
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-        )
-    `)
-	if err != nil {
-		log.Fatal("Error creating table:", err)
-	}
-
-	// Check if the table was actually created
-	var exists bool
-	err = db.QueryRow("SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", "classes").Scan(&exists)
-	if err != nil {
-		log.Fatal("Error checking if table exists:", err)
-	}
-
-	if exists {
-		fmt.Println("Table created successfully")
-	} else {
-		fmt.Println("Table already exists")
-	}
-}
-
-func main() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-	// Retrieve environment variables
-	host := os.Getenv("HOST")
-	sql_port := os.Getenv("SQL_PORT")
-	user := os.Getenv("USER")
-	password := os.Getenv("PASSWORD")
-	dbname := os.Getenv("DBNAME")
-
-	connectionString := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", host, sql_port, user, password, dbname)
-	db, err := sql.Open("postgres", connectionString)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
-
-	err = db.Ping()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	fmt.Println("Successfully connected to the database")
-
-	createTable(db)
-
-	// Set up the Gorilla mux router
-	r := mux.NewRouter()
-
-	// Set up CORS
-	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
-		AllowCredentials: true,
-	})
-
-	handler := c.Handler(r)
-
-	characterController := NewCharacterController(db)
-	skillsController := NewSkillsController(db)
-	spellsController := NewSpellsController(db)
-	combatArtController := NewCombatArtController(db)
-	weaponsController := NewWeaponsController(db)
-	charSkillsController := NewCharSkillsController(db)
-	classController := NewClassController(db)
-
-	// Define your routes
-	r.HandleFunc("/characters", characterController.GetAll).Methods("GET")
-	r.HandleFunc("/characters/{charID}", characterController.GetOne).Methods("GET")
-	r.HandleFunc("/characters/house/{affinity}", characterController.GetByAffinity).Methods("GET")
-	r.HandleFunc("/characters/name/{charName}", characterController.GetByName).Methods("GET")
-	r.HandleFunc("/characters", characterController.PostOne).Methods("POST")
-	r.HandleFunc("/characters/{charID}", characterController.PutOne).Methods("PUT")
-	r.HandleFunc("/characters/{charID}", characterController.DeleteOne).Methods("DELETE")
-
-	r.HandleFunc("/skill_types", skillsController.GetAll).Methods("GET")
-	r.HandleFunc("/skill_types/{skillID}", skillsController.GetOne).Methods("GET")
-	r.HandleFunc("/skill_types", skillsController.PostOne).Methods("POST")
-	r.HandleFunc("/skill_types/{skillID}", skillsController.PutOne).Methods("PUT")
-	r.HandleFunc("/skill_types/{skillID}", skillsController.DeleteOne).Methods("DELETE")
-
-	r.HandleFunc("/spells", spellsController.GetAll).Methods("GET")
-	r.HandleFunc("/spells/{spellID}", spellsController.GetOne).Methods("GET")
-	r.HandleFunc("/spells", spellsController.PostOne).Methods("POST")
-	r.HandleFunc("/spells/{spellID}", spellsController.PutOne).Methods("PUT")
-	r.HandleFunc("/spells/{spellID}", spellsController.DeleteOne).Methods("DELETE")
-
-	r.HandleFunc("/combat_arts", combatArtController.GetAll).Methods("GET")
-	r.HandleFunc("/combat_arts/{artID}", combatArtController.GetOne).Methods("GET")
-	r.HandleFunc("/combat_arts", combatArtController.PostOne).Methods("POST")
-	r.HandleFunc("/combat_arts/{artID}", combatArtController.PutOne).Methods("PUT")
-	r.HandleFunc("/combat_arts/{artID}", combatArtController.DeleteOne).Methods("DELETE")
-
-	r.HandleFunc("/weapons", weaponsController.GetAll).Methods("GET")
-	r.HandleFunc("/weapons/{weaponID}", weaponsController.GetOne).Methods("GET")
-	r.HandleFunc("/weapons/name/{weaponName}", weaponsController.GetOneName).Methods("GET")
-	r.HandleFunc("/weapons", weaponsController.PostOne).Methods("POST")
-	r.HandleFunc("/weapons/{weaponID}", weaponsController.PutOne).Methods("PUT")
-	r.HandleFunc("/weapons/{weaponID}", weaponsController.DeleteOne).Methods("DELETE")
-
-	r.HandleFunc("/charskilllist", charSkillsController.GetAll).Methods("GET")
-	r.HandleFunc("/charskilllist/{listID}", charSkillsController.GetOneByID).Methods("GET")
-	r.HandleFunc("/charskilllist/char/{charID}", charSkillsController.GetOneByCharID).Methods("GET")
-	r.HandleFunc("/charskilllist", charSkillsController.PostOne).Methods("POST")
-	r.HandleFunc("/charskilllist/{listID}", charSkillsController.PutOne).Methods("PUT")
-	r.HandleFunc("/charskilllist/{listID}", charSkillsController.DeleteOne).Methods("DELETE")
-
-	r.HandleFunc("/classes", classController.GetAll).Methods("GET")
-	r.HandleFunc("/classes/{classID}", classController.GetOne).Methods("GET")
-	r.HandleFunc("/classes", classController.PostOne).Methods("POST")
-	r.HandleFunc("/classes/{classID}", classController.PutOne).Methods("PUT")
-	r.HandleFunc("/classes/{classID}", classController.DeleteOne).Methods("DELETE")
-
-	port := os.Getenv("BACKEND_PORT")
-	if port == "" {
-		port = "2999"
-	}
-
-	log.Printf("Server is running on :%s", port)
-	log.Fatal(http.ListenAndServe(":"+port, handler))
-}
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"fe3h_backend/config"
+
+	"github.com/gorilla/mux"
+	_ "github.com/lib/pq"
+)
+
+// connectDB opens the database and waits for it to accept connections,
+// retrying with exponential backoff so that the API can start before
+// Postgres has finished booting
+func connectDB(connectionString string, attempts int, backoff, maxBackoff time.Duration) (*sql.DB, error) {
+	db, err := sql.Open("postgres", connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = db.Ping()
+		if err == nil {
+			return db, nil
+		}
+		if attempt >= attempts {
+			db.Close()
+			return nil, fmt.Errorf("database unreachable after %d attempts: %w", attempt, err)
+		}
+
+		slog.Warn("Database not ready, retrying",
+			slog.Int("attempt", attempt),
+			slog.Duration("backoff", backoff),
+			slog.String("error", err.Error()))
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+	if cfg.PrintConfig {
+		cfg.Print(os.Stdout)
+		return
+	}
+
+	slog.SetDefault(newLogger(cfg.SlogLevel()))
+	slog.Info("Loaded configuration", slog.Any("config", cfg))
+
+	dbCfg := cfg.Database
+	db, err := connectDB(dbCfg.DSN(), dbCfg.ConnectAttempts,
+		time.Duration(dbCfg.ConnectBackoff), time.Duration(dbCfg.ConnectMaxBackoff))
+	if err != nil {
+		fatal("Error connecting to the database", err)
+	}
+	defer db.Close()
+
+	db.SetMaxOpenConns(dbCfg.MaxOpenConns)
+	db.SetMaxIdleConns(dbCfg.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(dbCfg.ConnMaxLifetime))
+	db.SetConnMaxIdleTime(time.Duration(dbCfg.ConnMaxIdleTime))
+
+	slog.Info("Successfully connected to the database")
+
+	err = migrate(db)
+	if err != nil {
+		fatal("Error migrating the database", err)
+	}
+
+	// Set up the Gorilla mux router
+	r := mux.NewRouter()
+
+	r.NotFoundHandler = noRouteHandler(r)
+	r.MethodNotAllowedHandler = noRouteHandler(r)
+
+	healthController := NewHealthController(db)
+	r.HandleFunc("/healthz", healthController.Liveness).Methods("GET")
+	r.HandleFunc("/readyz", healthController.Readiness).Methods("GET")
+
+	versions := apiVersions(db)
+	current := versions[len(versions)-1]
+
+	for _, version := range versions {
+		openAPIController, err := NewOpenAPIController(version)
+		if err != nil {
+			fatal("Error generating OpenAPI document", err)
+		}
+		r.HandleFunc(version.Prefix+"/openapi.json", openAPIController.GetSpec).Methods("GET")
+		if version.Prefix == current.Prefix {
+			r.HandleFunc("/openapi.json", openAPIController.GetSpec).Methods("GET")
+		}
+	}
+
+	responseCache := NewResponseCache(newMemoryCache(cfg.Cache.MaxEntries),
+		time.Duration(cfg.Cache.TTL), time.Duration(cfg.Cache.MaxAge))
+	r.HandleFunc("/cache/stats", responseCache.GetStats).Methods("GET")
+
+	// The resource routes share a subrouter so that only they are rate
+	// limited and cached
+	api := r.NewRoute().Subrouter()
+	if cfg.RateLimit.Enabled {
+		api.Use(NewRateLimiter(cfg.RateLimit).Middleware)
+	}
+	registerVersions(api, versions, responseCache.Middleware)
+
+	// The unversioned routes behave as /v1 for existing clients, keeping the
+	// legacy JSON shape
+	if cfg.API.LegacyRoutes {
+		legacy := api.NewRoute().Subrouter()
+		legacy.Use(deprecationMiddleware(versions[0].Prefix, cfg.API.LegacySunsetTime()),
+			legacyShapeMiddleware, responseCache.Middleware)
+		registerRoutes(legacy, versions[0].Routes)
+	}
+
+	metrics := NewMetrics(db, responseCache)
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	r.Use(routeTemplateMiddleware)
+	handler := newCORSPolicies(cfg.CORS).Handler(requestIDMiddleware(accessLogMiddleware(metrics.Middleware(r))))
+
+	server := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Server.Port),
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+	}
+
+	err = serve(server, time.Duration(cfg.Server.ShutdownTimeout))
+	if err != nil {
+		fatal("Server stopped", err)
+	}
+	slog.Info("Server stopped")
+}
+
+// serve runs the server until it receives SIGINT or SIGTERM, then stops
+// accepting connections and waits up to shutdownTimeout for in-flight
+// requests to finish
+func serve(server *http.Server, shutdownTimeout time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		slog.Info("Server is running", slog.String("addr", server.Addr))
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	slog.Info("Shutting down, draining requests", slog.Duration("timeout", shutdownTimeout))
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// MasteryProgress is the progress of a character toward mastering a class
+type MasteryProgress struct {
+	ClassID     int    `json:"class_id"`
+	ClassName   string `json:"class_name"`
+	Exp         int    `json:"exp"`
+	ExpRequired *int   `json:"exp_required"`
+	Mastered    bool   `json:"mastered"`
+}
+
+// MasteryReport lists the class EXP a character has earned and what the
+// classes it has mastered have taught it
+type MasteryReport struct {
+	CharacterID int               `json:"character_id"`
+	Classes     []MasteryProgress `json:"classes"`
+	Abilities   []Ability         `json:"abilities"`
+	CombatArts  []CombatArts      `json:"combat_arts"`
+}
+
+// MasteryController tracks the class EXP earned by each character
+type MasteryController struct {
+	db         *sql.DB
+	characters *CharacterController
+	classes    *ClassController
+	abilities  *AbilityController
+	combatArts *CombatArtController
+}
+
+func NewMasteryController(db *sql.DB) *MasteryController {
+	return &MasteryController{
+		db:         db,
+		characters: NewCharacterController(db),
+		classes:    NewClassController(db),
+		abilities:  NewAbilityController(db),
+		combatArts: NewCombatArtController(db),
+	}
+}
+
+// GetAll reports the masteries of a character
+func (mc *MasteryController) GetAll(w http.ResponseWriter, r *http.Request) {
+	character, ok := mc.character(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := mc.masteryReport(character.ID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting class masteries: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, report)
+}
+
+func (mc *MasteryController) masteryReport(charID int) (*MasteryReport, error) {
+	rows, err := mc.db.Query(`
+		SELECT m.class_id, c.name, m.exp, c.mastery_exp, c.mastery_ability_id, c.mastery_art_id
+		FROM class_masteries m JOIN classes c ON c.id = m.class_id
+		WHERE m.char_id = $1
+		ORDER BY m.class_id
+	`, charID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &MasteryReport{CharacterID: charID, Classes: []MasteryProgress{},
+		Abilities: []Ability{}, CombatArts: []CombatArts{}}
+	var abilityIDs, artIDs []int
+
+	for rows.Next() {
+		var progress MasteryProgress
+		var abilityID, artID *int
+		err := rows.Scan(&progress.ClassID, &progress.ClassName, &progress.Exp, &progress.ExpRequired,
+			&abilityID, &artID)
+		if err != nil {
+			return nil, err
+		}
+
+		progress.Mastered = progress.ExpRequired != nil && progress.Exp >= *progress.ExpRequired
+		if progress.Mastered && abilityID != nil {
+			abilityIDs = append(abilityIDs, *abilityID)
+		}
+		if progress.Mastered && artID != nil {
+			artIDs = append(artIDs, *artID)
+		}
+		report.Classes = append(report.Classes, progress)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range abilityIDs {
+		ability, err := mc.abilities.getAbilityByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if ability != nil {
+			report.Abilities = append(report.Abilities, *ability)
+		}
+	}
+	for _, id := range artIDs {
+		art, err := mc.combatArts.getCombatArtByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if art != nil {
+			report.CombatArts = append(report.CombatArts, *art)
+		}
+	}
+
+	return report, nil
+}
+
+// PutOne sets the class EXP a character has earned in a class
+func (mc *MasteryController) PutOne(w http.ResponseWriter, r *http.Request) {
+	character, ok := mc.character(w, r)
+	if !ok {
+		return
+	}
+
+	classID, err := strconv.Atoi(mux.Vars(r)["classID"])
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid class ID"))
+		return
+	}
+
+	var mastery ClassMastery
+	err = decodeJSON(r, &mastery)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
+		return
+	}
+
+	err = mastery.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	class, err := mc.classes.getClassByID(classID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting class: %w", err))
+		return
+	}
+
+	if class == nil {
+		writeError(w, r, NotFound("Class not found"))
+		return
+	}
+
+	current, err := mc.getMastery(character.ID, classID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting class mastery: %w", err))
+		return
+	}
+
+	var version *time.Time
+	if current != nil {
+		err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		version = &current.UpdatedAt
+	}
+
+	mastery.CharID = character.ID
+	mastery.ClassID = classID
+	mastery.CreatedAt = time.Now()
+	mastery.UpdatedAt = time.Now()
+
+	err = mc.upsertMastery(&mastery, version)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error saving class mastery: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(mastery.ID, mastery.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, mastery)
+}
+
+// PatchOne partially updates the class EXP a character has earned in a class
+func (mc *MasteryController) PatchOne(w http.ResponseWriter, r *http.Request) {
+	character, ok := mc.character(w, r)
+	if !ok {
+		return
+	}
+
+	classID, err := strconv.Atoi(mux.Vars(r)["classID"])
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid class ID"))
+		return
+	}
+
+	mastery, err := mc.getMastery(character.ID, classID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting class mastery: %w", err))
+		return
+	}
+
+	if mastery == nil {
+		writeError(w, r, NotFound("Class mastery not found"))
+		return
+	}
+
+	version := mastery.UpdatedAt
+	err = checkIfMatch(r, etagFor(mastery.ID, version))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = applyMergePatch(r, mastery)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = mastery.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// The character and the class come from the route
+	mastery.CharID = character.ID
+	mastery.ClassID = classID
+	mastery.UpdatedAt = time.Now()
+
+	err = mc.upsertMastery(mastery, &version)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error saving class mastery: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(mastery.ID, mastery.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, mastery)
+}
+
+func (mc *MasteryController) getMastery(charID, classID int) (*ClassMastery, error) {
+	row := mc.db.QueryRow("SELECT * FROM class_masteries WHERE char_id = $1 AND class_id = $2", charID, classID)
+
+	var mastery ClassMastery
+	err := row.Scan(&mastery.ID, &mastery.CharID, &mastery.ClassID, &mastery.Exp,
+		&mastery.CreatedAt, &mastery.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &mastery, nil
+}
+
+// upsertMastery inserts the mastery, or replaces the row of its character and
+// class if that row was last updated at version. A nil version means no row
+// was read, so that one inserted since is not overwritten.
+func (mc *MasteryController) upsertMastery(mastery *ClassMastery, version *time.Time) error {
+	err := mc.db.QueryRow(`
+		INSERT INTO class_masteries (char_id, class_id, exp, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (char_id, class_id) DO UPDATE SET exp = EXCLUDED.exp, updated_at = EXCLUDED.updated_at
+		WHERE class_masteries.updated_at = $6
+		RETURNING id, created_at, updated_at
+	`, mastery.CharID, mastery.ClassID, mastery.Exp, mastery.CreatedAt, mastery.UpdatedAt, version).Scan(
+		&mastery.ID, &mastery.CreatedAt, &mastery.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return Conflict("Class mastery of character %d in class %d was modified by another request",
+			mastery.CharID, mastery.ClassID)
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteOne forgets the class EXP a character has earned in a class
+func (mc *MasteryController) DeleteOne(w http.ResponseWriter, r *http.Request) {
+	character, ok := mc.character(w, r)
+	if !ok {
+		return
+	}
+
+	classID, err := strconv.Atoi(mux.Vars(r)["classID"])
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid class ID"))
+		return
+	}
+
+	current, err := mc.getMastery(character.ID, classID)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting class mastery: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Class mastery not found"))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = mc.deleteMastery(current.ID, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error deleting class mastery: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, deleteResult{Success: true, Msg: "Class mastery deleted successfully."})
+}
+
+func (mc *MasteryController) deleteMastery(id int, version time.Time) error {
+	// Only delete the row if it has not changed since version was read
+	result, err := mc.db.Exec("DELETE FROM class_masteries WHERE id = $1 AND updated_at = $2", id, version)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return Conflict("Class mastery with ID %d was modified or deleted by another request", id)
+	}
+
+	return nil
+}
+
+// character loads the character of the route, writing the error response
+// and returning false when it cannot
+func (mc *MasteryController) character(w http.ResponseWriter, r *http.Request) (*Character, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["charID"])
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid character ID"))
+		return nil, false
+	}
+
+	character, err := mc.characters.getCharacterByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting character: %w", err))
+		return nil, false
+	}
+
+	if character == nil {
+		writeError(w, r, NotFound("Character not found"))
+		return nil, false
+	}
+
+	return character, true
+}
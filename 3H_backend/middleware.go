@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+type contextKey string
+
+const requestIDKey contextKey = "requestID"
+
+// requestIDHeader carries the request ID in both directions so that a
+// caller-supplied ID is kept across services
+const requestIDHeader = "X-Request-ID"
+
+// requestIDMiddleware assigns every request an ID, exposes it in the
+// response headers and stores it, along with a logger carrying it and the
+// request metadata, in the request context
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" || len(requestID) > 128 {
+			requestID = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, requestID)
+		ctx := context.WithValue(r.Context(), requestIDKey, requestID)
+		ctx = context.WithValue(ctx, loggerKey, slog.Default().With(slog.String("request_id", requestID)))
+		ctx = context.WithValue(ctx, requestMetaKey, &requestMeta{})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func requestIDFrom(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// responseRecorder passes the response through to the client while keeping
+// track of the status, the number of bytes written and, when capture is set,
+// a copy of the body
+type responseRecorder struct {
+	http.ResponseWriter
+	status  int
+	bytes   int
+	capture bool
+	body    bytes.Buffer
+	// beforeHeader, when set, runs once right before the status line is sent
+	// so that headers can still be added based on the status
+	beforeHeader func(status int)
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status != 0 {
+		return
+	}
+	rr.status = status
+	if rr.beforeHeader != nil {
+		rr.beforeHeader(status)
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.WriteHeader(http.StatusOK)
+	}
+	if rr.capture {
+		rr.body.Write(b)
+	}
+	n, err := rr.ResponseWriter.Write(b)
+	rr.bytes += n
+	return n, err
+}
+
+// Status returns the status sent to the client, 200 if the handler never
+// wrote one explicitly
+func (rr *responseRecorder) Status() int {
+	if rr.status == 0 {
+		return http.StatusOK
+	}
+	return rr.status
+}
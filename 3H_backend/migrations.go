@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// migration is one step of the schema history. Versions must be strictly
+// increasing and a migration must never be edited once it has shipped;
+// append a new one instead.
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+var migrations = []migration{
+	// The tables that predate the migrations, as they were created by hand.
+	// Version 0 runs first on a fresh database; on an existing one the
+	// tables are already there and it only records itself.
+	{0, "create_baseline_tables", `
+		CREATE TABLE IF NOT EXISTS characters (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			image_link VARCHAR(255) NOT NULL,
+			affinity VARCHAR(255) NOT NULL,
+			base_lv INTEGER NOT NULL,
+			hp INTEGER NOT NULL,
+			hp_growth INTEGER NOT NULL,
+			strength INTEGER NOT NULL,
+			str_growth INTEGER NOT NULL,
+			magic INTEGER NOT NULL,
+			mag_growth INTEGER NOT NULL,
+			dexterity INTEGER NOT NULL,
+			dex_growth INTEGER NOT NULL,
+			speed INTEGER NOT NULL,
+			spd_growth INTEGER NOT NULL,
+			luck INTEGER NOT NULL,
+			lck_growth INTEGER NOT NULL,
+			defence INTEGER NOT NULL,
+			def_growth INTEGER NOT NULL,
+			resistance INTEGER NOT NULL,
+			res_growth INTEGER NOT NULL,
+			charm INTEGER NOT NULL,
+			cha_growth INTEGER NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS skills (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			skill_icon VARCHAR(255),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS spells (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			type VARCHAR(255) NOT NULL,
+			might INTEGER,
+			hit INTEGER,
+			critical INTEGER,
+			uses INTEGER NOT NULL,
+			weight INTEGER,
+			range_min INTEGER NOT NULL,
+			range_max INTEGER,
+			description TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS combat_arts (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			type_id INTEGER NOT NULL REFERENCES skills (id),
+			str_mag BOOLEAN,
+			might INTEGER,
+			hit INTEGER,
+			critical INTEGER,
+			durability_cost INTEGER NOT NULL,
+			range_min INTEGER NOT NULL,
+			range_max INTEGER,
+			description TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS weapons (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			type_id INTEGER NOT NULL REFERENCES skills (id),
+			str_mag BOOLEAN,
+			might INTEGER,
+			hit INTEGER,
+			critical INTEGER,
+			durability INTEGER NOT NULL,
+			weight INTEGER NOT NULL,
+			range_min INTEGER NOT NULL,
+			range_max INTEGER,
+			description TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS character_skills (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			char_id INTEGER NOT NULL REFERENCES characters (id),
+			spell_list INTEGER[],
+			ca_list INTEGER[],
+			boons INTEGER[],
+			banes INTEGER[],
+			budding_talent INTEGER,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+	`},
+	{1, "create_classes", `
+		CREATE TABLE IF NOT EXISTS classes (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			rank VARCHAR(255) NOT NULL,
+			base INTEGER[] NOT NULL,
+			bonus INTEGER[],
+			growth INTEGER[],
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`},
+	{2, "create_crests", `
+		CREATE TABLE IF NOT EXISTS crests (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL UNIQUE,
+			activation_effect TEXT NOT NULL,
+			trigger VARCHAR(32) NOT NULL,
+			effect_type VARCHAR(32) NOT NULL,
+			effect_value INTEGER,
+			major_rate VARCHAR(255) NOT NULL,
+			minor_rate VARCHAR(255) NOT NULL,
+			description TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		ALTER TABLE characters
+			ADD COLUMN IF NOT EXISTS crest_id INTEGER REFERENCES crests (id),
+			ADD COLUMN IF NOT EXISTS crest_strength VARCHAR(5)
+				CHECK (crest_strength IN ('Major', 'Minor'));
+	`},
+	{3, "add_weapon_crests_and_effects", `
+		ALTER TABLE weapons
+			ADD COLUMN IF NOT EXISTS crest_id INTEGER REFERENCES crests (id),
+			ADD COLUMN IF NOT EXISTS effects JSONB NOT NULL DEFAULT '[]';
+		CREATE INDEX IF NOT EXISTS weapons_effects_idx ON weapons USING GIN (effects);
+	`},
+	{4, "create_abilities", `
+		CREATE TABLE IF NOT EXISTS abilities (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			category VARCHAR(32) NOT NULL,
+			description TEXT NOT NULL,
+			effects JSONB NOT NULL DEFAULT '[]',
+			char_id INTEGER REFERENCES characters (id),
+			class_id INTEGER REFERENCES classes (id),
+			skill_id INTEGER REFERENCES skills (id),
+			skill_rank VARCHAR(2),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS abilities_char_id_idx ON abilities (char_id);
+		CREATE INDEX IF NOT EXISTS abilities_class_id_idx ON abilities (class_id);
+	`},
+	{5, "add_class_masteries", `
+		ALTER TABLE classes
+			ADD COLUMN IF NOT EXISTS mastery_ability_id INTEGER REFERENCES abilities (id),
+			ADD COLUMN IF NOT EXISTS mastery_art_id INTEGER REFERENCES combat_arts (id),
+			ADD COLUMN IF NOT EXISTS mastery_exp INTEGER;
+		CREATE TABLE IF NOT EXISTS class_masteries (
+			id SERIAL PRIMARY KEY,
+			char_id INTEGER NOT NULL REFERENCES characters (id) ON DELETE CASCADE,
+			class_id INTEGER NOT NULL REFERENCES classes (id) ON DELETE CASCADE,
+			exp INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (char_id, class_id)
+		);
+	`},
+	{6, "add_class_attributes", `
+		ALTER TABLE classes
+			ADD COLUMN IF NOT EXISTS movement INTEGER NOT NULL DEFAULT 4,
+			ADD COLUMN IF NOT EXISTS unit_types TEXT[],
+			ADD COLUMN IF NOT EXISTS proficiencies INTEGER[],
+			ADD COLUMN IF NOT EXISTS exclusive_char_ids INTEGER[],
+			ADD COLUMN IF NOT EXISTS ability_ids INTEGER[];
+	`},
+	{7, "add_class_requirements", `
+		ALTER TABLE classes ADD COLUMN IF NOT EXISTS requirements JSONB;
+	`},
+	{8, "add_max_stats", `
+		ALTER TABLE characters ADD COLUMN IF NOT EXISTS max_stats INTEGER[];
+		ALTER TABLE classes ADD COLUMN IF NOT EXISTS max_stats INTEGER[];
+	`},
+	{9, "create_supports", `
+		CREATE TABLE IF NOT EXISTS supports (
+			id SERIAL PRIMARY KEY,
+			char_id INTEGER NOT NULL REFERENCES characters (id) ON DELETE CASCADE,
+			partner_id INTEGER NOT NULL REFERENCES characters (id) ON DELETE CASCADE,
+			ranks TEXT[] NOT NULL,
+			routes TEXT[],
+			paired_ending BOOLEAN NOT NULL DEFAULT FALSE,
+			ending TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CHECK (char_id <> partner_id)
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS supports_pair_idx
+			ON supports (LEAST(char_id, partner_id), GREATEST(char_id, partner_id));
+	`},
+	{10, "create_battalions_and_gambits", `
+		CREATE TABLE IF NOT EXISTS gambits (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL UNIQUE,
+			might INTEGER,
+			hit INTEGER,
+			range_min INTEGER NOT NULL,
+			range_max INTEGER,
+			uses INTEGER NOT NULL,
+			area VARCHAR(16) NOT NULL,
+			effect VARCHAR(32) NOT NULL,
+			description TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS battalions (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL UNIQUE,
+			stat_bonus INTEGER[] NOT NULL,
+			endurance INTEGER NOT NULL,
+			authority_id INTEGER NOT NULL REFERENCES skills (id),
+			authority_rank VARCHAR(2) NOT NULL,
+			gambit_id INTEGER REFERENCES gambits (id),
+			description TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+	`},
+	{11, "create_items_and_inventories", `
+		CREATE TABLE IF NOT EXISTS items (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL UNIQUE,
+			category VARCHAR(32) NOT NULL,
+			uses INTEGER,
+			effects JSONB NOT NULL DEFAULT '[]',
+			description TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS inventory (
+			id SERIAL PRIMARY KEY,
+			char_id INTEGER NOT NULL REFERENCES characters (id) ON DELETE CASCADE,
+			item_id INTEGER REFERENCES items (id),
+			weapon_id INTEGER REFERENCES weapons (id),
+			uses INTEGER,
+			equipped BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CHECK ((item_id IS NULL) <> (weapon_id IS NULL))
+		);
+		CREATE INDEX IF NOT EXISTS inventory_char_id_idx ON inventory (char_id);
+	`},
+	{12, "derive_class_abilities", `
+		UPDATE abilities SET class_id = classes.id
+		FROM classes
+		WHERE abilities.class_id IS NULL AND abilities.id = ANY (classes.ability_ids);
+		ALTER TABLE classes DROP COLUMN IF EXISTS ability_ids;
+	`},
+}
+
+// migrate applies the migrations that have not been recorded in
+// schema_migrations yet, each in its own transaction
+func migrate(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+
+	applied, err := appliedMigrations(context.Background(), db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(m.sql)
+		if err == nil {
+			_, err = tx.Exec("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.version, m.name)
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error applying migration %d (%s): %w", m.version, m.name, err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+
+		slog.Info("Applied migration", slog.Int("version", m.version), slog.String("name", m.name))
+	}
+
+	return nil
+}
+
+func appliedMigrations(ctx context.Context, db *sql.DB) (map[int]bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]bool{}
+	for rows.Next() {
+		var version int
+		err := rows.Scan(&version)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// pendingMigrations lists the migrations known to this build that have not
+// been applied to the database
+func pendingMigrations(ctx context.Context, db *sql.DB) ([]migration, error) {
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []migration
+	for _, m := range migrations {
+		if !applied[m.version] {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
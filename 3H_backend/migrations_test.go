@@ -0,0 +1,36 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+var (
+	createdTable    = regexp.MustCompile(`CREATE TABLE IF NOT EXISTS (\w+)`)
+	referencedTable = regexp.MustCompile(`(?:ALTER TABLE|REFERENCES|INDEX IF NOT EXISTS \w+ ON) (\w+)`)
+)
+
+func TestMigrationsOrder(t *testing.T) {
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version <= migrations[i-1].version {
+			t.Errorf("migration %d (%s) does not follow version %d", migrations[i].version,
+				migrations[i].name, migrations[i-1].version)
+		}
+	}
+}
+
+// TestMigrationsCreateTablesFirst checks, on the SQL alone, that a fresh
+// database gets every table before a migration alters or references it
+func TestMigrationsCreateTablesFirst(t *testing.T) {
+	created := map[string]bool{}
+	for _, m := range migrations {
+		for _, match := range createdTable.FindAllStringSubmatch(m.sql, -1) {
+			created[match[1]] = true
+		}
+		for _, match := range referencedTable.FindAllStringSubmatch(m.sql, -1) {
+			if !created[match[1]] {
+				t.Errorf("migration %d (%s) uses table %s before it is created", m.version, m.name, match[1])
+			}
+		}
+	}
+}
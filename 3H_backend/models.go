@@ -5,114 +5,292 @@ import (
 )
 
 type Character struct {
-	ID   int
-	Name string // Update with your actual fields
-
-	ImageLink  string
-	Affinity   string
-	BaseLv     int
-	HP         int
-	HpGrowth   int
-	Strength   int
-	StrGrowth  int
-	Magic      int
-	MagGrowth  int
-	Dexterity  int
-	DexGrowth  int
-	Speed      int
-	SpdGrowth  int
-	Luck       int
-	LckGrowth  int
-	Defence    int
-	DefGrowth  int
-	Resistance int
-	ResGrowth  int
-	Charm      int
-	ChaGrowth  int
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID   int    `json:"id"`
+	Name string `json:"name"` // Update with your actual fields
+
+	ImageLink  string `json:"image_link"`
+	Affinity   string `json:"affinity"`
+	BaseLv     int    `json:"base_lv"`
+	HP         int    `json:"hp"`
+	HpGrowth   int    `json:"hp_growth"`
+	Strength   int    `json:"strength"`
+	StrGrowth  int    `json:"str_growth"`
+	Magic      int    `json:"magic"`
+	MagGrowth  int    `json:"mag_growth"`
+	Dexterity  int    `json:"dexterity"`
+	DexGrowth  int    `json:"dex_growth"`
+	Speed      int    `json:"speed"`
+	SpdGrowth  int    `json:"spd_growth"`
+	Luck       int    `json:"luck"`
+	LckGrowth  int    `json:"lck_growth"`
+	Defence    int    `json:"defence"`
+	DefGrowth  int    `json:"def_growth"`
+	Resistance int    `json:"resistance"`
+	ResGrowth  int    `json:"res_growth"`
+	Charm      int    `json:"charm"`
+	ChaGrowth  int    `json:"cha_growth"`
+	// CrestID references Crest.ID, CrestStrength is "Major" or "Minor"
+	CrestID       *int    `json:"crest_id"`
+	CrestStrength *string `json:"crest_strength"`
+	// MaxStats are the highest values the stats can reach, in the order of the
+	// class stat arrays
+	MaxStats  []int     `json:"max_stats"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type Spells struct {
-	ID   int
-	Name string
-	Type string
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
 	// * before the type indicates that the value is nullable
-	Might       *int
-	Hit         *int
-	Critical    *int
-	Uses        int
-	Weight      *int
-	RangeMin    int
-	RangeMax    *int
-	Description *string
+	Might       *int      `json:"might"`
+	Hit         *int      `json:"hit"`
+	Critical    *int      `json:"critical"`
+	Uses        int       `json:"uses"`
+	Weight      *int      `json:"weight"`
+	RangeMin    int       `json:"range_min"`
+	RangeMax    *int      `json:"range_max"`
+	Description *string   `json:"description"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 type Skills struct {
-	ID        int
-	Name      string
-	SkillIcon *string
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	SkillIcon *string   `json:"skill_icon"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // Secondary
 type CombatArts struct {
-	ID             int
-	Name           string
-	TypeID         uint // This is the foreign key referencing Skills.ID
-	StrMag         *bool
-	Might          *int
-	Hit            *int
-	Critical       *int
-	DurabilityCost int
-	RangeMin       int
-	RangeMax       *int
-	Description    *string
+	ID             int       `json:"id"`
+	Name           string    `json:"name"`
+	TypeID         uint      `json:"type_id"` // This is the foreign key referencing Skills.ID
+	StrMag         *bool     `json:"str_mag"`
+	Might          *int      `json:"might"`
+	Hit            *int      `json:"hit"`
+	Critical       *int      `json:"critical"`
+	DurabilityCost int       `json:"durability_cost"`
+	RangeMin       int       `json:"range_min"`
+	RangeMax       *int      `json:"range_max"`
+	Description    *string   `json:"description"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
 
 type Weapons struct {
-	ID          int
-	Name        string
-	TypeID      uint // This is the foreign key referencing Skills.ID
-	StrMag      *bool
-	Might       *int
-	Hit         *int
-	Critical    *int
-	Durability  int
-	Weight      int
-	RangeMin    int
-	RangeMax    *int
-	Description *string
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int     `json:"id"`
+	Name        string  `json:"name"`
+	TypeID      uint    `json:"type_id"` // This is the foreign key referencing Skills.ID
+	StrMag      *bool   `json:"str_mag"`
+	Might       *int    `json:"might"`
+	Hit         *int    `json:"hit"`
+	Critical    *int    `json:"critical"`
+	Durability  int     `json:"durability"`
+	Weight      int     `json:"weight"`
+	RangeMin    int     `json:"range_min"`
+	RangeMax    *int    `json:"range_max"`
+	Description *string `json:"description"`
+	// CrestID references the Crest needed to wield the weapon safely
+	CrestID   *int           `json:"crest_id"`
+	Effects   []WeaponEffect `json:"effects"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// WeaponEffect is a special property of a weapon. Target is the unit type
+// an "effective" weapon is effective against; Value is the amount of the
+// other effects, such as the HP lost by self_damage.
+type WeaponEffect struct {
+	Type   string  `json:"type"`
+	Target *string `json:"target"`
+	Value  *int    `json:"value"`
 }
 
 // Tertiary
 type CharSkill struct {
-	ID        int
-	Name      string
-	CharID    int
-	SpellList []int
-	CAList    []int
-	Boons     []int
-	Banes     []int
-	Budding   *int
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CharID    int       `json:"char_id"`
+	SpellList []int     `json:"spell_list"`
+	CAList    []int     `json:"ca_list"`
+	Boons     []int     `json:"boons"`
+	Banes     []int     `json:"banes"`
+	Budding   *int      `json:"budding"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type Classes struct {
-	ID        int
-	Name      string
-	Rank      string
-	Base      []int
-	Bonus     []int
-	Growth    []int
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Rank   string `json:"rank"`
+	Base   []int  `json:"base"`
+	Bonus  []int  `json:"bonus"`
+	Growth []int  `json:"growth"`
+	// Mastering the class, by earning MasteryExp class EXP in it, teaches the
+	// mastery ability and/or combat art
+	MasteryAbilityID *int `json:"mastery_ability_id"` // This is the foreign key referencing Ability.ID
+	MasteryArtID     *int `json:"mastery_art_id"`     // This is the foreign key referencing CombatArts.ID
+	MasteryExp       *int `json:"mastery_exp"`
+	Movement         int  `json:"movement"`
+	// UnitTypes tags the class with validClassTypes, including its gender
+	// restriction
+	UnitTypes        []string `json:"unit_types"`
+	Proficiencies    []int    `json:"proficiencies"`      // The skills (Skills.ID) the class is proficient in
+	ExclusiveCharIDs []int    `json:"exclusive_char_ids"` // Set for classes only some characters can enter
+	// AbilityIDs are the abilities (Ability.ID) the class grants, those whose
+	// class_id references it. They are read-only.
+	AbilityIDs []int `json:"ability_ids"`
+	// Requirements are the skill ranks needed to pass the certification exam
+	Requirements []ClassRequirement `json:"requirements"`
+	// MaxStats caps the stats of the units in the class
+	MaxStats  []int     `json:"max_stats"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ClassRequirement is a skill rank needed to certify into a class
+type ClassRequirement struct {
+	SkillID int    `json:"skill_id"` // This is the foreign key referencing Skills.ID
+	Rank    string `json:"rank"`
+}
+
+type Crest struct {
+	ID               int       `json:"id"`
+	Name             string    `json:"name"`
+	ActivationEffect string    `json:"activation_effect"`
+	Trigger          string    `json:"trigger"`
+	EffectType       string    `json:"effect_type"`
+	EffectValue      *int      `json:"effect_value"`
+	MajorRate        string    `json:"major_rate"` // Activation rate formulas, in percent
+	MinorRate        string    `json:"minor_rate"`
+	Description      *string   `json:"description"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Ability is a passive skill such as Sword Prowess, Death Blow or a
+// character's personal ability. CharID, ClassID and SkillID link it to what
+// grants it, depending on its category.
+type Ability struct {
+	ID          int             `json:"id"`
+	Name        string          `json:"name"`
+	Category    string          `json:"category"`
+	Description string          `json:"description"`
+	Effects     []AbilityEffect `json:"effects"`
+	CharID      *int            `json:"char_id"`
+	ClassID     *int            `json:"class_id"`
+	SkillID     *int            `json:"skill_id"` // This is the foreign key referencing Skills.ID
+	SkillRank   *string         `json:"skill_rank"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// AbilityEffect is one effect of an ability. Stat names the stat or combat
+// value changed by Value; Condition describes when the effect applies, such
+// as "when a sword is equipped".
+type AbilityEffect struct {
+	Type      string  `json:"type"`
+	Stat      *string `json:"stat"`
+	Value     *int    `json:"value"`
+	Condition *string `json:"condition"`
+}
+
+// ClassMastery records the class EXP a character has earned in a class
+type ClassMastery struct {
+	ID        int       `json:"id"`
+	CharID    int       `json:"char_id"`
+	ClassID   int       `json:"class_id"`
+	Exp       int       `json:"exp"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Support links two characters who can build a support. Routes restricts it
+// to some routes, all of them when empty; a paired ending is unlocked by
+// reaching the highest rank.
+type Support struct {
+	ID           int       `json:"id"`
+	CharID       int       `json:"char_id"`
+	PartnerID    int       `json:"partner_id"`
+	Ranks        []string  `json:"ranks"`
+	Routes       []string  `json:"routes"`
+	PairedEnding bool      `json:"paired_ending"`
+	Ending       *string   `json:"ending"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Gambit is the special attack or support action a battalion can perform.
+// Area is the size of the affected zone, such as "1x1" or "3x3".
+type Gambit struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Might       *int      `json:"might"`
+	Hit         *int      `json:"hit"`
+	RangeMin    int       `json:"range_min"`
+	RangeMax    *int      `json:"range_max"`
+	Uses        int       `json:"uses"`
+	Area        string    `json:"area"`
+	Effect      string    `json:"effect"`
+	Description *string   `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Battalion is a unit a character can be assigned to lead. StatBonus is
+// added to the stats of its leader, in the order of the class stat arrays;
+// AuthorityRank is the rank in the Authority skill needed to lead it.
+type Battalion struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	StatBonus     []int     `json:"stat_bonus"`
+	Endurance     int       `json:"endurance"`
+	AuthorityID   int       `json:"authority_id"` // This is the foreign key referencing the Authority Skills.ID
+	AuthorityRank string    `json:"authority_rank"`
+	GambitID      *int      `json:"gambit_id"` // This is the foreign key referencing Gambit.ID
+	Description   *string   `json:"description"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Item is a piece of equipment, such as a shield or a ring, or a consumable
+// such as a vulnerary, a stat booster, a seal or a staff. Uses is nil for
+// equipment.
+type Item struct {
+	ID          int          `json:"id"`
+	Name        string       `json:"name"`
+	Category    string       `json:"category"`
+	Uses        *int         `json:"uses"`
+	Effects     []ItemEffect `json:"effects"`
+	Description *string      `json:"description"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// ItemEffect is one effect of an item. Stat names the stat changed by
+// Value; Target is the class rank a seal certifies into.
+type ItemEffect struct {
+	Type   string  `json:"type"`
+	Stat   *string `json:"stat"`
+	Value  *int    `json:"value"`
+	Target *string `json:"target"`
+}
+
+// InventoryEntry is an item or a weapon carried by a character. Uses counts
+// the uses or durability left; only a shield or a ring can be Equipped, in
+// the accessory slot.
+type InventoryEntry struct {
+	ID        int       `json:"id"`
+	CharID    int       `json:"char_id"`
+	ItemID    *int      `json:"item_id"`   // This is the foreign key referencing Item.ID
+	WeaponID  *int      `json:"weapon_id"` // This is the foreign key referencing Weapons.ID
+	Uses      *int      `json:"uses"`
+	Equipped  bool      `json:"equipped"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// OpenAPIController serves an OpenAPI 3 document generated from the route
+// table and the models it references
+type OpenAPIController struct {
+	spec []byte
+}
+
+func NewOpenAPIController(version apiVersion) (*OpenAPIController, error) {
+	spec, err := json.Marshal(buildOpenAPISpec(version))
+	if err != nil {
+		return nil, err
+	}
+
+	return &OpenAPIController{
+		spec: spec,
+	}, nil
+}
+
+func (oc *OpenAPIController) GetSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(oc.spec)
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// readOnlyFields are assigned by the server and ignored in request bodies.
+// The AbilityIDs of a class are derived from abilities.class_id.
+var readOnlyFields = map[string]bool{"ID": true, "CreatedAt": true, "UpdatedAt": true, "AbilityIDs": true}
+
+// openAPISchemas collects the component schemas while the paths are built
+type openAPISchemas map[string]interface{}
+
+func buildOpenAPISpec(version apiVersion) map[string]interface{} {
+	schemas := openAPISchemas{}
+	paths := map[string]map[string]interface{}{}
+
+	for _, route := range version.Routes {
+		item, ok := paths[route.Path]
+		if !ok {
+			item = map[string]interface{}{}
+			paths[route.Path] = item
+		}
+
+		operation := map[string]interface{}{
+			"summary":     route.Summary,
+			"operationId": operationID(route),
+			"tags":        []string{strings.Split(strings.TrimPrefix(route.Path, "/"), "/")[0]},
+			"responses":   openAPIResponses(route, schemas),
+		}
+
+		var parameters []interface{}
+		for _, match := range pathParamPattern.FindAllStringSubmatch(route.Path, -1) {
+			paramType := "string"
+			if strings.HasSuffix(match[1], "ID") {
+				paramType = "integer"
+			}
+			parameters = append(parameters, map[string]interface{}{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": paramType},
+			})
+		}
+		for _, param := range routeQueries[route.Method+" "+route.Path] {
+			parameters = append(parameters, map[string]interface{}{
+				"name":        param.Name,
+				"in":          "query",
+				"required":    false,
+				"description": param.Description,
+				"schema":      map[string]interface{}{"type": param.Type},
+			})
+		}
+		if conditionalHeader := conditionalRequestHeader(route); conditionalHeader != "" {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     conditionalHeader,
+				"in":       "header",
+				"required": false,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		if route.Request != nil {
+			contentType, schema := "application/json", schemas.schemaFor(reflect.TypeOf(route.Request))
+			if route.Method == "PATCH" {
+				contentType, schema = mergePatchContentType, schemas.patchSchemaFor(reflect.TypeOf(route.Request))
+			}
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					contentType: map[string]interface{}{"schema": schema},
+				},
+			}
+		}
+
+		item[strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title": "Fire Emblem: Three Houses API",
+			"description": "Models use snake_case member names. Clients written against the " +
+				"unversioned routes can keep the legacy Go-style names with ?" + jsonShapeParam + "=" + legacyShape +
+				" or the " + jsonShapeHeader + " header.",
+			"version": strings.TrimPrefix(version.Prefix, "/v") + ".0.0",
+		},
+		"servers": []interface{}{
+			map[string]interface{}{"url": version.Prefix},
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+		},
+	}
+}
+
+func openAPIResponses(route apiRoute, schemas openAPISchemas) map[string]interface{} {
+	errorContent := map[string]interface{}{
+		"application/json": map[string]interface{}{
+			"schema": schemas.schemaFor(reflect.TypeOf(errorResponse{})),
+		},
+	}
+
+	responses := map[string]interface{}{
+		"500": map[string]interface{}{"description": "Internal server error", "content": errorContent},
+		"429": map[string]interface{}{"description": "Rate limit exceeded, see Retry-After", "content": errorContent},
+	}
+	if route.Request != nil || strings.Contains(route.Path, "{") {
+		responses["400"] = map[string]interface{}{"description": "Invalid request", "content": errorContent}
+	}
+	if route.Request != nil {
+		responses["422"] = map[string]interface{}{"description": "Request body failed validation", "content": errorContent}
+	}
+	if route.Method != "GET" {
+		responses["409"] = map[string]interface{}{"description": "Conflicts with another resource", "content": errorContent}
+	}
+	if strings.Contains(route.Path, "{") && (route.Response == nil || reflect.TypeOf(route.Response).Kind() != reflect.Slice) {
+		responses["404"] = map[string]interface{}{"description": "Not found", "content": errorContent}
+	}
+	switch conditionalRequestHeader(route) {
+	case "If-None-Match":
+		responses["304"] = map[string]interface{}{"description": "Not modified since the ETag in If-None-Match"}
+	case "If-Match":
+		responses["412"] = map[string]interface{}{"description": "The ETag in If-Match is out of date", "content": errorContent}
+	}
+	if route.Response != nil {
+		responses["200"] = map[string]interface{}{
+			"description": "Successful response",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": schemas.schemaFor(reflect.TypeOf(route.Response)),
+				},
+			},
+		}
+	}
+
+	return responses
+}
+
+// conditionalRequestHeader returns the precondition header honoured by the
+// route: If-None-Match on single-resource reads, If-Match on writes to an
+// existing resource
+func conditionalRequestHeader(route apiRoute) string {
+	if !strings.Contains(route.Path, "{") {
+		return ""
+	}
+	switch route.Method {
+	case "GET":
+		if route.Response != nil && reflect.TypeOf(route.Response).Kind() != reflect.Slice {
+			return "If-None-Match"
+		}
+	case "PUT", "PATCH", "DELETE":
+		return "If-Match"
+	}
+	return ""
+}
+
+// operationID derives a stable identifier such as "getCharactersByCharID"
+func operationID(route apiRoute) string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToLower(route.Method))
+	for _, segment := range strings.Split(route.Path, "/") {
+		if segment == "" {
+			continue
+		}
+		if match := pathParamPattern.FindStringSubmatch(segment); match != nil {
+			sb.WriteString("By")
+			segment = match[1]
+		}
+		for _, word := range strings.Split(segment, "_") {
+			if word != "" {
+				sb.WriteString(strings.ToUpper(word[:1]) + word[1:])
+			}
+		}
+	}
+	return sb.String()
+}
+
+// schemaFor returns the schema of t, registering named structs as components
+// and referencing them
+func (s openAPISchemas) schemaFor(t reflect.Type) map[string]interface{} {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var schema map[string]interface{}
+	switch {
+	case t == timeType:
+		schema = map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct:
+		if _, ok := s[t.Name()]; !ok {
+			// Reserve the name first so self-referencing types terminate
+			s[t.Name()] = nil
+			s[t.Name()] = s.structSchema(t)
+		}
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if !nullable {
+			return ref
+		}
+		return map[string]interface{}{"allOf": []interface{}{ref}, "nullable": true}
+	case t.Kind() == reflect.Slice:
+		// encoding/json writes nil slices as null
+		schema = map[string]interface{}{"type": "array", "items": s.schemaFor(t.Elem()), "nullable": true}
+	case t.Kind() == reflect.Array:
+		schema = map[string]interface{}{"type": "array", "items": s.schemaFor(t.Elem())}
+	case t.Kind() == reflect.Map:
+		schema = map[string]interface{}{"type": "object", "additionalProperties": s.schemaFor(t.Elem())}
+	case t.Kind() == reflect.Bool:
+		schema = map[string]interface{}{"type": "boolean"}
+	case t.Kind() == reflect.String:
+		schema = map[string]interface{}{"type": "string"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		schema = map[string]interface{}{"type": "integer"}
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		schema = map[string]interface{}{"type": "integer", "minimum": 0}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema = map[string]interface{}{"type": "number"}
+	default:
+		schema = map[string]interface{}{}
+	}
+
+	if nullable {
+		schema["nullable"] = true
+	}
+	return schema
+}
+
+// patchSchemaFor registers a variant of the struct schema for JSON Merge
+// Patch bodies, where every member is optional and null clears a value
+func (s openAPISchemas) patchSchemaFor(t reflect.Type) map[string]interface{} {
+	name := t.Name() + "Patch"
+	if _, ok := s[name]; !ok {
+		schema := s.structSchema(t)
+		delete(schema, "required")
+		s[name] = schema
+	}
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// structSchema describes the object encoding/json writes for t. The fields
+// of untagged embedded structs are promoted into it, fields of t taking
+// precedence over them as they do for encoding/json.
+func (s openAPISchemas) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	var embedded []reflect.Type
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if embeddedStruct(field) {
+			embedded = append(embedded, field.Type)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		name, omitempty := jsonFieldName(field)
+		if name == "-" {
+			continue
+		}
+
+		property := s.schemaFor(field.Type)
+		if readOnlyFields[field.Name] {
+			property["readOnly"] = true
+		}
+		properties[name] = property
+		if field.Type.Kind() != reflect.Ptr && !omitempty {
+			required = append(required, name)
+		}
+	}
+
+	for _, e := range embedded {
+		pointer := e.Kind() == reflect.Ptr
+		if pointer {
+			e = e.Elem()
+		}
+		inner := s.structSchema(e)
+		for name, property := range inner["properties"].(map[string]interface{}) {
+			if _, ok := properties[name]; !ok {
+				properties[name] = property
+			}
+		}
+		if innerRequired, ok := inner["required"].([]string); ok && !pointer {
+			for _, name := range innerRequired {
+				if !slices.Contains(required, name) {
+					required = append(required, name)
+				}
+			}
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// embeddedStruct reports whether encoding/json flattens the field: an
+// untagged embedded struct or pointer to a struct
+func embeddedStruct(field reflect.StructField) bool {
+	if !field.Anonymous || field.Tag.Get("json") != "" {
+		return false
+	}
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// jsonFieldName returns the key encoding/json uses for the field
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "" {
+		return field.Name, false
+	}
+
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	omitempty := false
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty
+}
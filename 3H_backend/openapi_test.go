@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestSchemaMatchesJSON checks that the schema of every request and response
+// model lists exactly the top-level keys encoding/json writes for it
+func TestSchemaMatchesJSON(t *testing.T) {
+	seen := map[reflect.Type]bool{}
+	for _, route := range apiRoutes(nil) {
+		for _, model := range []interface{}{route.Request, route.Response} {
+			if model == nil {
+				continue
+			}
+			modelType := reflect.TypeOf(model)
+			if modelType.Kind() == reflect.Slice {
+				modelType = modelType.Elem()
+			}
+			if modelType.Kind() != reflect.Struct || seen[modelType] {
+				continue
+			}
+			seen[modelType] = true
+
+			t.Run(modelType.Name(), func(t *testing.T) {
+				body, err := json.Marshal(reflect.New(modelType).Interface())
+				if err != nil {
+					t.Fatal(err)
+				}
+				var object map[string]interface{}
+				err = json.Unmarshal(body, &object)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				schema := openAPISchemas{}.structSchema(modelType)
+				got := sortedKeys(schema["properties"].(map[string]interface{}))
+				want := sortedKeys(object)
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("schema properties %v, JSON keys %v", got, want)
+				}
+
+				required, _ := schema["required"].([]string)
+				for _, name := range required {
+					if _, ok := object[name]; !ok {
+						t.Errorf("required property %q is not written by encoding/json", name)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestStructSchemaPromotesEmbeddedFields(t *testing.T) {
+	schema := openAPISchemas{}.structSchema(reflect.TypeOf(CharacterSupport{}))
+	properties := schema["properties"].(map[string]interface{})
+
+	for _, name := range []string{"id", "char_id", "partner_id", "ranks", "partner", "bonuses"} {
+		if _, ok := properties[name]; !ok {
+			t.Errorf("missing property %q", name)
+		}
+	}
+	if _, ok := properties["Support"]; ok {
+		t.Error("embedded struct documented as a property")
+	}
+	if required := schema["required"].([]string); !containsString(required, "char_id") || containsString(required, "Support") {
+		t.Errorf("required = %v", required)
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// TestOpenAPISpecCoversRoutes checks that every route is documented with its
+// path parameters and that the documented queries belong to a route
+func TestOpenAPISpecCoversRoutes(t *testing.T) {
+	routes := apiRoutes(nil)
+	spec := buildOpenAPISpec(apiVersion{Prefix: "/v1", Routes: routes})
+	paths := spec["paths"].(map[string]map[string]interface{})
+
+	operationIDs := map[string]bool{}
+	routeKeys := map[string]bool{}
+	for _, route := range routes {
+		key := route.Method + " " + route.Path
+		routeKeys[key] = true
+
+		operation, ok := paths[route.Path][strings.ToLower(route.Method)].(map[string]interface{})
+		if !ok {
+			t.Errorf("%s is missing from the spec", key)
+			continue
+		}
+
+		id := operation["operationId"].(string)
+		if operationIDs[id] {
+			t.Errorf("%s: duplicate operationId %q", key, id)
+		}
+		operationIDs[id] = true
+
+		parameters, _ := operation["parameters"].([]interface{})
+		for _, match := range pathParamPattern.FindAllStringSubmatch(route.Path, -1) {
+			found := false
+			for _, parameter := range parameters {
+				parameter := parameter.(map[string]interface{})
+				if parameter["in"] == "path" && parameter["name"] == match[1] {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("%s: path parameter %q is not documented", key, match[1])
+			}
+		}
+	}
+
+	for key := range routeQueries {
+		if !routeKeys[key] {
+			t.Errorf("query parameters documented for unknown route %s", key)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+)
+
+// mergePatchContentType is the media type of RFC 7396 JSON Merge Patch
+const mergePatchContentType = "application/merge-patch+json"
+
+// applyMergePatch applies the JSON Merge Patch in the request body to target,
+// which must be a pointer to a model. Members absent from the patch keep
+// their value, members set to null are cleared and every other member is
+// replaced, so zero values and empty arrays can be written. Read-only fields
+// such as ID and CreatedAt are never changed.
+func applyMergePatch(r *http.Request, target interface{}) error {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != mergePatchContentType && mediaType != "application/json") {
+			return BadRequest("Content-Type must be %s", mergePatchContentType)
+		}
+	}
+
+	limitBody(r)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return BadRequest("Invalid request body: %s", err)
+	}
+
+	var patch interface{}
+	err = json.Unmarshal(body, &patch)
+	if err != nil {
+		return BadRequest("Invalid request body: %s", err)
+	}
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return BadRequest("Invalid request body: merge patch must be a JSON object")
+	}
+	if wantsLegacyShape(r) {
+		patch = fromLegacyKeys(reflect.TypeOf(target).Elem(), patchObject)
+	}
+
+	currentJSON, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+	var current interface{}
+	err = json.Unmarshal(currentJSON, &current)
+	if err != nil {
+		return err
+	}
+
+	mergedJSON, err := json.Marshal(mergePatch(current, patch))
+	if err != nil {
+		return err
+	}
+
+	// Decode into a zero value so that removed members end up zero or null
+	targetValue := reflect.ValueOf(target).Elem()
+	merged := reflect.New(targetValue.Type())
+	decoder := json.NewDecoder(bytes.NewReader(mergedJSON))
+	if !wantsLegacyShape(r) {
+		decoder.DisallowUnknownFields()
+	}
+	err = decoder.Decode(merged.Interface())
+	if err != nil {
+		return BadRequest("Invalid request body: %s", err)
+	}
+
+	for name := range readOnlyFields {
+		if field := merged.Elem().FieldByName(name); field.IsValid() {
+			field.Set(targetValue.FieldByName(name))
+		}
+	}
+	targetValue.Set(merged.Elem())
+
+	return nil
+}
+
+// mergePatch implements the MergePatch algorithm of RFC 7396
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
+		}
+	}
+
+	return targetObject
+}
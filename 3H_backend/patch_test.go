@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	ending := "Together"
+	current := Support{ID: 7, CharID: 1, PartnerID: 2, Ranks: []string{"C", "B", "A"},
+		Routes: []string{"Azure Moon"}, PairedEnding: true, Ending: &ending, CreatedAt: created, UpdatedAt: created}
+
+	tests := []struct {
+		name  string
+		patch string
+		want  func(s *Support)
+	}{
+		{"empty patch", `{}`, func(s *Support) {}},
+		{"replace a scalar", `{"partner_id": 3}`, func(s *Support) { s.PartnerID = 3 }},
+		{"zero value", `{"paired_ending": false}`, func(s *Support) { s.PairedEnding = false }},
+		{"replace an array", `{"ranks": ["C"]}`, func(s *Support) { s.Ranks = []string{"C"} }},
+		{"empty array", `{"routes": []}`, func(s *Support) { s.Routes = []string{} }},
+		{"null clears a pointer", `{"ending": null}`, func(s *Support) { s.Ending = nil }},
+		{"null clears an array", `{"routes": null}`, func(s *Support) { s.Routes = nil }},
+		{"null zeroes a scalar", `{"char_id": null}`, func(s *Support) { s.CharID = 0 }},
+		{"read-only fields are kept", `{"id": 9, "created_at": "2030-01-01T00:00:00Z", "updated_at": null}`,
+			func(s *Support) {}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := current
+			target.Ranks = slices.Clone(current.Ranks)
+			target.Routes = slices.Clone(current.Routes)
+			want := target
+			test.want(&want)
+
+			r := httptest.NewRequest("PATCH", "/v1/supports/7", strings.NewReader(test.patch))
+			r.Header.Set("Content-Type", mergePatchContentType)
+			err := applyMergePatch(r, &target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(target, want) {
+				t.Errorf("patched %+v, want %+v", target, want)
+			}
+		})
+	}
+}
+
+func TestApplyMergePatchErrors(t *testing.T) {
+	tests := []struct {
+		name, contentType, patch string
+	}{
+		{"wrong content type", "text/plain", `{}`},
+		{"not an object", mergePatchContentType, `["C"]`},
+		{"invalid JSON", mergePatchContentType, `{"ranks":`},
+		{"unknown member", mergePatchContentType, `{"rank": "S"}`},
+		{"wrong type", mergePatchContentType, `{"partner_id": "two"}`},
+		{"too large", mergePatchContentType, `{"ranks": ["C"]` + strings.Repeat(" ", maxBodyBytes) + `}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("PATCH", "/v1/supports/7", strings.NewReader(test.patch))
+			r.Header.Set("Content-Type", test.contentType)
+			err := applyMergePatch(r, &Support{ID: 7})
+			if apiErr, ok := err.(*APIError); !ok || apiErr.Code != CodeBadRequest {
+				t.Errorf("applyMergePatch(%s) error = %v, want a bad request", test.patch, err)
+			}
+		})
+	}
+}
+
+func TestApplyMergePatchLegacyShape(t *testing.T) {
+	character := Character{ID: 3, Name: "Dimitri", HpGrowth: 55}
+	r := httptest.NewRequest("PATCH", "/characters/3", strings.NewReader(`{"HpGrowth": 60, "name": "Dimitri Alexandre", "Lance": "A"}`))
+	r.Header.Set(jsonShapeHeader, legacyShape)
+
+	err := applyMergePatch(r, &character)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if character.HpGrowth != 60 || character.Name != "Dimitri Alexandre" || character.ID != 3 {
+		t.Errorf("patched %+v", character)
+	}
+}
+
+func TestApplyMergePatchKeepsReadOnlyFields(t *testing.T) {
+	class := Classes{ID: 4, Name: "Myrmidon", AbilityIDs: []int{12}}
+	r := httptest.NewRequest("PATCH", "/v1/classes/4", strings.NewReader(`{"id": 9, "movement": 5, "ability_ids": [1, 2]}`))
+
+	err := applyMergePatch(r, &class)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if class.ID != 4 || !reflect.DeepEqual(class.AbilityIDs, []int{12}) || class.Movement != 5 {
+		t.Errorf("patched %+v", class)
+	}
+}
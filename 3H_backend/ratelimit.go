@@ -0,0 +1,204 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fe3h_backend/config"
+)
+
+// apiKeyHeader identifies a client holding one of the configured API keys.
+// Requests with a missing or unknown key are limited by client IP.
+const apiKeyHeader = "X-API-Key"
+
+// tokenBucket holds up to burst tokens and refills at rate tokens per second
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// bucketLimiter keeps one token bucket per client key
+type bucketLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// limitResult describes the state of a bucket after a request was counted
+type limitResult struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+func newBucketLimiter(perMinute, burst int) *bucketLimiter {
+	return &bucketLimiter{
+		rate:      float64(perMinute) / 60,
+		burst:     float64(burst),
+		buckets:   map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (bl *bucketLimiter) allow(key string, now time.Time) limitResult {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	bl.sweep(now)
+
+	b, ok := bl.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: bl.burst, last: now}
+		bl.buckets[key] = b
+	}
+	b.tokens = math.Min(bl.burst, b.tokens+now.Sub(b.last).Seconds()*bl.rate)
+	b.last = now
+
+	result := limitResult{limit: int(bl.burst)}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.allowed = true
+	} else {
+		result.retryAfter = bl.wait(1 - b.tokens)
+	}
+	result.remaining = int(b.tokens)
+	result.reset = bl.wait(bl.burst - b.tokens)
+	return result
+}
+
+// wait returns how long it takes to refill the given number of tokens
+func (bl *bucketLimiter) wait(tokens float64) time.Duration {
+	if bl.rate <= 0 {
+		return time.Hour
+	}
+	return time.Duration(tokens / bl.rate * float64(time.Second))
+}
+
+// sweep drops the buckets that have refilled completely, since they are
+// indistinguishable from new ones. It runs at most once a minute.
+func (bl *bucketLimiter) sweep(now time.Time) {
+	if now.Sub(bl.lastSweep) < time.Minute {
+		return
+	}
+	bl.lastSweep = now
+
+	full := bl.wait(bl.burst)
+	for key, b := range bl.buckets {
+		if now.Sub(b.last) >= full {
+			delete(bl.buckets, key)
+		}
+	}
+}
+
+// RateLimiter limits the API routes per client, with separate buckets for
+// reads and writes and for anonymous clients and API key holders
+type RateLimiter struct {
+	readIP   *bucketLimiter
+	readKey  *bucketLimiter
+	writeIP  *bucketLimiter
+	writeKey *bucketLimiter
+
+	apiKeys     map[string]bool
+	trustProxy  bool
+	trustedHops int
+}
+
+func NewRateLimiter(cfg config.RateLimitConfig) *RateLimiter {
+	rl := &RateLimiter{
+		readIP:      newBucketLimiter(cfg.Read.IPPerMinute, cfg.Read.IPBurst),
+		readKey:     newBucketLimiter(cfg.Read.KeyPerMinute, cfg.Read.KeyBurst),
+		writeIP:     newBucketLimiter(cfg.Write.IPPerMinute, cfg.Write.IPBurst),
+		writeKey:    newBucketLimiter(cfg.Write.KeyPerMinute, cfg.Write.KeyBurst),
+		apiKeys:     map[string]bool{},
+		trustProxy:  cfg.TrustProxy,
+		trustedHops: cfg.TrustedHops,
+	}
+	for _, key := range cfg.APIKeys {
+		rl.apiKeys[key] = true
+	}
+	return rl
+}
+
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter, key := rl.limiterFor(r)
+		result := limiter.allow(key, time.Now())
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.reset)))
+
+		if !result.allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.retryAfter)))
+			writeError(w, r, TooManyRequests("Rate limit exceeded"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (rl *RateLimiter) limiterFor(r *http.Request) (*bucketLimiter, string) {
+	read := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+
+	if apiKey := r.Header.Get(apiKeyHeader); rl.apiKeys[apiKey] {
+		if read {
+			return rl.readKey, apiKey
+		}
+		return rl.writeKey, apiKey
+	}
+
+	ip := rl.clientIP(r)
+	if read {
+		return rl.readIP, ip
+	}
+	return rl.writeIP, ip
+}
+
+// clientIP returns the address of the client. X-Forwarded-For is only
+// trusted when the API runs behind proxies that append to it.
+func (rl *RateLimiter) clientIP(r *http.Request) string {
+	if rl.trustProxy {
+		if ip := forwardedClientIP(r.Header.Values("X-Forwarded-For"), rl.trustedHops); ip != "" {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// forwardedClientIP returns the entry of the X-Forwarded-For headers that the
+// outermost of hops proxies appended, hops from the right. The client can set
+// the entries to its left, so they are ignored. It returns "" when there are
+// fewer entries than hops.
+func forwardedClientIP(headers []string, hops int) string {
+	var entries []string
+	for _, header := range headers {
+		for _, entry := range strings.Split(header, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if hops < 1 || len(entries) < hops {
+		return ""
+	}
+	return entries[len(entries)-hops]
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"fe3h_backend/config"
+)
+
+func TestForwardedClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		hops    int
+		want    string
+	}{
+		{"no header", nil, 1, ""},
+		{"one proxy", []string{"203.0.113.7"}, 1, "203.0.113.7"},
+		{"spoofed entry", []string{"198.51.100.1, 203.0.113.7"}, 1, "203.0.113.7"},
+		{"two proxies", []string{"198.51.100.1, 203.0.113.7, 10.0.0.2"}, 2, "203.0.113.7"},
+		{"repeated headers", []string{"198.51.100.1", "203.0.113.7"}, 1, "203.0.113.7"},
+		{"fewer entries than hops", []string{"203.0.113.7"}, 2, ""},
+		{"empty entries", []string{"203.0.113.7, ,"}, 1, "203.0.113.7"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := forwardedClientIP(test.headers, test.hops); got != test.want {
+				t.Errorf("forwardedClientIP(%q, %d) = %q, want %q", test.headers, test.hops, got, test.want)
+			}
+		})
+	}
+}
+
+func TestClientIPIgnoresRotatedHeaders(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{TrustProxy: true, TrustedHops: 1})
+
+	for _, spoofed := range []string{"1.1.1.1", "2.2.2.2"} {
+		r := httptest.NewRequest("GET", "/v1/characters", nil)
+		r.Header.Set("X-Forwarded-For", spoofed+", 203.0.113.7")
+		if got := rl.clientIP(r); got != "203.0.113.7" {
+			t.Errorf("clientIP = %q with %s spoofed, want 203.0.113.7", got, spoofed)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/v1/characters", nil)
+	r.RemoteAddr = "192.0.2.1:4242"
+	if got := rl.clientIP(r); got != "192.0.2.1" {
+		t.Errorf("clientIP without X-Forwarded-For = %q, want 192.0.2.1", got)
+	}
+}
+
+func TestBucketLimiter(t *testing.T) {
+	// 60 a minute is one token a second
+	bl := newBucketLimiter(60, 3)
+	start := time.Now()
+
+	tests := []struct {
+		name      string
+		at        time.Duration
+		allowed   bool
+		remaining int
+	}{
+		{"first request", 0, true, 2},
+		{"second request", 0, true, 1},
+		{"last token", 0, true, 0},
+		{"burst used up", 0, false, 0},
+		{"half a token later", 500 * time.Millisecond, false, 0},
+		{"one token later", time.Second, true, 0},
+		{"refilled to the burst", time.Hour, true, 2},
+	}
+
+	for _, test := range tests {
+		result := bl.allow("client", start.Add(test.at))
+		if result.allowed != test.allowed || result.remaining != test.remaining {
+			t.Errorf("%s: allowed %t, remaining %d; want %t, %d", test.name, result.allowed,
+				result.remaining, test.allowed, test.remaining)
+		}
+		if !result.allowed && result.retryAfter <= 0 {
+			t.Errorf("%s: retryAfter = %s, want positive", test.name, result.retryAfter)
+		}
+	}
+
+	if result := bl.allow("other client", start); !result.allowed || result.remaining != 2 {
+		t.Errorf("other client shares the bucket: %+v", result)
+	}
+}
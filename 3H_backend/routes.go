@@ -0,0 +1,251 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// apiRoute describes one endpoint of the API. The same table is used to
+// register the handlers on the router and to generate the OpenAPI document,
+// so the two cannot drift apart.
+type apiRoute struct {
+	Method  string
+	Path    string
+	Handler http.HandlerFunc
+	Summary string
+	// Request and Response hold a zero value of the body type, nil when the
+	// endpoint has no body. Use a slice for endpoints returning a list.
+	Request  interface{}
+	Response interface{}
+}
+
+// deleteResult is the body returned by every DeleteOne handler
+type deleteResult struct {
+	Success bool   `json:"success"`
+	Msg     string `json:"msg"`
+}
+
+func apiRoutes(db *sql.DB) []apiRoute {
+	characterController := NewCharacterController(db)
+	skillsController := NewSkillsController(db)
+	spellsController := NewSpellsController(db)
+	combatArtController := NewCombatArtController(db)
+	weaponsController := NewWeaponsController(db)
+	charSkillsController := NewCharSkillsController(db)
+	classController := NewClassController(db)
+	crestController := NewCrestController(db)
+	forecastController := NewForecastController(db)
+	abilityController := NewAbilityController(db)
+	masteryController := NewMasteryController(db)
+	supportController := NewSupportController(db)
+	battalionController := NewBattalionController(db)
+	gambitController := NewGambitController(db)
+	itemController := NewItemController(db)
+	inventoryController := NewInventoryController(db)
+
+	return []apiRoute{
+		{"GET", "/characters", characterController.GetAll, "List all characters", nil, []Character{}},
+		{"GET", "/characters/{charID}", characterController.GetOne, "Get a character by ID", nil, Character{}},
+		{"GET", "/characters/house/{affinity}", characterController.GetByAffinity, "List the characters of a house", nil, []Character{}},
+		{"GET", "/characters/name/{charName}", characterController.GetByName, "Get a character by name", nil, Character{}},
+		{"POST", "/characters", characterController.PostOne, "Create a character", Character{}, Character{}},
+		{"PUT", "/characters/{charID}", characterController.PutOne, "Replace a character", Character{}, Character{}},
+		{"PATCH", "/characters/{charID}", characterController.PatchOne, "Partially update a character", Character{}, Character{}},
+		{"DELETE", "/characters/{charID}", characterController.DeleteOne, "Delete a character", nil, deleteResult{}},
+		{"GET", "/characters/{charID}/forecast", forecastController.GetForecast, "Compute the combat forecast of a character", nil, Forecast{}},
+		{"GET", "/characters/{charID}/masteries", masteryController.GetAll, "Report the class masteries of a character", nil, MasteryReport{}},
+		{"PUT", "/characters/{charID}/masteries/{classID}", masteryController.PutOne, "Set the class EXP a character has earned in a class", ClassMastery{}, ClassMastery{}},
+		{"PATCH", "/characters/{charID}/masteries/{classID}", masteryController.PatchOne, "Partially update the class EXP a character has earned in a class", ClassMastery{}, ClassMastery{}},
+		{"DELETE", "/characters/{charID}/masteries/{classID}", masteryController.DeleteOne, "Forget the class EXP a character has earned in a class", nil, deleteResult{}},
+		{"GET", "/characters/{charID}/supports", supportController.GetByCharacter, "List the supports of a character", nil, []CharacterSupport{}},
+		{"GET", "/characters/{charID}/inventory", inventoryController.GetAll, "List the inventory of a character", nil, Inventory{}},
+		{"POST", "/characters/{charID}/inventory", inventoryController.PostOne, "Put an item or a weapon in the inventory of a character", InventoryEntry{}, InventoryEntry{}},
+		{"PUT", "/characters/{charID}/inventory/{entryID}", inventoryController.PutOne, "Replace an inventory entry", InventoryEntry{}, InventoryEntry{}},
+		{"PATCH", "/characters/{charID}/inventory/{entryID}", inventoryController.PatchOne, "Partially update an inventory entry", InventoryEntry{}, InventoryEntry{}},
+		{"DELETE", "/characters/{charID}/inventory/{entryID}", inventoryController.DeleteOne, "Take an entry out of the inventory of a character", nil, deleteResult{}},
+
+		{"GET", "/skill_types", skillsController.GetAll, "List all skill types", nil, []Skills{}},
+		{"GET", "/skill_types/{skillID}", skillsController.GetOne, "Get a skill type by ID", nil, Skills{}},
+		{"POST", "/skill_types", skillsController.PostOne, "Create a skill type", Skills{}, Skills{}},
+		{"PUT", "/skill_types/{skillID}", skillsController.PutOne, "Replace a skill type", Skills{}, Skills{}},
+		{"PATCH", "/skill_types/{skillID}", skillsController.PatchOne, "Partially update a skill type", Skills{}, Skills{}},
+		{"DELETE", "/skill_types/{skillID}", skillsController.DeleteOne, "Delete a skill type", nil, deleteResult{}},
+
+		{"GET", "/spells", spellsController.GetAll, "List all spells", nil, []Spells{}},
+		{"GET", "/spells/{spellID}", spellsController.GetOne, "Get a spell by ID", nil, Spells{}},
+		{"POST", "/spells", spellsController.PostOne, "Create a spell", Spells{}, Spells{}},
+		{"PUT", "/spells/{spellID}", spellsController.PutOne, "Replace a spell", Spells{}, Spells{}},
+		{"PATCH", "/spells/{spellID}", spellsController.PatchOne, "Partially update a spell", Spells{}, Spells{}},
+		{"DELETE", "/spells/{spellID}", spellsController.DeleteOne, "Delete a spell", nil, deleteResult{}},
+
+		{"GET", "/combat_arts", combatArtController.GetAll, "List all combat arts", nil, []CombatArts{}},
+		{"GET", "/combat_arts/{artID}", combatArtController.GetOne, "Get a combat art by ID", nil, CombatArts{}},
+		{"POST", "/combat_arts", combatArtController.PostOne, "Create a combat art", CombatArts{}, CombatArts{}},
+		{"PUT", "/combat_arts/{artID}", combatArtController.PutOne, "Replace a combat art", CombatArts{}, CombatArts{}},
+		{"PATCH", "/combat_arts/{artID}", combatArtController.PatchOne, "Partially update a combat art", CombatArts{}, CombatArts{}},
+		{"DELETE", "/combat_arts/{artID}", combatArtController.DeleteOne, "Delete a combat art", nil, deleteResult{}},
+
+		{"GET", "/weapons", weaponsController.GetAll, "List all weapons", nil, []Weapons{}},
+		{"GET", "/weapons/{weaponID}", weaponsController.GetOne, "Get a weapon by ID", nil, Weapons{}},
+		{"GET", "/weapons/name/{weaponName}", weaponsController.GetOneName, "List the weapons whose name starts with weaponName", nil, []Weapons{}},
+		{"POST", "/weapons", weaponsController.PostOne, "Create a weapon", Weapons{}, Weapons{}},
+		{"PUT", "/weapons/{weaponID}", weaponsController.PutOne, "Replace a weapon", Weapons{}, Weapons{}},
+		{"PATCH", "/weapons/{weaponID}", weaponsController.PatchOne, "Partially update a weapon", Weapons{}, Weapons{}},
+		{"DELETE", "/weapons/{weaponID}", weaponsController.DeleteOne, "Delete a weapon", nil, deleteResult{}},
+
+		{"GET", "/charskilllist", charSkillsController.GetAll, "List all character skill lists", nil, []CharSkill{}},
+		{"GET", "/charskilllist/{listID}", charSkillsController.GetOneByID, "Get a character skill list by ID", nil, CharSkill{}},
+		{"GET", "/charskilllist/char/{charID}", charSkillsController.GetOneByCharID, "Get the skill list of a character", nil, CharSkill{}},
+		{"POST", "/charskilllist", charSkillsController.PostOne, "Create a character skill list", CharSkill{}, CharSkill{}},
+		{"PUT", "/charskilllist/{listID}", charSkillsController.PutOne, "Replace a character skill list", CharSkill{}, CharSkill{}},
+		{"PATCH", "/charskilllist/{listID}", charSkillsController.PatchOne, "Partially update a character skill list", CharSkill{}, CharSkill{}},
+		{"DELETE", "/charskilllist/{listID}", charSkillsController.DeleteOne, "Delete a character skill list", nil, deleteResult{}},
+
+		{"GET", "/classes", classController.GetAll, "List all classes", nil, []Classes{}},
+		{"GET", "/classes/tree", classController.GetTree, "Get the class progression graph", nil, ClassTree{}},
+		{"GET", "/classes/tree/path", classController.GetPath, "Find the shortest certification path between two classes", nil, ClassPath{}},
+		{"GET", "/classes/{classID}", classController.GetOne, "Get a class by ID", nil, Classes{}},
+		{"POST", "/classes", classController.PostOne, "Create a class", Classes{}, Classes{}},
+		{"PUT", "/classes/{classID}", classController.PutOne, "Replace a class", Classes{}, Classes{}},
+		{"PATCH", "/classes/{classID}", classController.PatchOne, "Partially update a class", Classes{}, Classes{}},
+		{"DELETE", "/classes/{classID}", classController.DeleteOne, "Delete a class", nil, deleteResult{}},
+
+		{"GET", "/crests", crestController.GetAll, "List all crests", nil, []Crest{}},
+		{"GET", "/crests/{crestID}", crestController.GetOne, "Get a crest by ID", nil, Crest{}},
+		{"GET", "/crests/{crestID}/bearers", crestController.GetBearers, "List the characters bearing a crest", nil, []Character{}},
+		{"POST", "/crests", crestController.PostOne, "Create a crest", Crest{}, Crest{}},
+		{"PUT", "/crests/{crestID}", crestController.PutOne, "Replace a crest", Crest{}, Crest{}},
+		{"PATCH", "/crests/{crestID}", crestController.PatchOne, "Partially update a crest", Crest{}, Crest{}},
+		{"DELETE", "/crests/{crestID}", crestController.DeleteOne, "Delete a crest", nil, deleteResult{}},
+
+		{"GET", "/supports", supportController.GetAll, "List all supports", nil, []Support{}},
+		{"GET", "/supports/{supportID}", supportController.GetOne, "Get a support by ID", nil, Support{}},
+		{"POST", "/supports", supportController.PostOne, "Create a support", Support{}, Support{}},
+		{"PUT", "/supports/{supportID}", supportController.PutOne, "Replace a support", Support{}, Support{}},
+		{"PATCH", "/supports/{supportID}", supportController.PatchOne, "Partially update a support", Support{}, Support{}},
+		{"DELETE", "/supports/{supportID}", supportController.DeleteOne, "Delete a support", nil, deleteResult{}},
+
+		{"GET", "/battalions", battalionController.GetAll, "List all battalions", nil, []Battalion{}},
+		{"GET", "/battalions/{battalionID}", battalionController.GetOne, "Get a battalion by ID", nil, Battalion{}},
+		{"POST", "/battalions", battalionController.PostOne, "Create a battalion", Battalion{}, Battalion{}},
+		{"PUT", "/battalions/{battalionID}", battalionController.PutOne, "Replace a battalion", Battalion{}, Battalion{}},
+		{"PATCH", "/battalions/{battalionID}", battalionController.PatchOne, "Partially update a battalion", Battalion{}, Battalion{}},
+		{"DELETE", "/battalions/{battalionID}", battalionController.DeleteOne, "Delete a battalion", nil, deleteResult{}},
+
+		{"GET", "/gambits", gambitController.GetAll, "List all gambits", nil, []Gambit{}},
+		{"GET", "/gambits/{gambitID}", gambitController.GetOne, "Get a gambit by ID", nil, Gambit{}},
+		{"POST", "/gambits", gambitController.PostOne, "Create a gambit", Gambit{}, Gambit{}},
+		{"PUT", "/gambits/{gambitID}", gambitController.PutOne, "Replace a gambit", Gambit{}, Gambit{}},
+		{"PATCH", "/gambits/{gambitID}", gambitController.PatchOne, "Partially update a gambit", Gambit{}, Gambit{}},
+		{"DELETE", "/gambits/{gambitID}", gambitController.DeleteOne, "Delete a gambit", nil, deleteResult{}},
+
+		{"GET", "/items", itemController.GetAll, "List all items", nil, []Item{}},
+		{"GET", "/items/{itemID}", itemController.GetOne, "Get an item by ID", nil, Item{}},
+		{"POST", "/items", itemController.PostOne, "Create an item", Item{}, Item{}},
+		{"PUT", "/items/{itemID}", itemController.PutOne, "Replace an item", Item{}, Item{}},
+		{"PATCH", "/items/{itemID}", itemController.PatchOne, "Partially update an item", Item{}, Item{}},
+		{"DELETE", "/items/{itemID}", itemController.DeleteOne, "Delete an item", nil, deleteResult{}},
+
+		{"GET", "/abilities", abilityController.GetAll, "List all abilities", nil, []Ability{}},
+		{"GET", "/abilities/{abilityID}", abilityController.GetOne, "Get an ability by ID", nil, Ability{}},
+		{"POST", "/abilities", abilityController.PostOne, "Create an ability", Ability{}, Ability{}},
+		{"PUT", "/abilities/{abilityID}", abilityController.PutOne, "Replace an ability", Ability{}, Ability{}},
+		{"PATCH", "/abilities/{abilityID}", abilityController.PatchOne, "Partially update an ability", Ability{}, Ability{}},
+		{"DELETE", "/abilities/{abilityID}", abilityController.DeleteOne, "Delete an ability", nil, deleteResult{}},
+	}
+}
+
+// queryParameter documents a query string parameter of a route
+type queryParameter struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// routeQueries lists the query parameters of the routes accepting them,
+// keyed by method and path
+var routeQueries = map[string][]queryParameter{
+	"GET /characters/{charID}": {
+		{"caps", "boolean", "Add stat_caps, checking the base stats against the max stats"},
+		{"class_id", "integer", "Class whose max stats also cap the stats, with caps=true"},
+	},
+	"GET /characters/{charID}/forecast": {
+		{"level", "integer", "Level of the character, its base level by default"},
+		{"class_id", "integer", "Class the character is in"},
+		{"weapon_id", "integer", "Weapon attacked with"},
+		{"spell_id", "integer", "Spell attacked with, instead of a weapon"},
+		{"combat_art_id", "integer", "Combat art used with the weapon"},
+		{"battalion_id", "integer", "Battalion the character leads"},
+		{"item_id", "integer", "Shield or ring of the inventory to equip, the equipped accessory by default"},
+		{"ally", "string", "Adjacent ally and the support rank reached with it, such as 12:B; repeat for up to 4 allies"},
+	},
+	"GET /abilities": {
+		{"category", "string", "Category of the abilities: personal, class, class_mastery, skill_rank or budding_talent"},
+		{"char_id", "integer", "Character the abilities belong to"},
+		{"class_id", "integer", "Class granting the abilities"},
+		{"skill_id", "integer", "Skill the abilities are learned in"},
+	},
+	"GET /characters/{charID}/supports": {
+		{"route", "string", "Route the supports must be available on, such as Azure Moon"},
+	},
+	"GET /items": {
+		{"category", "string", "Category of the items: shield, ring, vulnerary, stat_booster, seal or staff"},
+	},
+	"GET /classes": {
+		{"rank", "string", "Rank of the classes, such as Advanced"},
+		{"unit_type", "string", "Unit type tag the classes must have, such as flying; repeat to require several"},
+		{"proficiency", "integer", "Skill the classes must be proficient in; repeat to require several"},
+		{"ability_id", "integer", "Ability the classes must grant"},
+		{"gender", "string", "female or male: leave out the classes restricted to the other gender"},
+		{"char_id", "integer", "Leave out the classes exclusive to other characters"},
+	},
+	"GET /classes/tree/path": {
+		{"from", "string", "ID or name of the class to start from, such as Commoner"},
+		{"to", "string", "ID or name of the class to reach, such as Falcon Knight"},
+	},
+	"GET /weapons": {
+		{"effect", "string", "Effect the weapons must have, such as brave or effective_flying; repeat to require several"},
+	},
+}
+
+// registerRoutes mounts every route of the table on the router
+func registerRoutes(r *mux.Router, routes []apiRoute) {
+	for _, route := range routes {
+		r.HandleFunc(route.Path, route.Handler).Methods(route.Method)
+	}
+}
+
+// noRouteHandler answers the requests no route matches: 405, listing in
+// Allow the methods served, when the path is known and 404 otherwise. It
+// checks the path itself rather than relying on gorilla/mux, which reports
+// a path served by a subrouter as not found when a later route of the
+// subrouter does not match it.
+func noRouteHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := allowedMethods(router, r)
+		if len(allowed) == 0 {
+			writeError(w, r, NotFound("Route not found"))
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, r, MethodNotAllowed("Method %s is not allowed on %s", r.Method, r.URL.Path))
+	})
+}
+
+// allowedMethods lists the methods a route of the router serves the path of
+// the request with
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	var allowed []string
+	for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+		var match mux.RouteMatch
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if router.Match(probe, &match) && match.MatchErr == nil {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMethodNotAllowed(t *testing.T) {
+	r := mux.NewRouter()
+	r.NotFoundHandler = noRouteHandler(r)
+	r.MethodNotAllowedHandler = noRouteHandler(r)
+	registerVersions(r, []apiVersion{{Prefix: "/v1", Routes: []apiRoute{
+		{Method: "GET", Path: "/openapi.json", Handler: answer("spec")},
+		{Method: "GET", Path: "/characters/{charID}", Handler: answer("one")},
+		{Method: "PUT", Path: "/characters/{charID}", Handler: answer("replaced")},
+	}}})
+
+	tests := []struct {
+		method, path, allow string
+	}{
+		{"DELETE", "/v1/openapi.json", "GET"},
+		{"POST", "/v1/characters/3", "GET, PUT"},
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v1/unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown path: status %d, want 404", w.Code)
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("status %d, want 405", w.Code)
+			}
+			if allow := w.Header().Get("Allow"); allow != test.allow {
+				t.Errorf("Allow = %q, want %q", allow, test.allow)
+			}
+			var body errorResponse
+			err := json.Unmarshal(w.Body.Bytes(), &body)
+			if err != nil || body.Error.Code != CodeMethodNotAllowed {
+				t.Errorf("body %q is not a method_not_allowed error envelope", w.Body.String())
+			}
+		})
+	}
+}
@@ -2,12 +2,9 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -26,26 +23,17 @@ func NewSkillsController(db *sql.DB) *SkillsController {
 func (cc *SkillsController) GetAll(w http.ResponseWriter, r *http.Request) {
 	skills, err := cc.getAllSkills()
 	if err != nil {
-		log.Printf("Error querying all skill types: %s", err)
-		http.Error(w, fmt.Sprintf("Error getting skill types: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting skill types: %w", err))
 		return
 	}
 
-	responseJSON, err := json.Marshal(skills)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding skill types to JSON: %s", err), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	writeJSON(w, r, http.StatusOK, skills)
 }
 
 func (cc *SkillsController) getAllSkills() ([]Skills, error) {
 
 	rows, err := cc.db.Query("SELECT * FROM skills")
 	if err != nil {
-		log.Printf("Error querying all skill types: %s", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -68,29 +56,26 @@ func (cc *SkillsController) GetOne(w http.ResponseWriter, r *http.Request) {
 	skillID := mux.Vars(r)["skillID"]
 	id, err := strconv.Atoi(skillID)
 	if err != nil {
-		http.Error(w, "Invalid skill type ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid skill type ID"))
 		return
 	}
 
 	skill, err := cc.getSkillByID(id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting skill type: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting skill type: %w", err))
 		return
 	}
 
 	if skill == nil {
-		http.Error(w, "Skill type not found", http.StatusNotFound)
+		writeError(w, r, NotFound("Skill type not found"))
 		return
 	}
 
-	responseJSON, err := json.Marshal(skill)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding skill type  to JSON: %s", err), http.StatusInternalServerError)
+	if writeNotModified(w, r, etagFor(skill.ID, skill.UpdatedAt)) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	writeJSON(w, r, http.StatusOK, skill)
 }
 
 func (cc *SkillsController) getSkillByID(id int) (*Skills, error) {
@@ -111,29 +96,29 @@ func (cc *SkillsController) getSkillByID(id int) (*Skills, error) {
 
 func (cc *SkillsController) PostOne(w http.ResponseWriter, r *http.Request) {
 	var skill Skills
-	err := json.NewDecoder(r.Body).Decode(&skill)
+	err := decodeJSON(r, &skill)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error decoding request body: %s", err), http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
 		return
 	}
 
-	skill.CreatedAt = time.Now()
-	skill.UpdatedAt = time.Now()
-
-	err = cc.insertSkill(&skill)
+	err = skill.Validate()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error inserting skill type : %s", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	responseJSON, err := json.Marshal(skill)
+	skill.CreatedAt = time.Now()
+	skill.UpdatedAt = time.Now()
+
+	err = cc.insertSkill(&skill)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding skill type  to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error inserting skill type : %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	w.Header().Set("ETag", etagFor(skill.ID, skill.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, skill)
 }
 
 func (cc *SkillsController) insertSkill(skill *Skills) error {
@@ -141,8 +126,8 @@ func (cc *SkillsController) insertSkill(skill *Skills) error {
 	err := cc.db.QueryRow(`
 		INSERT INTO skills (name, skill_icon, created_at, updated_at)
 		VALUES ($1, $2, $3, $4)
-		RETURNING id
-	`, skill.Name, skill.SkillIcon, skill.CreatedAt, skill.UpdatedAt).Scan(&skill.ID)
+		RETURNING id, created_at, updated_at
+	`, skill.Name, skill.SkillIcon, skill.CreatedAt, skill.UpdatedAt).Scan(&skill.ID, &skill.CreatedAt, &skill.UpdatedAt)
 
 	if err != nil {
 		return err
@@ -155,59 +140,117 @@ func (cc *SkillsController) PutOne(w http.ResponseWriter, r *http.Request) {
 	skillID := mux.Vars(r)["skillID"]
 	id, err := strconv.Atoi(skillID)
 	if err != nil {
-		http.Error(w, "Invalid skill type ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid skill type ID"))
 		return
 	}
 
 	var updatedSkill Skills
-	err = json.NewDecoder(r.Body).Decode(&updatedSkill)
+	err = decodeJSON(r, &updatedSkill)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error decoding request body: %s", err), http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
 		return
 	}
 
-	updatedSkill.UpdatedAt = time.Now()
+	err = updatedSkill.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	current, err := cc.getSkillByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting skill type: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Skill type not found"))
+		return
+	}
 
-	err = cc.updateSkill(id, &updatedSkill)
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error updating skill type: %s", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	responseJSON, err := json.Marshal(updatedSkill)
+	updatedSkill.UpdatedAt = time.Now()
+
+	err = cc.updateSkill(id, &updatedSkill, current.UpdatedAt)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding updated skill type to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error updating skill type: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	w.Header().Set("ETag", etagFor(updatedSkill.ID, updatedSkill.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedSkill)
 }
 
-func (cc *SkillsController) updateSkill(id int, updatedSkill *Skills) error {
-	// Start building the SQL query
-	query := "UPDATE skills SET updated_at = $1"
-	args := []interface{}{updatedSkill.UpdatedAt}
+func (cc *SkillsController) PatchOne(w http.ResponseWriter, r *http.Request) {
+	skillID := mux.Vars(r)["skillID"]
+	id, err := strconv.Atoi(skillID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid skill type ID"))
+		return
+	}
 
-	// Conditionally include fields in the update query
-	if updatedSkill.Name != "" {
-		query += ", name = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedSkill.Name)
+	updatedSkill, err := cc.getSkillByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting skill type: %w", err))
+		return
 	}
-	if updatedSkill.SkillIcon != nil {
-		query += ", skill_icon = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedSkill.SkillIcon)
+
+	if updatedSkill == nil {
+		writeError(w, r, NotFound("Skill type not found"))
+		return
 	}
 
-	// Finish the query with the WHERE clause
-	query += " WHERE id = $" + strconv.Itoa(len(args)+1)
-	args = append(args, id)
-	err := cc.db.QueryRow(query+" RETURNING *", args...).Scan(
+	version := updatedSkill.UpdatedAt
+	err = checkIfMatch(r, etagFor(updatedSkill.ID, version))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = applyMergePatch(r, updatedSkill)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = updatedSkill.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedSkill.UpdatedAt = time.Now()
+
+	err = cc.updateSkill(id, updatedSkill, version)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating skill type: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedSkill.ID, updatedSkill.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedSkill)
+}
+
+func (cc *SkillsController) updateSkill(id int, updatedSkill *Skills, version time.Time) error {
+	// Every column is written so that PUT replaces the whole skill type. The row is
+	// only updated if it has not changed since version was read.
+	err := cc.db.QueryRow(`
+		UPDATE skills SET name = $1, skill_icon = $2, updated_at = $3
+		WHERE id = $4 AND updated_at = $5
+		RETURNING *
+	`, updatedSkill.Name, updatedSkill.SkillIcon, updatedSkill.UpdatedAt, id, version).Scan(
 		&updatedSkill.ID, &updatedSkill.Name,
 		&updatedSkill.SkillIcon, &updatedSkill.CreatedAt,
 		&updatedSkill.UpdatedAt)
 
-	if err != nil {
+	if err == sql.ErrNoRows {
+		return Conflict("Skill type with ID %d was modified or deleted by another request", id)
+	} else if err != nil {
 		return err
 	}
 
@@ -218,41 +261,51 @@ func (cc *SkillsController) DeleteOne(w http.ResponseWriter, r *http.Request) {
 	skillID := mux.Vars(r)["skillID"]
 	id, err := strconv.Atoi(skillID)
 	if err != nil {
-		http.Error(w, "Invalid skill type ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid skill type ID"))
 		return
 	}
 
-	err = cc.deleteSkill(id)
+	current, err := cc.getSkillByID(id)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, fmt.Sprintf("Skill type with ID %d not found", id), http.StatusNotFound)
-		} else {
-			http.Error(w, fmt.Sprintf("Error deleting skill type: %s", err), http.StatusInternalServerError)
-		}
+		writeError(w, r, fmt.Errorf("error getting skill type: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"success": true, "msg": "Skill type deleted successfully."}`))
-}
+	if current == nil {
+		writeError(w, r, NotFound("Skill type with ID %d not found", id))
+		return
+	}
 
-func (cc *SkillsController) deleteSkill(id int) error {
-	// Check if the skill type  exists
-	var exists bool
-	err := cc.db.QueryRow("SELECT EXISTS (SELECT 1 FROM skills WHERE id = $1)", id).Scan(&exists)
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
 	if err != nil {
-		return err
+		writeError(w, r, err)
+		return
+	}
+
+	err = cc.deleteSkill(id, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error deleting skill type: %w", err))
+		return
 	}
 
-	if !exists {
-		return fmt.Errorf("skill type with ID %d not found", id)
+	writeJSON(w, r, http.StatusOK, deleteResult{Success: true, Msg: "Skill type deleted successfully."})
+}
+
+func (cc *SkillsController) deleteSkill(id int, version time.Time) error {
+	// Only delete the row if it has not changed since version was read
+	result, err := cc.db.Exec("DELETE FROM skills WHERE id = $1 AND updated_at = $2", id, version)
+	if err != nil {
+		return err
 	}
 
-	// Skill exists, proceed with deletion
-	_, err = cc.db.Exec("DELETE FROM skills WHERE id = $1", id)
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if affected == 0 {
+		return Conflict("Skill type with ID %d was modified or deleted by another request", id)
+	}
+
 	return nil
 }
@@ -2,12 +2,9 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -26,26 +23,17 @@ func NewSpellsController(db *sql.DB) *SpellsController {
 func (cc *SpellsController) GetAll(w http.ResponseWriter, r *http.Request) {
 	spells, err := cc.getAllSpells()
 	if err != nil {
-		log.Printf("Error querying all spells: %s", err)
-		http.Error(w, fmt.Sprintf("Error getting spells: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting spells: %w", err))
 		return
 	}
 
-	responseJSON, err := json.Marshal(spells)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding spells to JSON: %s", err), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	writeJSON(w, r, http.StatusOK, spells)
 }
 
 func (cc *SpellsController) getAllSpells() ([]Spells, error) {
 
 	rows, err := cc.db.Query("SELECT * FROM spells")
 	if err != nil {
-		log.Printf("Error querying all spells: %s", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -68,29 +56,26 @@ func (cc *SpellsController) GetOne(w http.ResponseWriter, r *http.Request) {
 	spellID := mux.Vars(r)["spellID"]
 	id, err := strconv.Atoi(spellID)
 	if err != nil {
-		http.Error(w, "Invalid spell ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid spell ID"))
 		return
 	}
 
 	spell, err := cc.getSpellByID(id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting spell: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting spell: %w", err))
 		return
 	}
 
 	if spell == nil {
-		http.Error(w, "Spell not found", http.StatusNotFound)
+		writeError(w, r, NotFound("Spell not found"))
 		return
 	}
 
-	responseJSON, err := json.Marshal(spell)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding spell to JSON: %s", err), http.StatusInternalServerError)
+	if writeNotModified(w, r, etagFor(spell.ID, spell.UpdatedAt)) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	writeJSON(w, r, http.StatusOK, spell)
 }
 
 func (cc *SpellsController) getSpellByID(id int) (*Spells, error) {
@@ -111,29 +96,29 @@ func (cc *SpellsController) getSpellByID(id int) (*Spells, error) {
 
 func (cc *SpellsController) PostOne(w http.ResponseWriter, r *http.Request) {
 	var spell Spells
-	err := json.NewDecoder(r.Body).Decode(&spell)
+	err := decodeJSON(r, &spell)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error decoding request body: %s", err), http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
 		return
 	}
 
-	spell.CreatedAt = time.Now()
-	spell.UpdatedAt = time.Now()
-
-	err = cc.insertSpell(&spell)
+	err = spell.Validate()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error inserting spell: %s", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	responseJSON, err := json.Marshal(spell)
+	spell.CreatedAt = time.Now()
+	spell.UpdatedAt = time.Now()
+
+	err = cc.insertSpell(&spell)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding spell to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error inserting spell: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	w.Header().Set("ETag", etagFor(spell.ID, spell.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, spell)
 }
 
 func (cc *SpellsController) insertSpell(spell *Spells) error {
@@ -141,8 +126,8 @@ func (cc *SpellsController) insertSpell(spell *Spells) error {
 	err := cc.db.QueryRow(`
 		INSERT INTO spells (name, type, might, hit, critical, uses, weight, range_min, range_max, description, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-		RETURNING id
-	`, spell.Name, spell.Type, spell.Might, spell.Hit, spell.Critical, spell.Uses, spell.Weight, spell.RangeMin, spell.RangeMax, spell.Description, spell.CreatedAt, spell.UpdatedAt).Scan(&spell.ID)
+		RETURNING id, created_at, updated_at
+	`, spell.Name, spell.Type, spell.Might, spell.Hit, spell.Critical, spell.Uses, spell.Weight, spell.RangeMin, spell.RangeMax, spell.Description, spell.CreatedAt, spell.UpdatedAt).Scan(&spell.ID, &spell.CreatedAt, &spell.UpdatedAt)
 
 	if err != nil {
 		return err
@@ -155,93 +140,122 @@ func (cc *SpellsController) PutOne(w http.ResponseWriter, r *http.Request) {
 	spellID := mux.Vars(r)["spellID"]
 	id, err := strconv.Atoi(spellID)
 	if err != nil {
-		http.Error(w, "Invalid spell ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid spell ID"))
 		return
 	}
 
 	var updatedSpell Spells
-	err = json.NewDecoder(r.Body).Decode(&updatedSpell)
+	err = decodeJSON(r, &updatedSpell)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error decoding request body: %s", err), http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
 		return
 	}
 
-	updatedSpell.UpdatedAt = time.Now()
-
-	err = cc.updateSpell(id, &updatedSpell)
+	err = updatedSpell.Validate()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error updating spell: %s", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	responseJSON, err := json.Marshal(updatedSpell)
+	current, err := cc.getSpellByID(id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding updated spell to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting spell: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
-}
-
-func (cc *SpellsController) updateSpell(id int, updatedSpell *Spells) error {
-	// Start building the SQL query
-	query := "UPDATE spells SET updated_at = $1"
-	args := []interface{}{updatedSpell.UpdatedAt}
-
-	// Conditionally include fields in the update query
-	if updatedSpell.Name != "" {
-		query += ", name = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedSpell.Name)
+	if current == nil {
+		writeError(w, r, NotFound("Spell not found"))
+		return
 	}
-	if updatedSpell.Type != "" {
-		query += ", type = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedSpell.Type)
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	if updatedSpell.Might != nil {
-		query += ", might = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedSpell.Might)
+
+	updatedSpell.UpdatedAt = time.Now()
+
+	err = cc.updateSpell(id, &updatedSpell, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating spell: %w", err))
+		return
 	}
-	if updatedSpell.Hit != nil {
-		query += ", hit = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedSpell.Hit)
+
+	w.Header().Set("ETag", etagFor(updatedSpell.ID, updatedSpell.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedSpell)
+}
+
+func (cc *SpellsController) PatchOne(w http.ResponseWriter, r *http.Request) {
+	spellID := mux.Vars(r)["spellID"]
+	id, err := strconv.Atoi(spellID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid spell ID"))
+		return
 	}
-	if updatedSpell.Critical != nil {
-		query += ", critical = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedSpell.Critical)
+
+	updatedSpell, err := cc.getSpellByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting spell: %w", err))
+		return
 	}
-	if updatedSpell.Uses != 0 {
-		query += ", uses = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedSpell.Uses)
+
+	if updatedSpell == nil {
+		writeError(w, r, NotFound("Spell not found"))
+		return
 	}
-	if updatedSpell.Weight != nil {
-		query += ", weight = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedSpell.Weight)
+
+	version := updatedSpell.UpdatedAt
+	err = checkIfMatch(r, etagFor(updatedSpell.ID, version))
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	if updatedSpell.RangeMin != 0 {
-		query += ", range_min = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedSpell.RangeMin)
+
+	err = applyMergePatch(r, updatedSpell)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	if updatedSpell.RangeMax != nil {
-		query += ", range_max = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedSpell.RangeMax)
+
+	err = updatedSpell.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	if updatedSpell.Description != nil {
-		query += ", description = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedSpell.Description)
+
+	updatedSpell.UpdatedAt = time.Now()
+
+	err = cc.updateSpell(id, updatedSpell, version)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating spell: %w", err))
+		return
 	}
 
-	// Finish the query with the WHERE clause
-	query += " WHERE id = $" + strconv.Itoa(len(args)+1)
-	args = append(args, id)
-	err := cc.db.QueryRow(query+" RETURNING *", args...).Scan(
+	w.Header().Set("ETag", etagFor(updatedSpell.ID, updatedSpell.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedSpell)
+}
+
+func (cc *SpellsController) updateSpell(id int, updatedSpell *Spells, version time.Time) error {
+	// Every column is written so that PUT replaces the whole spell. The row is
+	// only updated if it has not changed since version was read.
+	err := cc.db.QueryRow(`
+		UPDATE spells SET name = $1, type = $2, might = $3, hit = $4, critical = $5, uses = $6,
+			weight = $7, range_min = $8, range_max = $9, description = $10, updated_at = $11
+		WHERE id = $12 AND updated_at = $13
+		RETURNING *
+	`, updatedSpell.Name, updatedSpell.Type, updatedSpell.Might, updatedSpell.Hit,
+		updatedSpell.Critical, updatedSpell.Uses, updatedSpell.Weight, updatedSpell.RangeMin,
+		updatedSpell.RangeMax, updatedSpell.Description, updatedSpell.UpdatedAt, id, version).Scan(
 		&updatedSpell.ID, &updatedSpell.Name, &updatedSpell.Type,
 		&updatedSpell.Might, &updatedSpell.Hit, &updatedSpell.Critical,
 		&updatedSpell.Uses, &updatedSpell.Weight, &updatedSpell.RangeMin,
 		&updatedSpell.RangeMax, &updatedSpell.Description, &updatedSpell.CreatedAt,
 		&updatedSpell.UpdatedAt)
 
-	if err != nil {
+	if err == sql.ErrNoRows {
+		return Conflict("Spell with ID %d was modified or deleted by another request", id)
+	} else if err != nil {
 		return err
 	}
 
@@ -252,41 +266,51 @@ func (cc *SpellsController) DeleteOne(w http.ResponseWriter, r *http.Request) {
 	spellID := mux.Vars(r)["spellID"]
 	id, err := strconv.Atoi(spellID)
 	if err != nil {
-		http.Error(w, "Invalid spell ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid spell ID"))
 		return
 	}
 
-	err = cc.deleteSpell(id)
+	current, err := cc.getSpellByID(id)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, fmt.Sprintf("Spell with ID %d not found", id), http.StatusNotFound)
-		} else {
-			http.Error(w, fmt.Sprintf("Error deleting spell: %s", err), http.StatusInternalServerError)
-		}
+		writeError(w, r, fmt.Errorf("error getting spell: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"success": true, "msg": "Spell deleted successfully."}`))
-}
+	if current == nil {
+		writeError(w, r, NotFound("Spell with ID %d not found", id))
+		return
+	}
 
-func (cc *SpellsController) deleteSpell(id int) error {
-	// Check if the spell exists
-	var exists bool
-	err := cc.db.QueryRow("SELECT EXISTS (SELECT 1 FROM spells WHERE id = $1)", id).Scan(&exists)
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
 	if err != nil {
-		return err
+		writeError(w, r, err)
+		return
+	}
+
+	err = cc.deleteSpell(id, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error deleting spell: %w", err))
+		return
 	}
 
-	if !exists {
-		return fmt.Errorf("spell with ID %d not found", id)
+	writeJSON(w, r, http.StatusOK, deleteResult{Success: true, Msg: "Spell deleted successfully."})
+}
+
+func (cc *SpellsController) deleteSpell(id int, version time.Time) error {
+	// Only delete the row if it has not changed since version was read
+	result, err := cc.db.Exec("DELETE FROM spells WHERE id = $1 AND updated_at = $2", id, version)
+	if err != nil {
+		return err
 	}
 
-	// Spell exists, proceed with deletion
-	_, err = cc.db.Exec("DELETE FROM spells WHERE id = $1", id)
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if affected == 0 {
+		return Conflict("Spell with ID %d was modified or deleted by another request", id)
+	}
+
 	return nil
 }
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+type SupportController struct {
+	db *sql.DB
+}
+
+func NewSupportController(db *sql.DB) *SupportController {
+	return &SupportController{
+		db: db,
+	}
+}
+
+func (cc *SupportController) GetAll(w http.ResponseWriter, r *http.Request) {
+	supports, err := cc.getAllSupports()
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting supports: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, supports)
+}
+
+func (cc *SupportController) getAllSupports() ([]Support, error) {
+	rows, err := cc.db.Query("SELECT * FROM supports ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var supports []Support
+
+	for rows.Next() {
+		var support Support
+		err := rows.Scan(supportColumns(&support)...)
+		if err != nil {
+			return nil, err
+		}
+		supports = append(supports, support)
+	}
+
+	return supports, nil
+}
+
+// supportColumns returns the scan targets of a supports row in column order
+func supportColumns(support *Support) []interface{} {
+	return []interface{}{&support.ID, &support.CharID, &support.PartnerID, pq.Array(&support.Ranks),
+		pq.Array(&support.Routes), &support.PairedEnding, &support.Ending, &support.CreatedAt,
+		&support.UpdatedAt}
+}
+
+func (cc *SupportController) GetOne(w http.ResponseWriter, r *http.Request) {
+	supportID := mux.Vars(r)["supportID"]
+	id, err := strconv.Atoi(supportID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid support ID"))
+		return
+	}
+
+	support, err := cc.getSupportByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting support: %w", err))
+		return
+	}
+
+	if support == nil {
+		writeError(w, r, NotFound("Support not found"))
+		return
+	}
+
+	if writeNotModified(w, r, etagFor(support.ID, support.UpdatedAt)) {
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, support)
+}
+
+func (cc *SupportController) getSupportByID(id int) (*Support, error) {
+	row := cc.db.QueryRow("SELECT * FROM supports WHERE id = $1", id)
+
+	var support Support
+	err := row.Scan(supportColumns(&support)...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &support, nil
+}
+
+func (cc *SupportController) PostOne(w http.ResponseWriter, r *http.Request) {
+	var support Support
+	err := decodeJSON(r, &support)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
+		return
+	}
+
+	err = support.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	support.CreatedAt = time.Now()
+	support.UpdatedAt = time.Now()
+
+	err = cc.insertSupport(&support)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error inserting support: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(support.ID, support.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, support)
+}
+
+func (cc *SupportController) insertSupport(support *Support) error {
+	err := cc.db.QueryRow(`
+		INSERT INTO supports (char_id, partner_id, ranks, routes, paired_ending, ending,
+			created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at
+	`, support.CharID, support.PartnerID, pq.Array(support.Ranks), pq.Array(support.Routes),
+		support.PairedEnding, support.Ending, support.CreatedAt, support.UpdatedAt).Scan(
+		&support.ID, &support.CreatedAt, &support.UpdatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cc *SupportController) PutOne(w http.ResponseWriter, r *http.Request) {
+	supportID := mux.Vars(r)["supportID"]
+	id, err := strconv.Atoi(supportID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid support ID"))
+		return
+	}
+
+	var updatedSupport Support
+	err = decodeJSON(r, &updatedSupport)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
+		return
+	}
+
+	err = updatedSupport.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	current, err := cc.getSupportByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting support: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Support not found"))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedSupport.UpdatedAt = time.Now()
+
+	err = cc.updateSupport(id, &updatedSupport, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating support: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedSupport.ID, updatedSupport.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedSupport)
+}
+
+func (cc *SupportController) PatchOne(w http.ResponseWriter, r *http.Request) {
+	supportID := mux.Vars(r)["supportID"]
+	id, err := strconv.Atoi(supportID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid support ID"))
+		return
+	}
+
+	updatedSupport, err := cc.getSupportByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting support: %w", err))
+		return
+	}
+
+	if updatedSupport == nil {
+		writeError(w, r, NotFound("Support not found"))
+		return
+	}
+
+	version := updatedSupport.UpdatedAt
+	err = checkIfMatch(r, etagFor(updatedSupport.ID, version))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = applyMergePatch(r, updatedSupport)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = updatedSupport.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	updatedSupport.UpdatedAt = time.Now()
+
+	err = cc.updateSupport(id, updatedSupport, version)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating support: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updatedSupport.ID, updatedSupport.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedSupport)
+}
+
+func (cc *SupportController) updateSupport(id int, updatedSupport *Support, version time.Time) error {
+	// Every column is written so that PUT replaces the whole support. The row is
+	// only updated if it has not changed since version was read.
+	err := cc.db.QueryRow(`
+		UPDATE supports SET char_id = $1, partner_id = $2, ranks = $3, routes = $4,
+			paired_ending = $5, ending = $6, updated_at = $7
+		WHERE id = $8 AND updated_at = $9
+		RETURNING *
+	`, updatedSupport.CharID, updatedSupport.PartnerID, pq.Array(updatedSupport.Ranks),
+		pq.Array(updatedSupport.Routes), updatedSupport.PairedEnding, updatedSupport.Ending,
+		updatedSupport.UpdatedAt, id, version).Scan(supportColumns(updatedSupport)...)
+
+	if err == sql.ErrNoRows {
+		return Conflict("Support with ID %d was modified or deleted by another request", id)
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cc *SupportController) DeleteOne(w http.ResponseWriter, r *http.Request) {
+	supportID := mux.Vars(r)["supportID"]
+	id, err := strconv.Atoi(supportID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid support ID"))
+		return
+	}
+
+	current, err := cc.getSupportByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting support: %w", err))
+		return
+	}
+
+	if current == nil {
+		writeError(w, r, NotFound("Support with ID %d not found", id))
+		return
+	}
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = cc.deleteSupport(id, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error deleting support: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, deleteResult{Success: true, Msg: "Support deleted successfully."})
+}
+
+func (cc *SupportController) deleteSupport(id int, version time.Time) error {
+	// Only delete the row if it has not changed since version was read
+	result, err := cc.db.Exec("DELETE FROM supports WHERE id = $1 AND updated_at = $2", id, version)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return Conflict("Support with ID %d was modified or deleted by another request", id)
+	}
+
+	return nil
+}
+
+// CharacterSupport is a support seen from one of its two characters, with
+// the bonus each of its ranks confers when the partner is adjacent
+type CharacterSupport struct {
+	Support
+	Partner Character      `json:"partner"`
+	Bonuses []SupportBonus `json:"bonuses"`
+}
+
+// SupportBonus is what a support of a rank adds to the combat values of
+// either character while the other is adjacent
+type SupportBonus struct {
+	Rank     string `json:"rank"`
+	Hit      int    `json:"hit"`
+	Avoid    int    `json:"avoid"`
+	Critical int    `json:"critical"`
+}
+
+var supportBonuses = map[string]SupportBonus{
+	"C": {"C", 5, 0, 0},
+	"B": {"B", 5, 5, 0},
+	"A": {"A", 10, 5, 5},
+	"S": {"S", 10, 10, 5},
+}
+
+// GetByCharacter lists the supports of a character, only those available on
+// the route given in the route query parameter when present
+func (cc *SupportController) GetByCharacter(w http.ResponseWriter, r *http.Request) {
+	charID := mux.Vars(r)["charID"]
+	id, err := strconv.Atoi(charID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid character ID"))
+		return
+	}
+
+	route := r.URL.Query().Get("route")
+	if route != "" && !slices.Contains(validRoutes, route) {
+		writeError(w, r, BadRequest("Unknown route %q", route))
+		return
+	}
+
+	character, err := NewCharacterController(cc.db).getCharacterByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting character: %w", err))
+		return
+	}
+
+	if character == nil {
+		writeError(w, r, NotFound("Character not found"))
+		return
+	}
+
+	supports, err := cc.getCharacterSupports(id, route)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting supports: %w", err))
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, supports)
+}
+
+func (cc *SupportController) getCharacterSupports(charID int, route string) ([]CharacterSupport, error) {
+	// A support is stored once per pair, either character may come first
+	rows, err := cc.db.Query(`
+		SELECT s.*, p.* FROM supports s
+		JOIN characters p ON p.id = CASE WHEN s.char_id = $1 THEN s.partner_id ELSE s.char_id END
+		WHERE (s.char_id = $1 OR s.partner_id = $1)
+			AND ($2 = '' OR COALESCE(cardinality(s.routes), 0) = 0 OR $2 = ANY (s.routes))
+		ORDER BY p.name
+	`, charID, route)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	supports := []CharacterSupport{}
+
+	for rows.Next() {
+		var support CharacterSupport
+		err := rows.Scan(append(supportColumns(&support.Support), characterColumns(&support.Partner)...)...)
+		if err != nil {
+			return nil, err
+		}
+
+		support.Bonuses = []SupportBonus{}
+		for _, rank := range support.Ranks {
+			support.Bonuses = append(support.Bonuses, supportBonuses[rank])
+		}
+		supports = append(supports, support)
+	}
+
+	return supports, rows.Err()
+}
+
+// getSupports returns the supports between a character and each of the
+// partners given, keyed by partner ID; partners without one are left out
+func (cc *SupportController) getSupports(charID int, partnerIDs []int) (map[int]*Support, error) {
+	rows, err := cc.db.Query(`
+		SELECT * FROM supports
+		WHERE (char_id = $1 AND partner_id = ANY ($2)) OR (partner_id = $1 AND char_id = ANY ($2))
+	`, charID, pq.Array(partnerIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	supports := map[int]*Support{}
+
+	for rows.Next() {
+		var support Support
+		err := rows.Scan(supportColumns(&support)...)
+		if err != nil {
+			return nil, err
+		}
+
+		partnerID := support.PartnerID
+		if partnerID == charID {
+			partnerID = support.CharID
+		}
+		supports[partnerID] = &support
+	}
+
+	return supports, rows.Err()
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// statCount is the number of entries in the stat arrays of a class
+// (HP, Str, Mag, Dex, Spd, Lck, Def, Res, Cha)
+const statCount = 9
+
+// validAffinities lists the houses a character can belong to
+var validAffinities = []string{"Black Eagles", "Blue Lions", "Golden Deer", "Ashen Wolves", "Church of Seiros"}
+
+// validClassRanks lists the tiers a class can belong to
+var validClassRanks = []string{"Starting", "Beginner", "Intermediate", "Advanced", "Master", "Unique"}
+
+// validCrestStrengths lists the strengths a crest can be borne with
+var validCrestStrengths = []string{"Major", "Minor"}
+
+// validCrestTriggers lists when a crest can activate
+var validCrestTriggers = []string{"attack", "combat_art", "spell", "any"}
+
+// validCrestEffects lists the activation effects the forecast understands.
+// effect_value is the bonus added, the factor applied to the weapon might
+// or the percent of the damage healed. "other" is for effects, such as
+// saving durability, that do not change the forecast.
+var validCrestEffects = []string{"might_bonus", "might_multiplier", "hit_bonus", "avoid_bonus",
+	"critical_bonus", "heal_percent", "other"}
+
+// validWeaponEffects lists the special properties of a weapon. "effective"
+// needs a target unit type; the others but "brave" need a value: the HP
+// healed in percent of the damage for drain, the HP lost by self_damage
+// when the wielder lacks the required crest, the HP restored at the start
+// of each turn by recovery and the added reach of range_bonus.
+var validWeaponEffects = []string{"effective", "brave", "drain", "self_damage", "recovery", "range_bonus"}
+
+// validAbilityCategories lists how an ability is obtained: "personal" and
+// "budding_talent" abilities belong to a character, "class" and
+// "class_mastery" ones to a class and "skill_rank" ones are learned by
+// reaching SkillRank in a skill
+var validAbilityCategories = []string{"personal", "class", "class_mastery", "skill_rank", "budding_talent"}
+
+// validSkillRanks lists the skill ranks, lowest first
+var validSkillRanks = []string{"E", "E+", "D", "D+", "C", "C+", "B", "B+", "A", "A+", "S", "S+"}
+
+// validAbilityEffects lists the effect types of an ability. stat_bonus
+// raises one of validStatNames, combat_bonus one of validCombatValues and
+// heal_percent restores a percent of max HP. "other" is for effects, such
+// as Canto, that are only described.
+var validAbilityEffects = []string{"stat_bonus", "combat_bonus", "heal_percent", "other"}
+
+// validStatNames lists the stats in the order of the class stat arrays
+var validStatNames = []string{"hp", "str", "mag", "dex", "spd", "lck", "def", "res", "cha"}
+
+// validCombatValues lists the values of the combat forecast
+var validCombatValues = []string{"attack", "hit", "avoid", "critical", "attack_speed"}
+
+// validSupportRanks lists the support ranks, lowest first
+var validSupportRanks = []string{"C", "B", "A", "S"}
+
+// validRoutes lists the routes of the story a support can be restricted to
+var validRoutes = []string{"Crimson Flower", "Azure Moon", "Verdant Wind", "Silver Snow"}
+
+// validGambitEffects lists what a gambit does besides its damage:
+// stop_movement keeps the enemies in its area from moving, heal restores
+// HP and stat_bonus raises the stats of the allies in its area
+var validGambitEffects = []string{"damage", "stop_movement", "heal", "stat_bonus", "other"}
+
+// validItemCategories lists the kinds of items. Shields and rings are
+// equipped in the accessory slot; the others are consumed on use. Staffs
+// are carried like consumables and used on an ally rather than the holder.
+var validItemCategories = []string{"shield", "ring", "vulnerary", "stat_booster", "seal", "staff"}
+
+// itemCategoryEffects lists the effects an item of each category can have:
+// stat_bonus while equipped, heal restoring Value HP, stat_increase raising
+// a stat for good, class_change certifying into the Target class rank and
+// restore clearing the stat penalties and status ailments of the target
+var itemCategoryEffects = map[string][]string{
+	"shield":       {"stat_bonus"},
+	"ring":         {"stat_bonus"},
+	"vulnerary":    {"heal"},
+	"stat_booster": {"stat_increase"},
+	"seal":         {"class_change"},
+	"staff":        {"heal", "restore"},
+}
+
+// validUnitTypes lists the unit types an effective weapon can target
+var validUnitTypes = []string{"infantry", "armored", "cavalry", "flying", "dragon", "monster"}
+
+// validClassTypes lists the tags of a class: its unit types and whether
+// only one gender can enter it
+var validClassTypes = append(slices.Clip(validUnitTypes), "female-only", "male-only")
+
+// FieldError describes why a single field of a request body was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors is returned by the Validate methods of the models when
+// at least one field breaks a domain rule
+type ValidationErrors []FieldError
+
+func (ve ValidationErrors) Error() string {
+	messages := make([]string, len(ve))
+	for i, fe := range ve {
+		messages[i] = fe.Field + " " + fe.Message
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// validator accumulates field errors so that every broken rule is reported
+// at once instead of only the first one
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) check(ok bool, field, format string, args ...interface{}) {
+	if !ok {
+		v.errs = append(v.errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+func (v *validator) required(value, field string) {
+	v.check(strings.TrimSpace(value) != "", field, "must not be empty")
+}
+
+func (v *validator) between(value, min, max int, field string) {
+	v.check(value >= min && value <= max, field, "must be between %d and %d", min, max)
+}
+
+func (v *validator) oneOf(value string, allowed []string, field string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.check(false, field, "must be one of: %s", strings.Join(allowed, ", "))
+}
+
+func (v *validator) rangeOrder(min int, max *int, minField, maxField string) {
+	v.check(min >= 0, minField, "must not be negative")
+	if max != nil {
+		v.check(*max >= min, maxField, "must be greater than or equal to %s", minField)
+	}
+}
+
+// statArray checks the length of a class stat array and the bounds of its
+// entries. Optional arrays may be null but not partially filled.
+func (v *validator) statArray(values []int, optional bool, min, max int, field string) {
+	if values == nil && optional {
+		return
+	}
+	if len(values) != statCount {
+		v.check(false, field, "must contain exactly %d values", statCount)
+		return
+	}
+	for i, value := range values {
+		v.between(value, min, max, fmt.Sprintf("%s[%d]", field, i))
+	}
+}
+
+func (v *validator) positiveIDs(ids []int, field string) {
+	for i, id := range ids {
+		v.check(id > 0, fmt.Sprintf("%s[%d]", field, i), "must be a positive ID")
+	}
+}
+
+// optionalID checks a nullable foreign key
+func (v *validator) optionalID(id *int, field string) {
+	if id != nil {
+		v.check(*id > 0, field, "must be a positive ID")
+	}
+}
+
+// formula checks that value is a formula parseFormula accepts
+func (v *validator) formula(value, field string) {
+	if strings.TrimSpace(value) == "" {
+		v.check(false, field, "must not be empty")
+		return
+	}
+	_, err := parseFormula(value)
+	v.check(err == nil, field, "is not a valid formula: %v", err)
+}
+
+func (v *validator) result() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+func (c *Character) Validate() error {
+	var v validator
+	v.required(c.Name, "name")
+	v.oneOf(c.Affinity, validAffinities, "affinity")
+	v.between(c.BaseLv, 1, 99, "base_lv")
+
+	stats := []struct {
+		field string
+		value int
+	}{
+		{"hp", c.HP}, {"strength", c.Strength}, {"magic", c.Magic}, {"dexterity", c.Dexterity},
+		{"speed", c.Speed}, {"luck", c.Luck}, {"defence", c.Defence}, {"resistance", c.Resistance},
+		{"charm", c.Charm},
+	}
+	for _, stat := range stats {
+		v.check(stat.value >= 0, stat.field, "must not be negative")
+	}
+
+	growths := []struct {
+		field string
+		value int
+	}{
+		{"hp_growth", c.HpGrowth}, {"str_growth", c.StrGrowth}, {"mag_growth", c.MagGrowth},
+		{"dex_growth", c.DexGrowth}, {"spd_growth", c.SpdGrowth}, {"lck_growth", c.LckGrowth},
+		{"def_growth", c.DefGrowth}, {"res_growth", c.ResGrowth}, {"cha_growth", c.ChaGrowth},
+	}
+	for _, growth := range growths {
+		v.between(growth.value, 0, 100, growth.field)
+	}
+
+	if c.CrestID != nil || c.CrestStrength != nil {
+		v.check(c.CrestID != nil && *c.CrestID > 0, "crest_id", "must reference a crest")
+		v.check(c.CrestStrength != nil, "crest_strength", "is required when crest_id is set")
+		if c.CrestStrength != nil {
+			v.oneOf(*c.CrestStrength, validCrestStrengths, "crest_strength")
+		}
+	}
+
+	v.statArray(c.MaxStats, true, 1, 99, "max_stats")
+
+	return v.result()
+}
+
+func (s *Skills) Validate() error {
+	var v validator
+	v.required(s.Name, "name")
+	return v.result()
+}
+
+func (s *Spells) Validate() error {
+	var v validator
+	v.required(s.Name, "name")
+	v.required(s.Type, "type")
+	v.check(s.Uses > 0, "uses", "must be positive")
+	if s.Might != nil {
+		v.check(*s.Might >= 0, "might", "must not be negative")
+	}
+	if s.Hit != nil {
+		v.between(*s.Hit, 0, 100, "hit")
+	}
+	if s.Critical != nil {
+		v.between(*s.Critical, 0, 100, "critical")
+	}
+	if s.Weight != nil {
+		v.check(*s.Weight >= 0, "weight", "must not be negative")
+	}
+	v.rangeOrder(s.RangeMin, s.RangeMax, "range_min", "range_max")
+	return v.result()
+}
+
+func (ca *CombatArts) Validate() error {
+	var v validator
+	v.required(ca.Name, "name")
+	v.check(ca.TypeID > 0, "type_id", "must reference a skill type")
+	v.check(ca.DurabilityCost >= 0, "durability_cost", "must not be negative")
+	v.rangeOrder(ca.RangeMin, ca.RangeMax, "range_min", "range_max")
+	return v.result()
+}
+
+func (wp *Weapons) Validate() error {
+	var v validator
+	v.required(wp.Name, "name")
+	v.check(wp.TypeID > 0, "type_id", "must reference a skill type")
+	if wp.Might != nil {
+		v.check(*wp.Might >= 0, "might", "must not be negative")
+	}
+	if wp.Hit != nil {
+		v.between(*wp.Hit, 0, 100, "hit")
+	}
+	if wp.Critical != nil {
+		v.between(*wp.Critical, 0, 100, "critical")
+	}
+	v.check(wp.Durability > 0, "durability", "must be positive")
+	v.check(wp.Weight >= 0, "weight", "must not be negative")
+	v.rangeOrder(wp.RangeMin, wp.RangeMax, "range_min", "range_max")
+	if wp.CrestID != nil {
+		v.check(*wp.CrestID > 0, "crest_id", "must reference a crest")
+	}
+	for i, effect := range wp.Effects {
+		field := fmt.Sprintf("effects[%d]", i)
+		v.oneOf(effect.Type, validWeaponEffects, field+".type")
+		if effect.Type == "effective" {
+			v.check(effect.Target != nil, field+".target", "is required for effective")
+			if effect.Target != nil {
+				v.oneOf(*effect.Target, validUnitTypes, field+".target")
+			}
+		} else {
+			v.check(effect.Target == nil, field+".target", "is only allowed for effective")
+		}
+		if effect.Type == "effective" || effect.Type == "brave" {
+			v.check(effect.Value == nil, field+".value", "is not allowed for %s", effect.Type)
+		} else {
+			v.check(effect.Value != nil && *effect.Value > 0, field+".value", "must be positive for %s", effect.Type)
+		}
+		v.check(effect.Type != "self_damage" || wp.CrestID != nil, field+".type", "self_damage requires crest_id")
+	}
+	return v.result()
+}
+
+func (cs *CharSkill) Validate() error {
+	var v validator
+	v.required(cs.Name, "name")
+	v.check(cs.CharID > 0, "char_id", "must reference a character")
+	v.positiveIDs(cs.SpellList, "spell_list")
+	v.positiveIDs(cs.CAList, "ca_list")
+	v.positiveIDs(cs.Boons, "boons")
+	v.positiveIDs(cs.Banes, "banes")
+	if cs.Budding != nil {
+		v.check(*cs.Budding > 0, "budding", "must reference a skill type")
+	}
+	return v.result()
+}
+
+func (cl *Classes) Validate() error {
+	var v validator
+	v.required(cl.Name, "name")
+	v.oneOf(cl.Rank, validClassRanks, "rank")
+	v.statArray(cl.Base, false, 0, 99, "base")
+	v.statArray(cl.Bonus, true, -99, 99, "bonus")
+	v.statArray(cl.Growth, true, -100, 100, "growth")
+	v.statArray(cl.MaxStats, true, 1, 99, "max_stats")
+	v.optionalID(cl.MasteryAbilityID, "mastery_ability_id")
+	v.optionalID(cl.MasteryArtID, "mastery_art_id")
+	if cl.MasteryAbilityID != nil || cl.MasteryArtID != nil {
+		v.check(cl.MasteryExp != nil, "mastery_exp", "is required when the class has a mastery ability or art")
+	}
+	if cl.MasteryExp != nil {
+		v.check(*cl.MasteryExp > 0, "mastery_exp", "must be positive")
+	}
+	v.between(cl.Movement, 0, 10, "movement")
+	for i, unitType := range cl.UnitTypes {
+		v.oneOf(unitType, validClassTypes, fmt.Sprintf("unit_types[%d]", i))
+	}
+	v.check(!slices.Contains(cl.UnitTypes, "female-only") || !slices.Contains(cl.UnitTypes, "male-only"),
+		"unit_types", "cannot be both female-only and male-only")
+	v.positiveIDs(cl.Proficiencies, "proficiencies")
+	v.positiveIDs(cl.ExclusiveCharIDs, "exclusive_char_ids")
+	for i, requirement := range cl.Requirements {
+		field := fmt.Sprintf("requirements[%d]", i)
+		v.check(requirement.SkillID > 0, field+".skill_id", "must reference a skill")
+		v.oneOf(requirement.Rank, validSkillRanks, field+".rank")
+	}
+	return v.result()
+}
+
+func (cm *ClassMastery) Validate() error {
+	var v validator
+	v.check(cm.Exp >= 0, "exp", "must not be negative")
+	return v.result()
+}
+
+func (cr *Crest) Validate() error {
+	var v validator
+	v.required(cr.Name, "name")
+	v.required(cr.ActivationEffect, "activation_effect")
+	v.oneOf(cr.Trigger, validCrestTriggers, "trigger")
+	v.oneOf(cr.EffectType, validCrestEffects, "effect_type")
+	v.check(cr.EffectType == "other" || cr.EffectValue != nil, "effect_value", "is required for %s", cr.EffectType)
+	v.formula(cr.MajorRate, "major_rate")
+	v.formula(cr.MinorRate, "minor_rate")
+	return v.result()
+}
+
+func (ab *Ability) Validate() error {
+	var v validator
+	v.required(ab.Name, "name")
+	v.required(ab.Description, "description")
+	v.oneOf(ab.Category, validAbilityCategories, "category")
+
+	linked := map[string]bool{"char_id": ab.CharID != nil, "class_id": ab.ClassID != nil,
+		"skill_id": ab.SkillID != nil, "skill_rank": ab.SkillRank != nil}
+	var needed []string
+	switch ab.Category {
+	case "personal":
+		needed = []string{"char_id"}
+	case "class", "class_mastery":
+		needed = []string{"class_id"}
+	case "skill_rank":
+		needed = []string{"skill_id", "skill_rank"}
+	case "budding_talent":
+		needed = []string{"char_id", "skill_id"}
+	}
+	for _, field := range needed {
+		v.check(linked[field], field, "is required for %s abilities", ab.Category)
+	}
+	v.optionalID(ab.CharID, "char_id")
+	v.optionalID(ab.ClassID, "class_id")
+	v.optionalID(ab.SkillID, "skill_id")
+	if ab.SkillRank != nil {
+		v.oneOf(*ab.SkillRank, validSkillRanks, "skill_rank")
+	}
+
+	for i, effect := range ab.Effects {
+		field := fmt.Sprintf("effects[%d]", i)
+		v.oneOf(effect.Type, validAbilityEffects, field+".type")
+		switch effect.Type {
+		case "stat_bonus", "combat_bonus":
+			allowed := validStatNames
+			if effect.Type == "combat_bonus" {
+				allowed = validCombatValues
+			}
+			v.check(effect.Stat != nil, field+".stat", "is required for %s", effect.Type)
+			if effect.Stat != nil {
+				v.oneOf(*effect.Stat, allowed, field+".stat")
+			}
+			v.check(effect.Value != nil, field+".value", "is required for %s", effect.Type)
+		case "heal_percent":
+			v.check(effect.Value != nil && *effect.Value > 0, field+".value", "must be positive for heal_percent")
+		}
+	}
+	return v.result()
+}
+
+func (sp *Support) Validate() error {
+	var v validator
+	v.check(sp.CharID > 0, "char_id", "must reference a character")
+	v.check(sp.PartnerID > 0, "partner_id", "must reference a character")
+	v.check(sp.CharID != sp.PartnerID, "partner_id", "must differ from char_id")
+	v.check(len(sp.Ranks) > 0, "ranks", "must not be empty")
+	for i, rank := range sp.Ranks {
+		v.oneOf(rank, validSupportRanks, fmt.Sprintf("ranks[%d]", i))
+		v.check(!slices.Contains(sp.Ranks[:i], rank), fmt.Sprintf("ranks[%d]", i), "is listed twice")
+	}
+	for i, route := range sp.Routes {
+		v.oneOf(route, validRoutes, fmt.Sprintf("routes[%d]", i))
+	}
+	if sp.PairedEnding {
+		v.check(slices.Contains(sp.Ranks, "A") || slices.Contains(sp.Ranks, "S"), "paired_ending",
+			"requires an A or S rank")
+		v.check(sp.Ending != nil && strings.TrimSpace(*sp.Ending) != "", "ending", "is required for a paired ending")
+	}
+	return v.result()
+}
+
+func (g *Gambit) Validate() error {
+	var v validator
+	v.required(g.Name, "name")
+	v.oneOf(g.Effect, validGambitEffects, "effect")
+	if g.Might != nil {
+		v.check(*g.Might >= 0, "might", "must not be negative")
+	}
+	v.check(g.Effect != "damage" || g.Might != nil, "might", "is required for damage gambits")
+	if g.Hit != nil {
+		v.between(*g.Hit, 0, 100, "hit")
+	}
+	v.rangeOrder(g.RangeMin, g.RangeMax, "range_min", "range_max")
+	v.check(g.Uses > 0, "uses", "must be positive")
+
+	var width, height int
+	_, err := fmt.Sscanf(g.Area, "%dx%d", &width, &height)
+	v.check(err == nil && width > 0 && height > 0 && g.Area == fmt.Sprintf("%dx%d", width, height),
+		"area", "must be a size such as 1x1 or 3x3")
+	return v.result()
+}
+
+func (b *Battalion) Validate() error {
+	var v validator
+	v.required(b.Name, "name")
+	v.statArray(b.StatBonus, false, -99, 99, "stat_bonus")
+	v.check(b.Endurance > 0, "endurance", "must be positive")
+	v.check(b.AuthorityID > 0, "authority_id", "must reference the Authority skill")
+	v.oneOf(b.AuthorityRank, validSkillRanks, "authority_rank")
+	v.optionalID(b.GambitID, "gambit_id")
+	return v.result()
+}
+
+func (it *Item) Validate() error {
+	var v validator
+	v.required(it.Name, "name")
+	v.oneOf(it.Category, validItemCategories, "category")
+	if it.Category == "shield" || it.Category == "ring" {
+		v.check(it.Uses == nil, "uses", "is not allowed for equipment")
+	} else {
+		v.check(it.Uses != nil && *it.Uses > 0, "uses", "must be positive for consumables")
+	}
+
+	for i, effect := range it.Effects {
+		field := fmt.Sprintf("effects[%d]", i)
+		if allowed, ok := itemCategoryEffects[it.Category]; ok {
+			v.oneOf(effect.Type, allowed, field+".type")
+		}
+		switch effect.Type {
+		case "stat_bonus", "stat_increase":
+			allowed := validStatNames
+			if it.Category == "shield" {
+				allowed = []string{"def", "res"}
+			}
+			v.check(effect.Stat != nil, field+".stat", "is required for %s", effect.Type)
+			if effect.Stat != nil {
+				v.oneOf(*effect.Stat, allowed, field+".stat")
+			}
+			v.check(effect.Value != nil, field+".value", "is required for %s", effect.Type)
+		case "heal":
+			v.check(effect.Value != nil && *effect.Value > 0, field+".value", "must be positive for heal")
+		case "class_change":
+			v.check(effect.Target != nil, field+".target", "is required for class_change")
+			if effect.Target != nil {
+				v.oneOf(*effect.Target, classTiers[1:], field+".target")
+			}
+		}
+	}
+	return v.result()
+}
+
+func (ie *InventoryEntry) Validate() error {
+	var v validator
+	v.check((ie.ItemID == nil) != (ie.WeaponID == nil), "item_id", "exactly one of item_id and weapon_id must be set")
+	v.optionalID(ie.ItemID, "item_id")
+	v.optionalID(ie.WeaponID, "weapon_id")
+	if ie.Uses != nil {
+		v.check(*ie.Uses >= 0, "uses", "must not be negative")
+	}
+	v.check(!ie.Equipped || ie.ItemID != nil, "equipped", "only items can be equipped")
+	return v.result()
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type validatable interface {
+	Validate() error
+}
+
+// validationTest expects Validate to report exactly fields, in order;
+// a nil fields means the model is valid
+type validationTest struct {
+	name   string
+	model  validatable
+	fields []string
+}
+
+// with applies change to a valid model, so that each case shows only the
+// fields it breaks
+func with[T any](model *T, change func(*T)) *T {
+	change(model)
+	return model
+}
+
+func strPtr(v string) *string {
+	return &v
+}
+
+func runValidationTests(t *testing.T, tests []validationTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.model.Validate()
+
+			var fields []string
+			var ve ValidationErrors
+			if errors.As(err, &ve) {
+				for _, fe := range ve {
+					fields = append(fields, fe.Field)
+				}
+			} else if err != nil {
+				t.Fatalf("Validate returned %T, want ValidationErrors", err)
+			}
+			if !reflect.DeepEqual(fields, test.fields) {
+				t.Errorf("Validate reported %v, want %v (%v)", fields, test.fields, err)
+			}
+		})
+	}
+}
+
+func TestCharacterValidate(t *testing.T) {
+	valid := func() *Character {
+		return &Character{Name: "Felix", Affinity: "Blue Lions", BaseLv: 1, HP: 30, HpGrowth: 45,
+			Strength: 12, StrGrowth: 55, Dexterity: 8, DexGrowth: 45, Speed: 9, SpdGrowth: 55,
+			CrestID: intPtr(2), CrestStrength: strPtr("Major")}
+	}
+
+	runValidationTests(t, []validationTest{
+		{"valid", valid(), nil},
+		{"without a crest", with(valid(), func(c *Character) { c.CrestID, c.CrestStrength = nil, nil }), nil},
+		{"with max stats", with(valid(), func(c *Character) { c.MaxStats = []int{80, 60, 50, 60, 60, 50, 50, 50, 50} }), nil},
+		{"name and affinity", with(valid(), func(c *Character) { c.Name, c.Affinity = " ", "Red Wolves" }),
+			[]string{"name", "affinity"}},
+		{"level above 99", with(valid(), func(c *Character) { c.BaseLv = 100 }), []string{"base_lv"}},
+		{"negative stat", with(valid(), func(c *Character) { c.Luck = -1 }), []string{"luck"}},
+		{"growths out of range", with(valid(), func(c *Character) { c.StrGrowth, c.DefGrowth = 101, -5 }),
+			[]string{"str_growth", "def_growth"}},
+		{"crest without strength", with(valid(), func(c *Character) { c.CrestStrength = nil }),
+			[]string{"crest_strength"}},
+		{"strength without crest", with(valid(), func(c *Character) { c.CrestID = nil }), []string{"crest_id"}},
+		{"unknown strength", with(valid(), func(c *Character) { c.CrestStrength = strPtr("Medium") }),
+			[]string{"crest_strength"}},
+		{"max stats length", with(valid(), func(c *Character) { c.MaxStats = []int{99, 99} }), []string{"max_stats"}},
+		{"max stat below 1", with(valid(), func(c *Character) { c.MaxStats = []int{80, 60, 50, 0, 60, 50, 50, 50, 50} }),
+			[]string{"max_stats[3]"}},
+	})
+}
+
+func TestSkillsValidate(t *testing.T) {
+	runValidationTests(t, []validationTest{
+		{"valid", &Skills{Name: "Sword"}, nil},
+		{"empty name", &Skills{}, []string{"name"}},
+	})
+}
+
+func TestSpellsValidate(t *testing.T) {
+	valid := func() *Spells {
+		return &Spells{Name: "Thunder", Type: "Reason", Might: intPtr(3), Hit: intPtr(80), Critical: intPtr(5),
+			Uses: 5, Weight: intPtr(2), RangeMin: 1, RangeMax: intPtr(2)}
+	}
+
+	runValidationTests(t, []validationTest{
+		{"valid", valid(), nil},
+		{"missing type", with(valid(), func(s *Spells) { s.Type = "" }), []string{"type"}},
+		{"uses and hit", with(valid(), func(s *Spells) { s.Uses, s.Hit = 0, intPtr(101) }), []string{"uses", "hit"}},
+		{"negative might and weight", with(valid(), func(s *Spells) { s.Might, s.Weight = intPtr(-1), intPtr(-1) }),
+			[]string{"might", "weight"}},
+		{"critical above 100", with(valid(), func(s *Spells) { s.Critical = intPtr(101) }), []string{"critical"}},
+		{"range reversed", with(valid(), func(s *Spells) { s.RangeMin = 3 }), []string{"range_max"}},
+		{"negative range", with(valid(), func(s *Spells) { s.RangeMin = -1 }), []string{"range_min"}},
+	})
+}
+
+func TestCombatArtsValidate(t *testing.T) {
+	valid := func() *CombatArts {
+		return &CombatArts{Name: "Sunder", TypeID: 1, DurabilityCost: 3, RangeMin: 1, RangeMax: intPtr(1)}
+	}
+
+	runValidationTests(t, []validationTest{
+		{"valid", valid(), nil},
+		{"type and cost", with(valid(), func(ca *CombatArts) { ca.TypeID, ca.DurabilityCost = 0, -1 }),
+			[]string{"type_id", "durability_cost"}},
+		{"range reversed", with(valid(), func(ca *CombatArts) { ca.RangeMax = intPtr(0) }), []string{"range_max"}},
+	})
+}
+
+func TestWeaponsValidate(t *testing.T) {
+	valid := func() *Weapons {
+		return &Weapons{Name: "Wo Dao", TypeID: 1, Might: intPtr(8), Hit: intPtr(80), Critical: intPtr(15),
+			Durability: 30, Weight: 5, RangeMin: 1, RangeMax: intPtr(1)}
+	}
+	effect := func(effect WeaponEffect) func(*Weapons) {
+		return func(wp *Weapons) { wp.Effects = []WeaponEffect{effect} }
+	}
+
+	runValidationTests(t, []validationTest{
+		{"valid", valid(), nil},
+		{"effective", with(valid(), effect(WeaponEffect{Type: "effective", Target: strPtr("armored")})), nil},
+		{"brave", with(valid(), effect(WeaponEffect{Type: "brave"})), nil},
+		{"self damage with a crest", with(with(valid(), func(wp *Weapons) { wp.CrestID = intPtr(3) }),
+			effect(WeaponEffect{Type: "self_damage", Value: intPtr(10)})), nil},
+		{"durability and critical", with(valid(), func(wp *Weapons) { wp.Durability, wp.Critical = 0, intPtr(101) }),
+			[]string{"critical", "durability"}},
+		{"crest ID", with(valid(), func(wp *Weapons) { wp.CrestID = intPtr(0) }), []string{"crest_id"}},
+		{"unknown effect", with(valid(), effect(WeaponEffect{Type: "poison", Value: intPtr(5)})),
+			[]string{"effects[0].type"}},
+		{"effective without target", with(valid(), effect(WeaponEffect{Type: "effective"})),
+			[]string{"effects[0].target"}},
+		{"effective against unknown type", with(valid(), effect(WeaponEffect{Type: "effective", Target: strPtr("archer")})),
+			[]string{"effects[0].target"}},
+		{"effective with value", with(valid(), effect(WeaponEffect{Type: "effective", Target: strPtr("flying"), Value: intPtr(3)})),
+			[]string{"effects[0].value"}},
+		{"brave with target", with(valid(), effect(WeaponEffect{Type: "brave", Target: strPtr("flying")})),
+			[]string{"effects[0].target"}},
+		{"drain without value", with(valid(), effect(WeaponEffect{Type: "drain"})), []string{"effects[0].value"}},
+		{"self damage without crest", with(valid(), effect(WeaponEffect{Type: "self_damage", Value: intPtr(10)})),
+			[]string{"effects[0].type"}},
+	})
+}
+
+func TestCharSkillValidate(t *testing.T) {
+	valid := func() *CharSkill {
+		return &CharSkill{Name: "Felix", CharID: 1, SpellList: []int{}, CAList: []int{2}, Boons: []int{1, 3},
+			Banes: []int{5}, Budding: intPtr(4)}
+	}
+
+	runValidationTests(t, []validationTest{
+		{"valid", valid(), nil},
+		{"references", with(valid(), func(cs *CharSkill) { cs.CharID, cs.Boons, cs.Budding = 0, []int{1, 0}, intPtr(0) }),
+			[]string{"char_id", "boons[1]", "budding"}},
+	})
+}
+
+func TestClassesValidate(t *testing.T) {
+	valid := func() *Classes {
+		return &Classes{Name: "Swordmaster", Rank: "Advanced", Base: []int{0, 12, 0, 11, 13, 0, 0, 0, 0},
+			Bonus: []int{0, 0, 0, 0, 2, 0, 0, 0, 0}, MasteryAbilityID: intPtr(3), MasteryExp: intPtr(150),
+			Movement: 5, UnitTypes: []string{"infantry"}, Proficiencies: []int{1},
+			Requirements: []ClassRequirement{{SkillID: 1, Rank: "B"}}}
+	}
+
+	runValidationTests(t, []validationTest{
+		{"valid", valid(), nil},
+		{"name and rank", with(valid(), func(cl *Classes) { cl.Name, cl.Rank = "", "Legendary" }),
+			[]string{"name", "rank"}},
+		{"base length", with(valid(), func(cl *Classes) { cl.Base = cl.Base[1:] }), []string{"base"}},
+		{"growth out of range", with(valid(), func(cl *Classes) { cl.Growth = []int{0, 0, 101, 0, 0, 0, 0, 0, 0} }),
+			[]string{"growth[2]"}},
+		{"mastery without exp", with(valid(), func(cl *Classes) { cl.MasteryExp = nil }), []string{"mastery_exp"}},
+		{"mastery exp zero", with(valid(), func(cl *Classes) { cl.MasteryExp = intPtr(0) }), []string{"mastery_exp"}},
+		{"movement above 10", with(valid(), func(cl *Classes) { cl.Movement = 11 }), []string{"movement"}},
+		{"unknown unit type", with(valid(), func(cl *Classes) { cl.UnitTypes = append(cl.UnitTypes, "archer") }),
+			[]string{"unit_types[1]"}},
+		{"both genders", with(valid(), func(cl *Classes) { cl.UnitTypes = []string{"female-only", "male-only"} }),
+			[]string{"unit_types"}},
+		{"ID arrays", with(valid(), func(cl *Classes) { cl.Proficiencies, cl.ExclusiveCharIDs = []int{0}, []int{-2} }),
+			[]string{"proficiencies[0]", "exclusive_char_ids[0]"}},
+		{"requirement", with(valid(), func(cl *Classes) { cl.Requirements = []ClassRequirement{{SkillID: 0, Rank: "Z"}} }),
+			[]string{"requirements[0].skill_id", "requirements[0].rank"}},
+	})
+}
+
+func TestClassMasteryValidate(t *testing.T) {
+	runValidationTests(t, []validationTest{
+		{"valid", &ClassMastery{CharID: 1, ClassID: 2}, nil},
+		{"negative exp", &ClassMastery{CharID: 1, ClassID: 2, Exp: -1}, []string{"exp"}},
+	})
+}
+
+func TestCrestValidate(t *testing.T) {
+	valid := func() *Crest {
+		return &Crest{Name: "Crest of Fraldarius", ActivationEffect: "Damage +5", Trigger: "attack",
+			EffectType: "might_bonus", EffectValue: intPtr(5), MajorRate: "lck / 2", MinorRate: "lck / 4"}
+	}
+
+	runValidationTests(t, []validationTest{
+		{"valid", valid(), nil},
+		{"other without value", with(valid(), func(cr *Crest) { cr.EffectType, cr.EffectValue = "other", nil }), nil},
+		{"missing value", with(valid(), func(cr *Crest) { cr.EffectValue = nil }), []string{"effect_value"}},
+		{"trigger and effect", with(valid(), func(cr *Crest) { cr.Trigger, cr.EffectType = "defend", "shield" }),
+			[]string{"trigger", "effect_type"}},
+		{"invalid formulas", with(valid(), func(cr *Crest) { cr.MajorRate, cr.MinorRate = "lck +", "" }),
+			[]string{"major_rate", "minor_rate"}},
+		{"formula too long", with(valid(), func(cr *Crest) { cr.MinorRate = "lck" + strings.Repeat(" ", maxFormulaLength) }),
+			[]string{"minor_rate"}},
+	})
+}
+
+func TestAbilityValidate(t *testing.T) {
+	valid := func() *Ability {
+		return &Ability{Name: "Sword Prowess Lv 1", Category: "skill_rank", Description: "Hit +5 with swords",
+			Effects:   []AbilityEffect{{Type: "combat_bonus", Stat: strPtr("hit"), Value: intPtr(5)}},
+			SkillID:   intPtr(1),
+			SkillRank: strPtr("D")}
+	}
+	effect := func(effect AbilityEffect) func(*Ability) {
+		return func(ab *Ability) { ab.Effects = []AbilityEffect{effect} }
+	}
+
+	runValidationTests(t, []validationTest{
+		{"valid", valid(), nil},
+		{"class", with(valid(), func(ab *Ability) { ab.Category, ab.ClassID = "class", intPtr(4) }), nil},
+		{"described only", with(valid(), effect(AbilityEffect{Type: "other"})), nil},
+		{"name and description", with(valid(), func(ab *Ability) { ab.Name, ab.Description = "", " " }),
+			[]string{"name", "description"}},
+		{"unknown category", with(valid(), func(ab *Ability) { ab.Category = "crest" }), []string{"category"}},
+		{"personal without character", with(valid(), func(ab *Ability) { ab.Category = "personal" }),
+			[]string{"char_id"}},
+		{"class without class", with(valid(), func(ab *Ability) { ab.Category = "class_mastery" }),
+			[]string{"class_id"}},
+		{"budding talent without links", with(valid(), func(ab *Ability) { ab.Category, ab.SkillID = "budding_talent", nil }),
+			[]string{"char_id", "skill_id"}},
+		{"skill rank missing", with(valid(), func(ab *Ability) { ab.SkillRank = nil }), []string{"skill_rank"}},
+		{"unknown skill rank", with(valid(), func(ab *Ability) { ab.SkillRank = strPtr("F") }), []string{"skill_rank"}},
+		{"class ID", with(valid(), func(ab *Ability) { ab.Category, ab.ClassID = "class", intPtr(0) }),
+			[]string{"class_id"}},
+		{"unknown effect", with(valid(), effect(AbilityEffect{Type: "counter"})), []string{"effects[0].type"}},
+		{"stat bonus on a combat value", with(valid(), effect(AbilityEffect{Type: "stat_bonus", Stat: strPtr("hit"), Value: intPtr(2)})),
+			[]string{"effects[0].stat"}},
+		{"combat bonus without stat and value", with(valid(), effect(AbilityEffect{Type: "combat_bonus"})),
+			[]string{"effects[0].stat", "effects[0].value"}},
+		{"heal without percent", with(valid(), effect(AbilityEffect{Type: "heal_percent", Value: intPtr(0)})),
+			[]string{"effects[0].value"}},
+	})
+}
+
+func TestSupportValidate(t *testing.T) {
+	valid := func() *Support {
+		return &Support{CharID: 1, PartnerID: 2, Ranks: []string{"C", "B", "A", "S"},
+			Routes: []string{"Azure Moon"}, PairedEnding: true, Ending: strPtr("They married.")}
+	}
+
+	runValidationTests(t, []validationTest{
+		{"valid", valid(), nil},
+		{"same character", with(valid(), func(sp *Support) { sp.PartnerID = 1 }), []string{"partner_id"}},
+		{"references", with(valid(), func(sp *Support) { sp.CharID, sp.PartnerID = 0, -1 }),
+			[]string{"char_id", "partner_id"}},
+		{"no ranks", with(valid(), func(sp *Support) { sp.Ranks, sp.PairedEnding = nil, false }), []string{"ranks"}},
+		{"rank twice", with(valid(), func(sp *Support) { sp.Ranks = []string{"C", "B", "B", "A"} }),
+			[]string{"ranks[2]"}},
+		{"unknown rank", with(valid(), func(sp *Support) { sp.Ranks = []string{"C", "B+", "A"} }),
+			[]string{"ranks[1]"}},
+		{"unknown route", with(valid(), func(sp *Support) { sp.Routes = []string{"Golden Wildfire"} }),
+			[]string{"routes[0]"}},
+		{"paired ending below A", with(valid(), func(sp *Support) { sp.Ranks = []string{"C", "B"} }),
+			[]string{"paired_ending"}},
+		{"paired ending without text", with(valid(), func(sp *Support) { sp.Ending = strPtr(" ") }),
+			[]string{"ending"}},
+	})
+}
+
+func TestGambitValidate(t *testing.T) {
+	valid := func() *Gambit {
+		return &Gambit{Name: "Sword Phalanx", Might: intPtr(5), Hit: intPtr(70), RangeMin: 1, RangeMax: intPtr(1),
+			Uses: 1, Area: "1x1", Effect: "damage"}
+	}
+
+	runValidationTests(t, []validationTest{
+		{"valid", valid(), nil},
+		{"support without might", with(valid(), func(g *Gambit) { g.Effect, g.Might, g.Area = "stat_bonus", nil, "3x3" }), nil},
+		{"damage without might", with(valid(), func(g *Gambit) { g.Might = nil }), []string{"might"}},
+		{"unknown effect", with(valid(), func(g *Gambit) { g.Effect = "poison" }), []string{"effect"}},
+		{"hit and uses", with(valid(), func(g *Gambit) { g.Hit, g.Uses = intPtr(101), 0 }), []string{"hit", "uses"}},
+		{"range reversed", with(valid(), func(g *Gambit) { g.RangeMin = 2 }), []string{"range_max"}},
+		{"incomplete area", with(valid(), func(g *Gambit) { g.Area = "3x" }), []string{"area"}},
+		{"padded area", with(valid(), func(g *Gambit) { g.Area = "03x3" }), []string{"area"}},
+		{"empty area", with(valid(), func(g *Gambit) { g.Area = "0x1" }), []string{"area"}},
+	})
+}
+
+func TestBattalionValidate(t *testing.T) {
+	valid := func() *Battalion {
+		return &Battalion{Name: "Leicester Cavalry", StatBonus: []int{0, 2, 0, 0, 0, 0, 1, 0, 2}, Endurance: 30,
+			AuthorityID: 20, AuthorityRank: "D", GambitID: intPtr(2)}
+	}
+
+	runValidationTests(t, []validationTest{
+		{"valid", valid(), nil},
+		{"missing stat bonus", with(valid(), func(b *Battalion) { b.StatBonus = nil }), []string{"stat_bonus"}},
+		{"endurance and authority", with(valid(), func(b *Battalion) { b.Endurance, b.AuthorityID, b.AuthorityRank = 0, 0, "Z" }),
+			[]string{"endurance", "authority_id", "authority_rank"}},
+		{"gambit ID", with(valid(), func(b *Battalion) { b.GambitID = intPtr(0) }), []string{"gambit_id"}},
+	})
+}
+
+func TestItemValidate(t *testing.T) {
+	item := func(category string, uses *int, effects ...ItemEffect) *Item {
+		return &Item{Name: "Item", Category: category, Uses: uses, Effects: effects}
+	}
+
+	runValidationTests(t, []validationTest{
+		{"shield", item("shield", nil, ItemEffect{Type: "stat_bonus", Stat: strPtr("def"), Value: intPtr(2)}), nil},
+		{"vulnerary", item("vulnerary", intPtr(3), ItemEffect{Type: "heal", Value: intPtr(10)}), nil},
+		{"seal", item("seal", intPtr(1), ItemEffect{Type: "class_change", Target: strPtr("Intermediate")}), nil},
+		{"staff", item("staff", intPtr(10), ItemEffect{Type: "heal", Value: intPtr(10)}, ItemEffect{Type: "restore"}), nil},
+		{"unknown category", item("potion", intPtr(1)), []string{"category"}},
+		{"equipment with uses", item("ring", intPtr(3)), []string{"uses"}},
+		{"consumable without uses", item("vulnerary", nil, ItemEffect{Type: "heal", Value: intPtr(10)}),
+			[]string{"uses"}},
+		{"shield raising strength", item("shield", nil, ItemEffect{Type: "stat_bonus", Stat: strPtr("str"), Value: intPtr(2)}),
+			[]string{"effects[0].stat"}},
+		{"effect of another category", item("ring", nil, ItemEffect{Type: "heal", Value: intPtr(10)}),
+			[]string{"effects[0].type"}},
+		{"stat booster without stat and value", item("stat_booster", intPtr(1), ItemEffect{Type: "stat_increase"}),
+			[]string{"effects[0].stat", "effects[0].value"}},
+		{"staff without heal", item("staff", intPtr(10), ItemEffect{Type: "heal"}), []string{"effects[0].value"}},
+		{"staff changing class", item("staff", intPtr(1), ItemEffect{Type: "class_change", Target: strPtr("Master")}),
+			[]string{"effects[0].type"}},
+		{"seal into a starting class", item("seal", intPtr(1), ItemEffect{Type: "class_change", Target: strPtr("Starting")}),
+			[]string{"effects[0].target"}},
+	})
+}
+
+func TestInventoryEntryValidate(t *testing.T) {
+	runValidationTests(t, []validationTest{
+		{"item", &InventoryEntry{CharID: 1, ItemID: intPtr(2), Uses: intPtr(3), Equipped: true}, nil},
+		{"weapon", &InventoryEntry{CharID: 1, WeaponID: intPtr(4)}, nil},
+		{"both", &InventoryEntry{CharID: 1, ItemID: intPtr(2), WeaponID: intPtr(4)}, []string{"item_id"}},
+		{"neither", &InventoryEntry{CharID: 1}, []string{"item_id"}},
+		{"negative uses", &InventoryEntry{CharID: 1, WeaponID: intPtr(4), Uses: intPtr(-1)}, []string{"uses"}},
+		{"equipped weapon", &InventoryEntry{CharID: 1, WeaponID: intPtr(4), Equipped: true}, []string{"equipped"}},
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// apiVersion is a set of routes mounted under a path prefix such as "/v1"
+type apiVersion struct {
+	Prefix string
+	Routes []apiRoute
+}
+
+// apiVersions lists the mounted versions, oldest first. A new version is
+// declared by deriving its routes from the previous one, so that only the
+// endpoints whose contract changes need new handlers:
+//
+//	v2 := apiVersion{Prefix: "/v2", Routes: deriveRoutes(v1.Routes,
+//		apiRoute{"GET", "/characters", characterController.GetAllV2, ...},
+//	)}
+func apiVersions(db *sql.DB) []apiVersion {
+	v1 := apiVersion{Prefix: "/v1", Routes: apiRoutes(db)}
+
+	return []apiVersion{v1}
+}
+
+// deriveRoutes copies the routes of a previous version, replacing those
+// with the same method and path as one of the overrides and appending the
+// overrides that are new
+func deriveRoutes(base []apiRoute, overrides ...apiRoute) []apiRoute {
+	routes := make([]apiRoute, len(base), len(base)+len(overrides))
+	copy(routes, base)
+
+	for _, override := range overrides {
+		replaced := false
+		for i, route := range routes {
+			if route.Method == override.Method && route.Path == override.Path {
+				routes[i] = override
+				replaced = true
+			}
+		}
+		if !replaced {
+			routes = append(routes, override)
+		}
+	}
+	return routes
+}
+
+// registerVersions mounts every version under its prefix, each on a
+// subrouter using the given middleware
+func registerVersions(r *mux.Router, versions []apiVersion, middleware ...mux.MiddlewareFunc) {
+	for _, version := range versions {
+		sub := r.PathPrefix(version.Prefix).Subrouter()
+		sub.Use(middleware...)
+		registerRoutes(sub, version.Routes)
+	}
+}
+
+// deprecationMiddleware marks the unversioned routes as deprecated and points
+// clients at the same path under successor. Sunset is only sent when a
+// removal date has been announced.
+func deprecationMiddleware(successor string, sunset time.Time) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			if !sunset.IsZero() {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			w.Header().Add("Link", "<"+successor+r.URL.Path+`>; rel="successor-version"`)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
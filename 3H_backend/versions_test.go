@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// answer returns a handler writing body, to tell which version served a route
+func answer(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}
+}
+
+func TestDerivedVersion(t *testing.T) {
+	v1 := apiVersion{Prefix: "/v1", Routes: []apiRoute{
+		{Method: "GET", Path: "/characters", Handler: answer("v1 list")},
+		{Method: "GET", Path: "/characters/{charID}", Handler: answer("v1 one")},
+		{Method: "DELETE", Path: "/characters/{charID}", Handler: answer("v1 delete")},
+	}}
+	v2 := apiVersion{Prefix: "/v2", Routes: deriveRoutes(v1.Routes,
+		apiRoute{Method: "GET", Path: "/characters", Handler: answer("v2 list")},
+		apiRoute{Method: "GET", Path: "/teams", Handler: answer("v2 teams")},
+	)}
+
+	if len(v1.Routes) != 3 || len(v2.Routes) != 4 {
+		t.Fatalf("v1 has %d routes, v2 %d; want 3 and 4", len(v1.Routes), len(v2.Routes))
+	}
+
+	r := mux.NewRouter()
+	registerVersions(r, []apiVersion{v1, v2})
+
+	tests := []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"GET", "/v1/characters", http.StatusOK, "v1 list"},
+		{"GET", "/v2/characters", http.StatusOK, "v2 list"},
+		{"GET", "/v2/characters/3", http.StatusOK, "v1 one"},
+		{"DELETE", "/v2/characters/3", http.StatusOK, "v1 delete"},
+		{"GET", "/v2/teams", http.StatusOK, "v2 teams"},
+		{"GET", "/v1/teams", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+			if w.Code != test.status {
+				t.Fatalf("status %d, want %d", w.Code, test.status)
+			}
+			if test.body != "" && w.Body.String() != test.body {
+				t.Errorf("body %q, want %q", w.Body.String(), test.body)
+			}
+		})
+	}
+}
@@ -2,9 +2,7 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -23,29 +21,45 @@ func NewWeaponsController(db *sql.DB) *WeaponsController {
 	}
 }
 
+// GetAll lists the weapons, only those having every effect given in the
+// effect query parameter, such as ?effect=effective_flying, when present
 func (cc *WeaponsController) GetAll(w http.ResponseWriter, r *http.Request) {
-	weapons, err := cc.getAllWeapons()
-	if err != nil {
-		log.Printf("Error querying all weapons: %s", err)
-		http.Error(w, fmt.Sprintf("Error getting weapons: %s", err), http.StatusInternalServerError)
-		return
+	var effects []WeaponEffect
+	for _, key := range r.URL.Query()["effect"] {
+		effect, ok := parseEffectKey(key)
+		if !ok {
+			writeError(w, r, BadRequest("Unknown weapon effect %q", key))
+			return
+		}
+		effects = append(effects, effect)
 	}
 
-	responseJSON, err := json.Marshal(weapons)
+	weapons, err := cc.getAllWeapons(effects)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding weapons to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting weapons: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	writeJSON(w, r, http.StatusOK, weapons)
 }
 
-func (cc *WeaponsController) getAllWeapons() ([]Weapons, error) {
+func (cc *WeaponsController) getAllWeapons(effects []WeaponEffect) ([]Weapons, error) {
+	query, args := "SELECT * FROM weapons", []interface{}{}
+	if len(effects) > 0 {
+		// Containment matches the weapons having at least these effects,
+		// whatever their value, so the value is left out of the filter
+		filter := make([]map[string]string, len(effects))
+		for i, effect := range effects {
+			filter[i] = map[string]string{"type": effect.Type}
+			if effect.Target != nil {
+				filter[i]["target"] = *effect.Target
+			}
+		}
+		query, args = "SELECT * FROM weapons WHERE effects @> $1", []interface{}{jsonColumn{filter}}
+	}
 
-	rows, err := cc.db.Query("SELECT * FROM weapons")
+	rows, err := cc.db.Query(query, args...)
 	if err != nil {
-		log.Printf("Error querying all weapons: %s", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -55,11 +69,7 @@ func (cc *WeaponsController) getAllWeapons() ([]Weapons, error) {
 	for rows.Next() {
 		var weapon Weapons
 
-		err := rows.Scan(&weapon.ID, &weapon.Name, &weapon.TypeID,
-			&weapon.StrMag, &weapon.Might, &weapon.Hit, &weapon.Critical,
-			&weapon.Durability, &weapon.Weight, &weapon.RangeMin,
-			&weapon.RangeMax, &weapon.Description, &weapon.CreatedAt,
-			&weapon.UpdatedAt)
+		err := rows.Scan(weaponColumns(&weapon)...)
 		if err != nil {
 			return nil, err
 		}
@@ -69,33 +79,59 @@ func (cc *WeaponsController) getAllWeapons() ([]Weapons, error) {
 	return weapons, nil
 }
 
+// weaponColumns returns the scan targets of a weapons row in column order
+func weaponColumns(weapon *Weapons) []interface{} {
+	return []interface{}{&weapon.ID, &weapon.Name, &weapon.TypeID, &weapon.StrMag,
+		&weapon.Might, &weapon.Hit, &weapon.Critical, &weapon.Durability, &weapon.Weight,
+		&weapon.RangeMin, &weapon.RangeMax, &weapon.Description, &weapon.CreatedAt,
+		&weapon.UpdatedAt, &weapon.CrestID, jsonColumn{&weapon.Effects}}
+}
+
+// parseEffectKey reads an effect filter: the effect type, followed for
+// "effective" by the target unit type, as in "effective_flying"
+func parseEffectKey(key string) (WeaponEffect, bool) {
+	for _, effectType := range validWeaponEffects {
+		if key == effectType && effectType != "effective" {
+			return WeaponEffect{Type: effectType}, true
+		}
+	}
+
+	target, ok := strings.CutPrefix(key, "effective_")
+	if !ok {
+		return WeaponEffect{}, false
+	}
+	for _, unitType := range validUnitTypes {
+		if target == unitType {
+			return WeaponEffect{Type: "effective", Target: &target}, true
+		}
+	}
+	return WeaponEffect{}, false
+}
+
 func (cc *WeaponsController) GetOne(w http.ResponseWriter, r *http.Request) {
 	weaponID := mux.Vars(r)["weaponID"]
 	id, err := strconv.Atoi(weaponID)
 	if err != nil {
-		http.Error(w, "Invalid weapon ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid weapon ID"))
 		return
 	}
 
 	weapon, err := cc.getWeaponByID(id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting weapon: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting weapon: %w", err))
 		return
 	}
 
 	if weapon == nil {
-		http.Error(w, "Weapon not found", http.StatusNotFound)
+		writeError(w, r, NotFound("Weapon not found"))
 		return
 	}
 
-	responseJSON, err := json.Marshal(weapon)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding weapon to JSON: %s", err), http.StatusInternalServerError)
+	if writeNotModified(w, r, etagFor(weapon.ID, weapon.UpdatedAt)) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	writeJSON(w, r, http.StatusOK, weapon)
 }
 
 func (cc *WeaponsController) getWeaponByID(id int) (*Weapons, error) {
@@ -104,7 +140,7 @@ func (cc *WeaponsController) getWeaponByID(id int) (*Weapons, error) {
 	row := cc.db.QueryRow("SELECT * FROM weapons WHERE id = $1", id)
 
 	var weapon Weapons
-	err := row.Scan(&weapon.ID, &weapon.Name, &weapon.TypeID, &weapon.StrMag, &weapon.Might, &weapon.Hit, &weapon.Critical, &weapon.Durability, &weapon.Weight, &weapon.RangeMin, &weapon.RangeMax, &weapon.Description, &weapon.CreatedAt, &weapon.UpdatedAt)
+	err := row.Scan(weaponColumns(&weapon)...)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	} else if err != nil {
@@ -119,23 +155,16 @@ func (cc *WeaponsController) GetOneName(w http.ResponseWriter, r *http.Request)
 
 	weapon, err := cc.getWeaponByName(weaponName)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting weapon: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting weapon: %w", err))
 		return
 	}
 
 	if weapon == nil {
-		http.Error(w, "Weapon not found", http.StatusNotFound)
-		return
-	}
-
-	responseJSON, err := json.Marshal(weapon)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding weapon to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, NotFound("Weapon not found"))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	writeJSON(w, r, http.StatusOK, weapon)
 }
 
 func (cc *WeaponsController) getWeaponByName(name string) ([]Weapons, error) {
@@ -143,7 +172,6 @@ func (cc *WeaponsController) getWeaponByName(name string) ([]Weapons, error) {
 	// Example:
 	rows, err := cc.db.Query("SELECT * FROM weapons WHERE name LIKE $1", name+"%")
 	if err != nil {
-		log.Printf("Error querying all weapons: %s", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -153,11 +181,7 @@ func (cc *WeaponsController) getWeaponByName(name string) ([]Weapons, error) {
 	for rows.Next() {
 		var weapon Weapons
 
-		err := rows.Scan(&weapon.ID, &weapon.Name, &weapon.TypeID,
-			&weapon.StrMag, &weapon.Might, &weapon.Hit, &weapon.Critical,
-			&weapon.Durability, &weapon.Weight, &weapon.RangeMin,
-			&weapon.RangeMax, &weapon.Description, &weapon.CreatedAt,
-			&weapon.UpdatedAt)
+		err := rows.Scan(weaponColumns(&weapon)...)
 		if err != nil {
 			return nil, err
 		}
@@ -169,41 +193,45 @@ func (cc *WeaponsController) getWeaponByName(name string) ([]Weapons, error) {
 
 func (cc *WeaponsController) PostOne(w http.ResponseWriter, r *http.Request) {
 	var weapon Weapons
-	err := json.NewDecoder(r.Body).Decode(&weapon)
+	err := decodeJSON(r, &weapon)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error decoding request body: %s", err), http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
 		return
 	}
 
-	weapon.CreatedAt = time.Now()
-	weapon.UpdatedAt = time.Now()
-
-	err = cc.insertWeapon(&weapon)
+	err = weapon.Validate()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error inserting weapon: %s", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	responseJSON, err := json.Marshal(weapon)
+	weapon.CreatedAt = time.Now()
+	weapon.UpdatedAt = time.Now()
+
+	err = cc.insertWeapon(&weapon)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding weapon to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error inserting weapon: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	w.Header().Set("ETag", etagFor(weapon.ID, weapon.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, weapon)
 }
 
 func (cc *WeaponsController) insertWeapon(weapon *Weapons) error {
+	if weapon.Effects == nil {
+		weapon.Effects = []WeaponEffect{}
+	}
+
 	// Perform the insert operation with the RETURNING clause to get the ID
 	err := cc.db.QueryRow(`
 		INSERT INTO weapons (name, type_id, str_mag, might, hit, critical, durability, 
-			weight, range_min, range_max, description, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
-		RETURNING id
+			weight, range_min, range_max, description, crest_id, effects, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id, created_at, updated_at
 	`, weapon.Name, weapon.TypeID, weapon.StrMag, weapon.Might, weapon.Hit,
 		weapon.Critical, weapon.Durability, weapon.Weight, weapon.RangeMin, weapon.RangeMax,
-		weapon.Description, weapon.CreatedAt, weapon.UpdatedAt).Scan(&weapon.ID)
+		weapon.Description, weapon.CrestID, jsonColumn{weapon.Effects}, weapon.CreatedAt, weapon.UpdatedAt).Scan(&weapon.ID, &weapon.CreatedAt, &weapon.UpdatedAt)
 
 	if err != nil {
 		return err
@@ -216,97 +244,124 @@ func (cc *WeaponsController) PutOne(w http.ResponseWriter, r *http.Request) {
 	weaponID := mux.Vars(r)["weaponID"]
 	id, err := strconv.Atoi(weaponID)
 	if err != nil {
-		http.Error(w, "Invalid weapon ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid weapon ID"))
 		return
 	}
 
 	var updatedWeapon Weapons
-	err = json.NewDecoder(r.Body).Decode(&updatedWeapon)
+	err = decodeJSON(r, &updatedWeapon)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error decoding request body: %s", err), http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid request body: %s", err))
 		return
 	}
 
-	updatedWeapon.UpdatedAt = time.Now()
-
-	err = cc.updateWeapon(id, &updatedWeapon)
+	err = updatedWeapon.Validate()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error updating weapon: %s", err), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	responseJSON, err := json.Marshal(updatedWeapon)
+	current, err := cc.getWeaponByID(id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding updated weapon to JSON: %s", err), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("error getting weapon: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
-}
-
-func (cc *WeaponsController) updateWeapon(id int, updatedWeapon *Weapons) error {
-	// Start building the SQL query
-	query := "UPDATE weapons SET updated_at = $1"
-	args := []interface{}{updatedWeapon.UpdatedAt}
-
-	// Conditionally include fields in the update query
-	if updatedWeapon.Name != "" {
-		query += ", name = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedWeapon.Name)
+	if current == nil {
+		writeError(w, r, NotFound("Weapon not found"))
+		return
 	}
-	if updatedWeapon.TypeID != 0 {
-		query += ", type_id = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedWeapon.TypeID)
+
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	if updatedWeapon.StrMag != nil {
-		query += ", str_mag = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedWeapon.StrMag)
+
+	updatedWeapon.UpdatedAt = time.Now()
+
+	err = cc.updateWeapon(id, &updatedWeapon, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating weapon: %w", err))
+		return
 	}
-	if updatedWeapon.Might != nil {
-		query += ", might = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedWeapon.Might)
+
+	w.Header().Set("ETag", etagFor(updatedWeapon.ID, updatedWeapon.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedWeapon)
+}
+
+func (cc *WeaponsController) PatchOne(w http.ResponseWriter, r *http.Request) {
+	weaponID := mux.Vars(r)["weaponID"]
+	id, err := strconv.Atoi(weaponID)
+	if err != nil {
+		writeError(w, r, BadRequest("Invalid weapon ID"))
+		return
 	}
-	if updatedWeapon.Hit != nil {
-		query += ", hit = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedWeapon.Hit)
+
+	updatedWeapon, err := cc.getWeaponByID(id)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error getting weapon: %w", err))
+		return
 	}
-	if updatedWeapon.Critical != nil {
-		query += ", critical = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedWeapon.Critical)
+
+	if updatedWeapon == nil {
+		writeError(w, r, NotFound("Weapon not found"))
+		return
 	}
-	if updatedWeapon.Durability != 0 {
-		query += ", durability = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedWeapon.Durability)
+
+	version := updatedWeapon.UpdatedAt
+	err = checkIfMatch(r, etagFor(updatedWeapon.ID, version))
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	if updatedWeapon.Weight != 0 {
-		query += ", weight = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedWeapon.Weight)
+
+	err = applyMergePatch(r, updatedWeapon)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	if updatedWeapon.RangeMin != 0 {
-		query += ", range_min = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedWeapon.RangeMin)
+
+	err = updatedWeapon.Validate()
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	if updatedWeapon.RangeMax != nil {
-		query += ", range_max = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedWeapon.RangeMax)
+
+	updatedWeapon.UpdatedAt = time.Now()
+
+	err = cc.updateWeapon(id, updatedWeapon, version)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error updating weapon: %w", err))
+		return
 	}
-	if updatedWeapon.Description != nil {
-		query += ", description = $" + strconv.Itoa(len(args)+1)
-		args = append(args, updatedWeapon.Description)
+
+	w.Header().Set("ETag", etagFor(updatedWeapon.ID, updatedWeapon.UpdatedAt))
+	writeJSON(w, r, http.StatusOK, updatedWeapon)
+}
+
+func (cc *WeaponsController) updateWeapon(id int, updatedWeapon *Weapons, version time.Time) error {
+	if updatedWeapon.Effects == nil {
+		updatedWeapon.Effects = []WeaponEffect{}
 	}
 
-	// Finish the query with the WHERE clause
-	query += " WHERE id = $" + strconv.Itoa(len(args)+1)
-	args = append(args, id)
-	err := cc.db.QueryRow(query+" RETURNING *", args...).Scan(
-		&updatedWeapon.ID, &updatedWeapon.Name, &updatedWeapon.TypeID, &updatedWeapon.StrMag,
-		&updatedWeapon.Might, &updatedWeapon.Hit, &updatedWeapon.Critical,
-		&updatedWeapon.Durability, &updatedWeapon.Weight, &updatedWeapon.RangeMin,
-		&updatedWeapon.RangeMax, &updatedWeapon.Description, &updatedWeapon.CreatedAt,
-		&updatedWeapon.UpdatedAt)
+	// Every column is written so that PUT replaces the whole weapon. The row is
+	// only updated if it has not changed since version was read.
+	err := cc.db.QueryRow(`
+		UPDATE weapons SET name = $1, type_id = $2, str_mag = $3, might = $4, hit = $5,
+			critical = $6, durability = $7, weight = $8, range_min = $9, range_max = $10,
+			description = $11, crest_id = $12, effects = $13, updated_at = $14
+		WHERE id = $15 AND updated_at = $16
+		RETURNING *
+	`, updatedWeapon.Name, updatedWeapon.TypeID, updatedWeapon.StrMag, updatedWeapon.Might,
+		updatedWeapon.Hit, updatedWeapon.Critical, updatedWeapon.Durability,
+		updatedWeapon.Weight, updatedWeapon.RangeMin, updatedWeapon.RangeMax,
+		updatedWeapon.Description, updatedWeapon.CrestID, jsonColumn{updatedWeapon.Effects},
+		updatedWeapon.UpdatedAt, id, version).Scan(weaponColumns(updatedWeapon)...)
 
-	if err != nil {
+	if err == sql.ErrNoRows {
+		return Conflict("Weapon with ID %d was modified or deleted by another request", id)
+	} else if err != nil {
 		return err
 	}
 
@@ -317,41 +372,51 @@ func (cc *WeaponsController) DeleteOne(w http.ResponseWriter, r *http.Request) {
 	weaponID := mux.Vars(r)["weaponID"]
 	id, err := strconv.Atoi(weaponID)
 	if err != nil {
-		http.Error(w, "Invalid weapon ID", http.StatusBadRequest)
+		writeError(w, r, BadRequest("Invalid weapon ID"))
 		return
 	}
 
-	err = cc.deleteWeapon(id)
+	current, err := cc.getWeaponByID(id)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, fmt.Sprintf("Weapon with ID %d not found", id), http.StatusNotFound)
-		} else {
-			http.Error(w, fmt.Sprintf("Error deleting weapon: %s", err), http.StatusInternalServerError)
-		}
+		writeError(w, r, fmt.Errorf("error getting weapon: %w", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"success": true, "msg": "Weapon deleted successfully."}`))
-}
+	if current == nil {
+		writeError(w, r, NotFound("Weapon with ID %d not found", id))
+		return
+	}
 
-func (cc *WeaponsController) deleteWeapon(id int) error {
-	// Check if the weapon exists
-	var exists bool
-	err := cc.db.QueryRow("SELECT EXISTS (SELECT 1 FROM weapons WHERE id = $1)", id).Scan(&exists)
+	err = checkIfMatch(r, etagFor(current.ID, current.UpdatedAt))
 	if err != nil {
-		return err
+		writeError(w, r, err)
+		return
 	}
 
-	if !exists {
-		return fmt.Errorf("weapon with ID %d not found", id)
+	err = cc.deleteWeapon(id, current.UpdatedAt)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("error deleting weapon: %w", err))
+		return
 	}
 
-	// Weapon exists, proceed with deletion
-	_, err = cc.db.Exec("DELETE FROM weapons WHERE id = $1", id)
+	writeJSON(w, r, http.StatusOK, deleteResult{Success: true, Msg: "Weapon deleted successfully."})
+}
+
+func (cc *WeaponsController) deleteWeapon(id int, version time.Time) error {
+	// Only delete the row if it has not changed since version was read
+	result, err := cc.db.Exec("DELETE FROM weapons WHERE id = $1 AND updated_at = $2", id, version)
 	if err != nil {
 		return err
 	}
 
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return Conflict("Weapon with ID %d was modified or deleted by another request", id)
+	}
+
 	return nil
 }